@@ -108,7 +108,7 @@ func (ctrs counters) union(o counters) {
 
 func (ctrs counters) termCountChildren(term parser.Term, parent counter) {
 	switch t := term.(type) {
-	case parser.S, parser.RE:
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes, parser.Offside, parser.Lexical:
 		ctrs.count("", parent)
 	case parser.Rule:
 		ctrs.count(string(t), parent)
@@ -116,12 +116,18 @@ func (ctrs counters) termCountChildren(term parser.Term, parent counter) {
 		for _, child := range t {
 			ctrs.termCountChildren(child, parent)
 		}
+	case parser.Perm:
+		for _, child := range t {
+			ctrs.termCountChildren(child, parent)
+		}
 	case parser.Oneof:
 		ds := counters{}
 		for _, child := range t {
 			ds.union(newCounters(child))
 		}
 		ctrs.mul(ds, parent)
+	case parser.Longest:
+		ctrs.termCountChildren(parser.Oneof(t), parent)
 	case parser.Delim:
 		ctrs.termCountChildren(t.Term, parent.mul(oneOrMore))
 		ctrs.termCountChildren(t.Sep, parent.mul(zeroOrMore))
@@ -135,8 +141,17 @@ func (ctrs counters) termCountChildren(term parser.Term, parent counter) {
 		ctrs.termCountChildren(t.Term, parent.mul(oneOrMore))
 	case parser.CutPoint:
 		ctrs.termCountChildren(t.Term, parent)
+	case parser.LookAhead:
+	case parser.Exclude:
+		ctrs.termCountChildren(t.Term, parent)
 	case parser.ExtRef:
 		ctrs.count(string(t), parent)
+	case parser.Parametric:
+		ctrs.termCountChildren(t.Term, parent)
+	case parser.Call:
+		ctrs.count(string(t.Rule), parent)
+	case parser.ExtPred:
+		ctrs.termCountChildren(t.Term, parent)
 	default:
 		panic(fmt.Errorf("unexpected term type: %v %[1]T", t))
 	}
@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arr-ai/wbnf/dot"
+	"github.com/arr-ai/wbnf/parser"
+)
+
+// BuildDotView renders an AST as a Graphviz DOT graph. It is the DOT
+// counterpart of BuildTreeView: branches are labelled with their child name
+// (and rule tag and choice indices when present) and leaves with their text.
+func BuildDotView(rootname string, root Node, opts dot.Options) string {
+	g := dot.New(rootname, "node [shape=box, fontname=monospace]")
+	dotNode(g, rootname, root, 0, opts)
+	return g.String()
+}
+
+func branchLabel(name string, b Branch) string {
+	label := name
+	if rule, ok := b.One(RuleTag).(Extra); ok && fmt.Sprint(rule.Data) != name {
+		label = fmt.Sprintf("%s (%v)", label, rule.Data)
+	}
+	var choices []string
+	for _, c := range b.Many(ChoiceTag) {
+		choices = append(choices, fmt.Sprint(c.(Extra).Data))
+	}
+	if len(choices) > 0 {
+		label += " ║ " + strings.Join(choices, ",")
+	}
+	return label
+}
+
+func dotNode(g *dot.Graph, name string, node Node, depth int, opts dot.Options) string {
+	if opts.Elided(depth) {
+		return g.Node("…", map[string]string{"shape": "plaintext"})
+	}
+	switch n := node.(type) {
+	case Branch:
+		id := g.Node(branchLabel(name, n), nil)
+		names := make([]string, 0, len(n))
+		for childName := range n {
+			names = append(names, childName)
+		}
+		sort.Strings(names)
+		for _, childName := range names {
+			if strings.HasPrefix(childName, "@") && (opts.SkipAtNodes || childName == RuleTag || childName == ChoiceTag || childName == OrderTag) {
+				continue
+			}
+			label := childName
+			if label == "" {
+				label = "''"
+			}
+			switch c := n[childName].(type) {
+			case One:
+				g.Edge(id, dotNode(g, label, c.Node, depth+1, opts), nil)
+			case Many:
+				for i, child := range c {
+					g.Edge(id, dotNode(g, label, child, depth+1, opts), map[string]string{"label": fmt.Sprint(i)})
+				}
+			}
+		}
+		return id
+	case Leaf:
+		s := parser.Scanner(n)
+		return g.Node(fmt.Sprintf("%s: %d‣%s", name, s.Offset(), s.String()), map[string]string{"shape": "ellipse"})
+	case Extra:
+		return g.Node(fmt.Sprintf("%s: %v", name, n.Data), map[string]string{"shape": "plaintext"})
+	}
+	return g.Node(name, nil)
+}
@@ -114,7 +114,7 @@ func (n Branch) fromParserNode(g parser.Grammar, term parser.Term, ctrs counters
 	var tag string
 	defer enterf("fromParserNode(term=%T(%[1]v), ctrs=%v, v=%v)", term, ctrs, e).exitf("tag=%q, n=%v", &tag, &n)
 	switch t := term.(type) {
-	case parser.S, parser.RE:
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes, parser.Offside, parser.Lexical:
 		n.add("", Leaf(e.(parser.Scanner)), ctrs[""])
 	case parser.Rule:
 		term := g[t]
@@ -141,11 +141,22 @@ func (n Branch) fromParserNode(g parser.Grammar, term parser.Term, ctrs counters
 		for i, child := range node.Children {
 			n.fromParserNode(g, t[i], ctrs, child)
 		}
+	case parser.Perm:
+		node := e.(parser.Node)
+		tag = node.Tag
+		if order, ok := node.Extra.(parser.PermOrder); ok {
+			n.many(OrderTag, Extra{Data: order})
+		}
+		for i, child := range node.Children {
+			n.fromParserNode(g, t[i], ctrs, child)
+		}
 	case parser.Oneof:
 		node := e.(parser.Node)
 		tag = node.Tag
 		n.many(ChoiceTag, Extra{Data: node.Extra.(parser.Choice)})
 		n.fromParserNode(g, t[node.Extra.(parser.Choice)], ctrs, node.Children[0])
+	case parser.Longest:
+		n.fromParserNode(g, parser.Oneof(t), ctrs, e)
 	case parser.Delim:
 		node := e.(parser.Node)
 		tag = node.Tag
@@ -199,6 +210,16 @@ func (n Branch) fromParserNode(g parser.Grammar, term parser.Term, ctrs counters
 		}
 	case parser.CutPoint:
 		n.fromParserNode(g, t.Term, ctrs, e)
+	case parser.LookAhead:
+		// Lookaheads consume no input, so they contribute nothing to the AST.
+	case parser.Exclude:
+		n.fromParserNode(g, t.Term, ctrs, e)
+	case parser.Parametric:
+		n.fromParserNode(g, t.Term, ctrs, e)
+	case parser.Call:
+		n.fromParserNode(g, t.Rule, ctrs, e)
+	case parser.ExtPred:
+		n.fromParserNode(g, t.Term, ctrs, e)
 	case parser.ExtRef:
 		if node, ok := e.(parser.Node); ok {
 			if b, ok := node.Extra.(Branch); ok {
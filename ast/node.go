@@ -15,9 +15,11 @@ const (
 	oneofTag = "|"
 	delimTag = ":"
 	quantTag = "?"
+	permTag  = "&"
 
 	RuleTag   = "@rule"
 	ChoiceTag = "@choice"
+	OrderTag  = "@order"
 	SkipTag   = "@skip"
 )
 
@@ -43,6 +45,10 @@ type Node interface {
 	One(name string) Node
 	Many(name string) []Node
 	Scanner() parser.Scanner
+	// Leading and Trailing return the trivia around the node's first and last
+	// tokens, if it was parsed with parser.ParseOptions.Trivia.
+	Leading() []parser.Scanner
+	Trailing() []parser.Scanner
 	collapse(level int) Node
 	isNode()
 	clone() Node
@@ -176,3 +182,64 @@ func (n Branch) narrow() bool {
 func (c Extra) narrow() bool {
 	return true
 }
+
+func (l Leaf) Leading() []parser.Scanner {
+	return parser.Scanner(l).Leading()
+}
+
+func (l Leaf) Trailing() []parser.Scanner {
+	return parser.Scanner(l).Trailing()
+}
+
+func (n Branch) Leading() []parser.Scanner {
+	if first, _, ok := n.tokens(); ok {
+		return first.Leading()
+	}
+	return nil
+}
+
+func (n Branch) Trailing() []parser.Scanner {
+	if _, last, ok := n.tokens(); ok {
+		return last.Trailing()
+	}
+	return nil
+}
+
+// tokens returns the first and last of n's tokens.
+func (n Branch) tokens() (first, last parser.Scanner, ok bool) {
+	var visit func(node Node)
+	visit = func(node Node) {
+		switch node := node.(type) {
+		case Leaf:
+			s := parser.Scanner(node)
+			if !ok || s.Offset() < first.Offset() {
+				first = s
+			}
+			if !ok || s.Offset() > last.Offset() {
+				last = s
+			}
+			ok = true
+		case Branch:
+			for _, children := range node {
+				switch c := children.(type) {
+				case One:
+					visit(c.Node)
+				case Many:
+					for _, child := range c {
+						visit(child)
+					}
+				}
+			}
+		}
+	}
+	visit(n)
+	return
+}
+
+func (c Extra) Leading() []parser.Scanner {
+	return nil
+}
+
+func (c Extra) Trailing() []parser.Scanner {
+	return nil
+}
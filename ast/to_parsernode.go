@@ -88,7 +88,7 @@ func (n Branch) pullFromMany(name string) Node {
 func (n Branch) toParserNode(g parser.Grammar, term parser.Term, ctrs counters) (out parser.TreeElement) {
 	defer enterf("%v.toParserNode(g, term=%T(%[2]v), ctrs=%v)", n, term, ctrs).exitf("%v", &out)
 	switch t := term.(type) {
-	case parser.S, parser.RE:
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes, parser.Offside, parser.Lexical:
 		if node := n.pull("", ctrs[""]); node != nil {
 			return parser.Scanner(node.(Leaf))
 		}
@@ -131,6 +131,19 @@ func (n Branch) toParserNode(g parser.Grammar, term parser.Term, ctrs counters)
 			}
 		}
 		return result
+	case parser.Perm:
+		result := parser.Node{Tag: permTag}
+		if order := n.pullFromMany(OrderTag); order != nil {
+			result.Extra = order.(Extra).Data.(parser.PermOrder)
+		}
+		for _, child := range t {
+			if node := n.toParserNode(g, child, ctrs); node != nil {
+				result.Children = append(result.Children, node)
+			} else {
+				return nil
+			}
+		}
+		return result
 	case parser.Oneof:
 		if choice := n.pullFromMany(ChoiceTag); choice != nil {
 			extra := choice.(Extra).Data.(parser.Choice)
@@ -141,6 +154,8 @@ func (n Branch) toParserNode(g parser.Grammar, term parser.Term, ctrs counters)
 			}
 		}
 		return nil
+	case parser.Longest:
+		return n.toParserNode(g, parser.Oneof(t), ctrs)
 	case parser.Delim:
 		v := parser.Node{
 			Tag:   delimTag,
@@ -190,6 +205,16 @@ func (n Branch) toParserNode(g parser.Grammar, term parser.Term, ctrs counters)
 		return nil
 	case parser.CutPoint:
 		return n.toParserNode(g, t.Term, ctrs)
+	case parser.LookAhead:
+		return parser.Empty{}
+	case parser.Exclude:
+		return n.toParserNode(g, t.Term, ctrs)
+	case parser.Parametric:
+		return n.toParserNode(g, t.Term, ctrs)
+	case parser.Call:
+		return n.toParserNode(g, t.Rule, ctrs)
+	case parser.ExtPred:
+		return n.toParserNode(g, t.Term, ctrs)
 	default:
 		panic(fmt.Errorf("unexpected term type: %v %[1]T", t))
 	}
@@ -75,14 +75,28 @@ func walkTerm(term parser.Term) goNode {
 		for _, t := range t {
 			node.children = append(node.children, walkTerm(t))
 		}
+	case parser.Perm:
+		node.name = "parser.Perm"
+		node.scope = squigglyScope
+		for _, t := range t {
+			node.children = append(node.children, walkTerm(t))
+		}
 	case parser.Oneof:
 		node.name = "parser.Oneof"
 		node.scope = squigglyScope
 		for _, t := range t {
 			node.children = append(node.children, walkTerm(t))
 		}
+	case parser.Longest:
+		node.name = "parser.Longest"
+		node.scope = squigglyScope
+		for _, t := range t {
+			node.children = append(node.children, walkTerm(t))
+		}
 	case parser.S:
 		node.name = fmt.Sprintf("parser.S(`%s`)", safeString(string(t)))
+	case parser.CaselessS:
+		node.name = fmt.Sprintf("parser.CaselessS(`%s`)", safeString(string(t)))
 	case parser.Delim:
 		node.name = "parser.Delim"
 		node.scope = squigglyScope
@@ -103,21 +117,31 @@ func walkTerm(term parser.Term) goNode {
 			node.Add(stringNode("Assoc: parser.RightToLeft"))
 		}
 	case parser.Quant:
-		node.Add(walkTerm(t.Term))
-		if t.Min == 0 && t.Max == 0 {
+		counted := t.MinRef != "" || t.MaxRef != ""
+		if !counted && t.Min == 0 && t.Max == 0 {
 			node.name = "parser.Any"
 			node.scope = bracesScope
-		} else if t.Min == 1 && t.Max == 0 {
+			node.Add(walkTerm(t.Term))
+		} else if !counted && t.Min == 1 && t.Max == 0 {
 			node.name = "parser.Some"
 			node.scope = bracesScope
-		} else if t.Min == 0 && t.Max == 1 {
+			node.Add(walkTerm(t.Term))
+		} else if !counted && t.Min == 0 && t.Max == 1 {
 			node.name = "parser.Opt"
 			node.scope = bracesScope
+			node.Add(walkTerm(t.Term))
 		} else {
 			node.name = "parser.Quant"
 			node.scope = squigglyScope
+			node.Add(prefixName("Term: ", walkTerm(t.Term)))
 			node.Add(stringNode("Min: %d", t.Min))
 			node.Add(stringNode("Max: %d", t.Max))
+			if t.MinRef != "" {
+				node.Add(stringNode("MinRef: `%s`", t.MinRef))
+			}
+			if t.MaxRef != "" {
+				node.Add(stringNode("MaxRef: `%s`", t.MaxRef))
+			}
 		}
 	case parser.Named:
 		node.name = "parser.Eq"
@@ -140,6 +164,17 @@ func walkTerm(term parser.Term) goNode {
 		if t.Default != nil {
 			node.Add(prefixName("Default: ", walkTerm(t.Default)))
 		}
+		if len(t.Mods) > 0 {
+			mods := goNode{name: "Mods: []parser.RefMod", scope: squigglyScope}
+			for _, m := range t.Mods {
+				if m.Arg == "" {
+					mods.Add(stringNode("{Name: `%s`}", m.Name))
+				} else {
+					mods.Add(stringNode("{Name: `%s`, Arg: %q}", m.Name, m.Arg))
+				}
+			}
+			node.Add(mods)
+		}
 	case parser.RE:
 		node = stringNode("parser.RE(`%s`)", safeString(string(t)))
 	case parser.Rule:
@@ -152,8 +187,62 @@ func walkTerm(term parser.Term) goNode {
 		node.name = "parser.CutPoint"
 		node.scope = squigglyScope
 		node.Add(walkTerm(t.Term))
+	case parser.Lexical:
+		node.name = "parser.Lexical"
+		node.scope = squigglyScope
+		node.Add(walkTerm(t.Term))
+	case parser.Exclude:
+		node.name = "parser.Exclude"
+		node.scope = squigglyScope
+		node.children = []goNode{
+			prefixName("Term: ", walkTerm(t.Term)),
+			prefixName("Except: ", walkTerm(t.Except)),
+		}
+	case parser.LookAhead:
+		node.name = "parser.LookAhead"
+		node.scope = squigglyScope
+		node.Add(prefixName("Term: ", walkTerm(t.Term)))
+		if t.Negative {
+			node.Add(stringNode("Negative: true"))
+		}
 	case parser.ExtRef:
 		node = stringNode("parser.ExtRef(`%s`)", safeString(string(t)))
+	case parser.Bytes:
+		node = stringNode("parser.Bytes{Ref: `%s`}", t.Ref)
+	case parser.Offside:
+		kind := map[parser.OffsideKind]string{
+			parser.Newline: "parser.Newline",
+			parser.Indent:  "parser.Indent",
+			parser.Dedent:  "parser.Dedent",
+		}[t.Kind]
+		if t.Comment != "" {
+			node = stringNode("parser.Offside{Kind: %s, Comment: parser.RE(`%s`)}", kind, safeString(string(t.Comment)))
+		} else {
+			node = stringNode("parser.Offside{Kind: %s}", kind)
+		}
+	case parser.Parametric:
+		node.name = "parser.Parametric"
+		node.scope = squigglyScope
+		params := goNode{name: "Params: []string", scope: squigglyScope}
+		for _, p := range t.Params {
+			params.Add(stringNode("`%s`", p))
+		}
+		node.children = []goNode{params, prefixName("Term: ", walkTerm(t.Term))}
+	case parser.Call:
+		node.name = "parser.Call"
+		node.scope = squigglyScope
+		args := goNode{name: "Args: []parser.Term", scope: squigglyScope}
+		for _, t := range t.Args {
+			args.Add(walkTerm(t))
+		}
+		node.children = []goNode{stringNode("Rule: parser.Rule(`%s`)", string(t.Rule)), args}
+	case parser.ExtPred:
+		node.name = "parser.ExtPred"
+		node.scope = squigglyScope
+		node.children = []goNode{
+			prefixName("Term: ", walkTerm(t.Term)),
+			stringNode("Ident: `%s`", safeString(t.Ident)),
+		}
 	default:
 		panic("unexpected term")
 	}
@@ -2,11 +2,17 @@ package codegen
 
 import (
 	"bytes"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/arr-ai/wbnf/wbnf"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWrite(t *testing.T) {
@@ -28,3 +34,31 @@ func TestWrite(t *testing.T) {
 		MiddleSection: append(types.Get(), VisitorWriter{startRule: "IdentStartRule", types: types.types}),
 	}))
 }
+
+func TestWriteParametricRules(t *testing.T) {
+	// The generated package must build, even with a parameter used twice.
+	p, err := wbnf.Compile(`str -> quoted("'") | quoted('"'); quoted(q) -> q (!q /{.})* q;`, nil)
+	require.NoError(t, err)
+	types := MakeTypes(p.Node().(wbnf.GrammarNode))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, TemplateData{
+		PackageName:       "testpackage",
+		StartRule:         IdentName("str"),
+		StartRuleTypeName: GoTypeName("str"),
+		Grammar:           MakeGrammarString(p.Grammar()),
+		MiddleSection:     append(types.Get(), GetVisitorWriter(types.Types(), "str")),
+	}))
+	src, err := format.Source(buf.Bytes())
+	require.NoError(t, err)
+
+	// Written within this module, so that the generated imports resolve.
+	dir, err := ioutil.TempDir(".", "testpackage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "testpackage.go"), src, 0600))
+
+	// Generated grammars use unkeyed parser terms, as in the rest of the repo.
+	out, err := exec.Command("go", "vet", "-composites=false", "./"+filepath.ToSlash(dir)).CombinedOutput()
+	assert.NoError(t, err, "%s", out)
+}
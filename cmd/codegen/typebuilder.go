@@ -74,7 +74,7 @@ func (tm *TypeMap) makeLeafType(term parser.Term, parentName string, quant count
 				count:      quant,
 			}
 		}
-	case parser.S, parser.RE:
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes, parser.Offside, parser.Lexical:
 		val = unnamedToken{parentName, quant}
 	default:
 		panic("Should not have got here")
@@ -85,7 +85,7 @@ func (tm *TypeMap) makeLeafType(term parser.Term, parentName string, quant count
 func (tm *TypeMap) walkTerm(term parser.Term, parentName string, quant countManager,
 	knownRules frozen.Map, termId int) {
 	switch t := term.(type) {
-	case parser.S, parser.RE, parser.Rule:
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes, parser.Offside, parser.Lexical, parser.Rule:
 		tm.makeLeafType(term, parentName, quant.pushSingleNode(termId), knownRules)
 	case parser.REF:
 		tm.pushType("", parentName, backRef{
@@ -104,15 +104,19 @@ func (tm *TypeMap) walkTerm(term parser.Term, parentName string, quant countMana
 		for _, t := range t {
 			tm.walkTerm(t, parentName, quant, knownRules, rand.Int()) //nolint:gosec
 		}
+	case parser.Longest:
+		tm.walkTerm(parser.Oneof(t), parentName, quant, knownRules, termId)
 	case parser.Stack:
 		tm.handleSeq(t, parentName, quant, knownRules, termId)
+	case parser.Perm:
+		tm.handleSeq(parser.Seq(t), parentName, quant, knownRules, termId)
 	case parser.Delim:
 		tm.walkTerm(t.Term, parentName, setWantAllGetter(), knownRules, termId)
-		switch delim := t.Sep.(type) {
+		switch delim := uncut(t.Sep).(type) {
 		case parser.Named:
 			childName := parentName + GoName(delim.Name)
-			switch delim.Term.(type) {
-			case parser.S, parser.CutPoint: //fixme: This will only work as long as cutpoints are s() only
+			switch uncut(delim.Term).(type) {
+			case parser.S, parser.CaselessS:
 				tm.pushType(childName, parentName, namedToken{
 					name:   delim.Name,
 					parent: parentName,
@@ -124,14 +128,14 @@ func (tm *TypeMap) walkTerm(term parser.Term, parentName string, quant countMana
 		case parser.Rule:
 			childName := parentName + GoName(delim.String())
 			tm.walkTerm(t.Sep, childName, setWantAllGetter(), knownRules, termId)
-		case parser.CutPoint, parser.S: // ignore the delim
+		case parser.S, parser.CaselessS: // ignore the delim
 		default:
 			childName := parentName + "Delim"
 			tm.walkTerm(t.Sep, childName, setWantAllGetter(), knownRules, termId)
 		}
 	case parser.Named:
 		childName := parentName + GoName(t.Name)
-		switch term := t.Term.(type) {
+		switch term := uncut(t.Term).(type) {
 		case parser.Rule:
 			tm.pushType(childName, parentName, namedRule{
 				name:       t.Name,
@@ -139,7 +143,14 @@ func (tm *TypeMap) walkTerm(term parser.Term, parentName string, quant countMana
 				returnType: term.String(),
 				count:      quant,
 			})
-		case parser.RE, parser.S, parser.CutPoint:
+		case parser.Call:
+			tm.pushType(childName, parentName, namedRule{
+				name:       t.Name,
+				parent:     parentName,
+				returnType: term.Rule.String(),
+				count:      quant,
+			})
+		case parser.RE, parser.S, parser.CaselessS, parser.Bytes, parser.Offside, parser.Lexical:
 			tm.pushType(childName, parentName, namedToken{
 				name:   t.Name,
 				parent: parentName,
@@ -161,9 +172,30 @@ func (tm *TypeMap) walkTerm(term parser.Term, parentName string, quant countMana
 		tm.walkTerm(t.Term, parentName, quant, knownRules, termId)
 	case parser.CutPoint:
 		tm.walkTerm(t.Term, parentName, quant, knownRules, termId)
+	case parser.LookAhead:
+		// consumes no input, so nothing to add
+	case parser.Exclude:
+		tm.walkTerm(t.Term, parentName, quant, knownRules, termId)
 	case parser.ExtRef:
 		// nothing yet
+	case parser.Parametric:
+		tm.walkTerm(t.Term, parentName, quant, knownRules, termId)
+	case parser.Call:
+		tm.makeLeafType(t.Rule, parentName, quant.pushSingleNode(termId), knownRules)
+	case parser.ExtPred:
+		tm.walkTerm(t.Term, parentName, quant, knownRules, termId)
 	default:
 		panic("unknown type")
 	}
 }
+
+// uncut returns t without the CutPoints around it.
+func uncut(t parser.Term) parser.Term {
+	for {
+		cp, ok := t.(parser.CutPoint)
+		if !ok {
+			return t
+		}
+		t = cp.Term
+	}
+}
@@ -266,6 +266,23 @@ INT     -> \d+;`)
 	})
 }
 
+func TestTypeBuilder_ParametricRules(t *testing.T) {
+	types := initTypeBuilderTest(t, `str -> quoted("'") | q=quoted('"'); quoted(q) -> q (!q /{.})* q;`)
+
+	assert.IsType(t, rule{}, types["StrNode"])
+	assert.IsType(t, rule{}, types["QuotedNode"])
+	assert.Len(t, types, 2)
+	testChildren(t, types["StrNode"].Children(), childrenTestData{
+		"@choice": {},
+		"quoted":  {t: namedRule{}, quant: wantOneGetter, returnType: "QuotedNode"},
+		"q":       {t: namedRule{}, quant: wantOneGetter, returnType: "QuotedNode"},
+	})
+	testChildren(t, types["QuotedNode"].Children(), childrenTestData{
+		"q":     {t: backRef{}},
+		"Token": {t: unnamedToken{}},
+	})
+}
+
 func TestDropCaps(t *testing.T) {
 	tests := []string{
 		"A", "A",
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/arr-ai/wbnf/wbnf"
+)
+
+var cutsCommand = cli.Command{
+	Name:   "cuts",
+	Usage:  "List the cutpoints of a grammar, explicit or inserted automatically",
+	Action: cuts,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "grammar",
+			Usage:       "input grammar file",
+			Required:    true,
+			TakesFile:   true,
+			Destination: &inGrammarFile,
+		},
+	},
+}
+
+func cuts(c *cli.Context) error {
+	p, err := loadGrammar(inGrammarFile)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tPOSITION\tKIND\tTERM")
+	for _, cut := range wbnf.Cuts(p.Node().(wbnf.GrammarNode)) {
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\n", cut.Rule, cut.Position, cut.Kind, cut.Term)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/arr-ai/wbnf/parser"
+	"github.com/arr-ai/wbnf/wbnf"
+)
+
+var graphFormat string
+var graphCommand = cli.Command{
+	Name:   "graph",
+	Usage:  "Output the rule dependency graph of a grammar",
+	Action: graph,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "grammar",
+			Usage:       "input grammar file",
+			Required:    true,
+			TakesFile:   true,
+			Destination: &inGrammarFile,
+		},
+		cli.StringFlag{
+			Name:        "start",
+			Usage:       "rule to check reachability from",
+			Required:    false,
+			TakesFile:   false,
+			Destination: &startingRule,
+		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "output format: dot or json",
+			Value:       "dot",
+			Required:    false,
+			TakesFile:   false,
+			Destination: &graphFormat,
+		},
+	},
+}
+
+func graph(c *cli.Context) error {
+	p, err := loadGrammar(inGrammarFile)
+	if err != nil {
+		return err
+	}
+	rg, err := wbnf.NewRuleGraph(p.Grammar(), parser.Rule(startingRule))
+	if err != nil {
+		return err
+	}
+	switch graphFormat {
+	case "dot":
+		fmt.Print(rg.Dot())
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rg)
+	default:
+		return fmt.Errorf("unknown output format '%s'", graphFormat)
+	}
+	return nil
+}
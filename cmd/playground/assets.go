@@ -0,0 +1,89 @@
+package playground
+
+// indexHTML is the playground page. It is kept inline, rather than loaded from
+// disk, so the binary can serve it without any other files.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ωBNF playground</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: grid; height: 100vh;
+       grid-template-columns: 1fr 1fr; grid-template-rows: auto 1fr 1fr; }
+header { grid-column: 1 / 3; padding: 6px 12px; background: #335; color: #fff; }
+header select { margin-left: 1em; }
+section { display: flex; flex-direction: column; min-height: 0; border: 1px solid #ccc; }
+section h2 { font-size: 13px; margin: 0; padding: 4px 8px; background: #eee; }
+textarea, pre { flex: 1; margin: 0; padding: 8px; font: 13px monospace; border: none; overflow: auto; }
+textarea { resize: none; }
+.error { color: #b00; white-space: pre-wrap; }
+.warning { color: #a60; white-space: pre-wrap; }
+#railroad { overflow: auto; padding: 8px; }
+svg.railroad path { stroke: #333; stroke-width: 1.5; fill: none; }
+svg.railroad rect { stroke: #333; stroke-width: 1.5; fill: #ffd; }
+svg.railroad g.terminal rect { fill: #dfd; }
+svg.railroad g[data-rule] { cursor: pointer; }
+svg.railroad text { font: 12px monospace; text-anchor: middle; }
+</style>
+</head>
+<body>
+<header>ωBNF playground <label>start rule<select id="rule"></select></label></header>
+<section><h2>Grammar</h2><textarea id="grammar" spellcheck="false">expr -> @:op=[-+]
+      > @:op=[*/]
+      > "(" @ ")"
+      > \d+;
+.wrapRE -> /{\s*()\s*};
+</textarea><pre id="compileError" class="error"></pre><pre id="warnings" class="warning"></pre></section>
+<section><h2>Input</h2><textarea id="input" spellcheck="false">1 + 2 * (3 - 4)</textarea></section>
+<section><h2>Railroad</h2><div id="railroad"></div></section>
+<section><h2>Parse tree</h2><pre id="parseError" class="error"></pre><pre id="tree"></pre></section>
+<script>
+var $ = function(id) { return document.getElementById(id); };
+var timer = null;
+
+function run() {
+  fetch("/api/run", {
+    method: "POST",
+    body: JSON.stringify({grammar: $("grammar").value, input: $("input").value, rule: $("rule").value})
+  }).then(function(r) { return r.json(); }).then(show);
+}
+
+function show(resp) {
+  $("compileError").textContent = resp.compileError || "";
+  $("warnings").textContent = (resp.warnings || []).join("\n");
+  if (resp.compileError) {
+    return;
+  }
+  var select = $("rule");
+  select.innerHTML = "";
+  (resp.rules || []).forEach(function(rule) {
+    var opt = document.createElement("option");
+    opt.value = opt.textContent = rule;
+    opt.selected = rule === resp.rule;
+    select.appendChild(opt);
+  });
+  $("railroad").innerHTML = resp.railroad || "";
+  $("parseError").textContent = resp.parseError || "";
+  $("tree").textContent = resp.tree || "";
+}
+
+function schedule() {
+  clearTimeout(timer);
+  timer = setTimeout(run, 300);
+}
+
+$("grammar").addEventListener("input", schedule);
+$("input").addEventListener("input", schedule);
+$("rule").addEventListener("change", run);
+$("railroad").addEventListener("click", function(e) {
+  var g = e.target.closest("g[data-rule]");
+  if (g) {
+    $("rule").value = g.getAttribute("data-rule");
+    run();
+  }
+});
+run();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,281 @@
+package playground
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/arr-ai/wbnf/parser"
+)
+
+// The railroad renderer lays out every diagram element relative to the track
+// line that enters on its left and leaves on its right. Each element knows its
+// width and how far it extends above (up) and below (down) the track.
+
+const (
+	charWidth  = 7
+	boxHeight  = 22
+	boxPadding = 10
+	hGap       = 10
+	vGap       = 8
+	branchGap  = 20
+)
+
+type diagram interface {
+	size() (w, up, down int)
+	draw(sb *strings.Builder, x, y int)
+}
+
+type box struct {
+	text     string
+	rule     string
+	terminal bool
+}
+
+func (b box) size() (w, up, down int) {
+	return len([]rune(b.text))*charWidth + 2*boxPadding, boxHeight / 2, boxHeight / 2
+}
+
+func (b box) draw(sb *strings.Builder, x, y int) {
+	w, up, _ := b.size()
+	rx := 0
+	class := "nonterminal"
+	if b.terminal {
+		rx = boxHeight / 2
+		class = "terminal"
+	}
+	attr := ""
+	if b.rule != "" {
+		attr = fmt.Sprintf(` data-rule="%s"`, html.EscapeString(b.rule))
+	}
+	fmt.Fprintf(sb, `<g class="%s"%s><rect x="%d" y="%d" width="%d" height="%d" rx="%d"/>`,
+		class, attr, x, y-up, w, boxHeight, rx)
+	fmt.Fprintf(sb, `<text x="%d" y="%d">%s</text></g>`, x+w/2, y+4, html.EscapeString(b.text))
+}
+
+type skip struct{}
+
+func (skip) size() (w, up, down int)            { return 0, 0, 0 }
+func (skip) draw(sb *strings.Builder, x, y int) {}
+
+type sequence []diagram
+
+func (s sequence) size() (w, up, down int) {
+	for i, d := range s {
+		dw, du, dd := d.size()
+		if i > 0 {
+			w += hGap
+		}
+		w += dw
+		up = max(up, du)
+		down = max(down, dd)
+	}
+	return
+}
+
+func (s sequence) draw(sb *strings.Builder, x, y int) {
+	for i, d := range s {
+		if i > 0 {
+			line(sb, x, y, x+hGap, y)
+			x += hGap
+		}
+		w, _, _ := d.size()
+		d.draw(sb, x, y)
+		x += w
+	}
+}
+
+type choice []diagram
+
+func (c choice) size() (w, up, down int) {
+	for i, d := range c {
+		dw, du, dd := d.size()
+		w = max(w, dw)
+		if i == 0 {
+			up, down = du, dd
+		} else {
+			down += vGap + du + dd
+		}
+	}
+	return w + 2*branchGap, up, down
+}
+
+func (c choice) draw(sb *strings.Builder, x, y int) {
+	w, _, _ := c.size()
+	cy := y
+	for i, d := range c {
+		dw, du, dd := d.size()
+		if i > 0 {
+			cy += du
+		}
+		fmt.Fprintf(sb, `<path d="M%d %dH%dV%dH%d"/>`, x, y, x+branchGap/2, cy, x+branchGap)
+		d.draw(sb, x+branchGap, cy)
+		fmt.Fprintf(sb, `<path d="M%d %dH%dV%dH%d"/>`, x+branchGap+dw, cy, x+w-branchGap/2, y, x+w)
+		cy += dd + vGap
+	}
+}
+
+type repeat struct {
+	item, sep diagram
+}
+
+func (r repeat) size() (w, up, down int) {
+	iw, iu, id := r.item.size()
+	sw, su, sd := r.sep.size()
+	return max(iw, sw) + 2*branchGap, iu, id + vGap + su + sd
+}
+
+func (r repeat) draw(sb *strings.Builder, x, y int) {
+	w, _, _ := r.size()
+	iw, _, id := r.item.size()
+	sw, su, _ := r.sep.size()
+	inner := w - 2*branchGap
+	line(sb, x, y, x+branchGap, y)
+	r.item.draw(sb, x+branchGap, y)
+	line(sb, x+branchGap+iw, y, x+w, y)
+	ly := y + id + vGap + su
+	sx := x + branchGap + (inner-sw)/2
+	fmt.Fprintf(sb, `<path d="M%d %dH%dV%dH%d"/>`, x+w-branchGap, y, x+w-branchGap/2, ly, sx+sw)
+	r.sep.draw(sb, sx, ly)
+	fmt.Fprintf(sb, `<path d="M%d %dH%dV%dH%d"/>`, sx, ly, x+branchGap/2, y, x+branchGap)
+}
+
+func line(sb *strings.Builder, x1, y1, x2, y2 int) {
+	fmt.Fprintf(sb, `<path d="M%d %dL%d %d"/>`, x1, y1, x2, y2)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func optional(d diagram) diagram {
+	return choice{skip{}, d}
+}
+
+func diagramFromTerm(term parser.Term) diagram {
+	switch t := term.(type) {
+	case parser.S:
+		return box{text: t.String(), terminal: true}
+	case parser.CaselessS:
+		return box{text: t.String(), terminal: true}
+	case parser.RE:
+		return box{text: t.String(), terminal: true}
+	case parser.Rule:
+		return box{text: string(t), rule: string(t)}
+	case parser.Seq:
+		if len(t) == 0 {
+			return skip{}
+		}
+		s := make(sequence, 0, len(t))
+		for _, child := range t {
+			s = append(s, diagramFromTerm(child))
+		}
+		return s
+	case parser.Oneof:
+		c := make(choice, 0, len(t))
+		for _, child := range t {
+			c = append(c, diagramFromTerm(child))
+		}
+		return c
+	case parser.Longest:
+		return diagramFromTerm(parser.Oneof(t))
+	case parser.Perm:
+		c := make(choice, 0, len(t))
+		for _, child := range t {
+			c = append(c, diagramFromTerm(child))
+		}
+		return repeat{item: c, sep: box{text: "&&"}}
+	case parser.Delim:
+		var d diagram = repeat{item: diagramFromTerm(t.Term), sep: diagramFromTerm(t.Sep)}
+		sep := diagramFromTerm(t.Sep)
+		if t.CanStartWithSep {
+			d = sequence{optional(sep), d}
+		}
+		if t.CanEndWithSep {
+			d = sequence{d, optional(sep)}
+		}
+		return d
+	case parser.Quant:
+		item := diagramFromTerm(t.Term)
+		var d diagram
+		switch {
+		case t.MinRef != "" || t.MaxRef != "":
+			d = repeat{item: item, sep: box{text: quantLabel(t), terminal: true}}
+		case t.Max == 1:
+			d = item
+		case t.Min > 1 || t.Max > 1:
+			d = repeat{item: item, sep: box{text: quantLabel(t), terminal: true}}
+		default:
+			d = repeat{item: item, sep: skip{}}
+		}
+		if t.Min == 0 {
+			d = optional(d)
+		}
+		return d
+	case parser.Named:
+		return sequence{box{text: t.Name + "=", terminal: false}, diagramFromTerm(t.Term)}
+	case parser.ScopedGrammar:
+		return diagramFromTerm(t.Term)
+	case parser.CutPoint:
+		return diagramFromTerm(t.Term)
+	case parser.Lexical:
+		return diagramFromTerm(t.Term)
+	case parser.Exclude:
+		return sequence{diagramFromTerm(t.Term), box{text: "-"}, diagramFromTerm(t.Except)}
+	case parser.LookAhead:
+		op := "&"
+		if t.Negative {
+			op = "!"
+		}
+		return sequence{box{text: op}, diagramFromTerm(t.Term)}
+	case parser.ExtRef:
+		return box{text: "%%" + string(t)}
+	case parser.REF:
+		text := "%" + t.Ident
+		for _, mod := range t.Mods {
+			text += mod.String()
+		}
+		return box{text: text, terminal: true}
+	case parser.Parametric:
+		return diagramFromTerm(t.Term)
+	case parser.Call:
+		return box{text: t.String(), rule: string(t.Rule)}
+	case parser.Bytes, parser.Offside:
+		return box{text: t.String(), terminal: true}
+	case parser.ExtPred:
+		return sequence{diagramFromTerm(t.Term), box{text: "&%%" + t.Ident}}
+	default:
+		return box{text: term.String()}
+	}
+}
+
+func quantLabel(q parser.Quant) string {
+	if q.MinRef != "" || q.MaxRef != "" {
+		return strings.TrimPrefix(q.String(), q.Term.String())
+	}
+	if q.Max == 0 {
+		return fmt.Sprintf("%d+", q.Min)
+	}
+	return fmt.Sprintf("%d..%d", q.Min, q.Max)
+}
+
+// Railroad renders the term of the given rule as an SVG railroad diagram.
+// Rule references carry a data-rule attribute so the page can navigate to
+// them.
+func Railroad(g parser.Grammar, rule parser.Rule) string {
+	term, has := g[rule]
+	if !has {
+		return ""
+	}
+	d := sequence{box{text: string(rule) + " ->"}, diagramFromTerm(term), box{text: ";"}}
+	w, up, down := d.size()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg class="railroad" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`,
+		w+2*hGap, up+down+2*vGap)
+	d.draw(&sb, hGap, up+vGap)
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
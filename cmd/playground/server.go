@@ -0,0 +1,140 @@
+// Package playground implements a self-contained web page for experimenting
+// with ωBNF grammars. All assets are compiled into the binary so the server
+// works without network access.
+package playground
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/arr-ai/wbnf/ast"
+	"github.com/arr-ai/wbnf/parser"
+	"github.com/arr-ai/wbnf/wbnf"
+)
+
+type request struct {
+	Grammar string `json:"grammar"`
+	Input   string `json:"input"`
+	Rule    string `json:"rule"`
+}
+
+type response struct {
+	Rules        []string `json:"rules"`
+	Rule         string   `json:"rule"`
+	CompileError string   `json:"compileError,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+	ParseError   string   `json:"parseError,omitempty"`
+	Tree         string   `json:"tree,omitempty"`
+	Railroad     string   `json:"railroad,omitempty"`
+}
+
+// NewHandler returns the http.Handler serving the playground page and its
+// API endpoint.
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveIndex)
+	mux.HandleFunc("/api/run", serveRun)
+	return mux
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, indexHTML)
+}
+
+func serveRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run(req)) //nolint:errcheck
+}
+
+// recoverTo turns a panic from the grammar compiler or parser into an error
+// message, as malformed grammars are expected while the user is typing.
+func recoverTo(msg *string) {
+	if r := recover(); r != nil {
+		*msg = fmt.Sprint(r)
+	}
+}
+
+func compile(grammar string) (p parser.Parsers, warnings []string, errMsg string) {
+	defer recoverTo(&errMsg)
+	p, errs, err := wbnf.CompileWithWarnings(grammar, nil)
+	if err != nil {
+		return p, nil, err.Error()
+	}
+	for _, w := range errs {
+		warnings = append(warnings, w.Error())
+	}
+	return p, warnings, ""
+}
+
+func parse(p parser.Parsers, rule, input string) (tree, errMsg string) {
+	defer recoverTo(&errMsg)
+	e, err := p.Parse(parser.Rule(rule), parser.NewScanner(input))
+	if err != nil {
+		uci, ok := err.(parser.UnconsumedInputError)
+		if !ok {
+			return "", err.Error()
+		}
+		e = uci.Result()
+		errMsg = err.Error()
+	}
+	if leaf, ok := e.(parser.Scanner); ok {
+		return ast.BuildTreeView(rule, ast.Leaf(leaf), true), errMsg
+	}
+	return ast.BuildTreeView(rule, ast.FromParserNode(p.Grammar(), e), true), errMsg
+}
+
+func userRules(g parser.Grammar) []string {
+	rules := make([]string, 0, len(g))
+	for rule := range g {
+		if !strings.HasPrefix(string(rule), ".") {
+			rules = append(rules, string(rule))
+		}
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func run(req request) response {
+	var resp response
+	p, warnings, errMsg := compile(req.Grammar)
+	if errMsg != "" {
+		resp.CompileError = errMsg
+		return resp
+	}
+	resp.Warnings = warnings
+	resp.Rules = userRules(p.Grammar())
+	resp.Rule = req.Rule
+	if !p.HasRule(parser.Rule(resp.Rule)) {
+		if len(resp.Rules) == 0 {
+			return resp
+		}
+		resp.Rule = resp.Rules[0]
+	}
+	resp.Railroad = Railroad(p.Grammar(), parser.Rule(resp.Rule))
+	resp.Tree, resp.ParseError = parse(p, resp.Rule, req.Input)
+	resp.ParseError = stripANSI(resp.ParseError)
+	return resp
+}
+
+// stripANSI removes the terminal colour codes the parser uses to highlight
+// error locations.
+func stripANSI(s string) string {
+	return strings.NewReplacer("\033[1;31m", "»", "\033[0m", "«").Replace(s)
+}
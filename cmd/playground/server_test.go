@@ -0,0 +1,73 @@
+package playground
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(t *testing.T, req request) response {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/run", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestPlaygroundIndex(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ωBNF playground")
+}
+
+func TestPlaygroundRun(t *testing.T) {
+	resp := post(t, request{Grammar: `a -> "x" b; b -> "y"+;`, Input: "xyy", Rule: "a"})
+	assert.Empty(t, resp.CompileError)
+	assert.Empty(t, resp.ParseError)
+	assert.Equal(t, []string{"a", "b"}, resp.Rules)
+	assert.Equal(t, "a", resp.Rule)
+	assert.Contains(t, resp.Tree, "1‣y")
+	assert.Contains(t, resp.Railroad, `data-rule="b"`)
+}
+
+func TestPlaygroundDefaultRule(t *testing.T) {
+	resp := post(t, request{Grammar: `b -> "y"; a -> b;`, Input: "y", Rule: "missing"})
+	assert.Equal(t, "a", resp.Rule)
+	assert.Empty(t, resp.ParseError)
+}
+
+func TestPlaygroundErrors(t *testing.T) {
+	resp := post(t, request{Grammar: `a -> b;`})
+	assert.Contains(t, resp.CompileError, "not a defined rule")
+
+	resp = post(t, request{Grammar: `a -> "x";`, Input: "y", Rule: "a"})
+	assert.Empty(t, resp.CompileError)
+	assert.NotEmpty(t, resp.ParseError)
+
+	resp = post(t, request{Grammar: `a -> "x";`, Input: "xy", Rule: "a"})
+	assert.Contains(t, resp.ParseError, "unconsumed input")
+	assert.NotEmpty(t, resp.Tree)
+}
+
+func TestPlaygroundWarnings(t *testing.T) {
+	resp := post(t, request{Grammar: `a -> "x" | "xy";`, Input: "x", Rule: "a"})
+	assert.Empty(t, resp.CompileError)
+	assert.Equal(t, []string{`alternative "xy" at 1:12 can never match, it is shadowed by "x" at 1:6`}, resp.Warnings)
+	assert.Empty(t, resp.ParseError)
+}
+
+func TestRailroadStack(t *testing.T) {
+	resp := post(t, request{Grammar: `e -> @:"+" > "(" @ ")" | \d+;`, Input: "1+(2)", Rule: "e"})
+	assert.Empty(t, resp.ParseError)
+	assert.Contains(t, resp.Rules, "e@1")
+	assert.Contains(t, resp.Railroad, `data-rule="e@1"`)
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/arr-ai/wbnf/ast"
+	"github.com/arr-ai/wbnf/parser"
+)
+
+var replCommand = cli.Command{
+	Name:    "repl",
+	Aliases: []string{"r"},
+	Usage:   "Interactively parse input against a grammar",
+	Action:  repl,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "grammar",
+			Usage:       "input grammar file",
+			Required:    true,
+			TakesFile:   true,
+			Destination: &inGrammarFile,
+		},
+		cli.StringFlag{
+			Name:        "start",
+			Usage:       "starting rule to process the input text",
+			Required:    false,
+			TakesFile:   false,
+			Destination: &startingRule,
+		},
+	},
+}
+
+const replHelp = `Type some input to parse it with the current start rule.
+A line ending in \ is continued on the next line.
+
+Commands:
+  :start RULE   set the rule used to parse input
+  :rules        list the rules in the grammar
+  :reload       reload the grammar file from disk
+  :trace        toggle parser tracing
+  :help         show this message
+  :quit         exit the repl
+`
+
+type replSession struct {
+	filename string
+	start    string
+	trace    bool
+	parsers  parser.Parsers
+	out      io.Writer
+}
+
+func (s *replSession) load() error {
+	p, warnings, err := compileFile(s.filename)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(s.out, "warning: %v\n", warning)
+	}
+	s.parsers = p
+	if s.start != "" && !p.HasRule(parser.Rule(s.start)) {
+		fmt.Fprintf(s.out, "warning: start rule '%s' not in grammar, use :start RULE\n", s.start)
+		s.start = ""
+	}
+	return nil
+}
+
+func sortedRules(g parser.Grammar) []parser.Rule {
+	rules := make([]parser.Rule, 0, len(g))
+	for rule := range g {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i] < rules[j] })
+	return rules
+}
+
+func (s *replSession) rules() []string {
+	var rules []string
+	for _, rule := range sortedRules(s.parsers.Grammar()) {
+		if !strings.HasPrefix(string(rule), ".") && !strings.Contains(string(rule), parser.StackDelim) {
+			rules = append(rules, string(rule))
+		}
+	}
+	return rules
+}
+
+// command handles a single ':'-prefixed line. It returns false when the
+// session should end.
+func (s *replSession) command(line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":q", ":quit", ":exit":
+		return false
+	case ":h", ":help":
+		fmt.Fprint(s.out, replHelp)
+	case ":s", ":start":
+		if len(fields) != 2 {
+			fmt.Fprintln(s.out, "usage: :start RULE")
+			break
+		}
+		if !s.parsers.HasRule(parser.Rule(fields[1])) {
+			fmt.Fprintf(s.out, "error: rule '%s' not in grammar\n", fields[1])
+			break
+		}
+		s.start = fields[1]
+	case ":rules":
+		fmt.Fprintln(s.out, strings.Join(s.rules(), " "))
+	case ":r", ":reload":
+		if err := s.load(); err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+			break
+		}
+		fmt.Fprintf(s.out, "reloaded %s\n", s.filename)
+	case ":t", ":trace":
+		s.trace = !s.trace
+		fmt.Fprintf(s.out, "tracing %s\n", map[bool]string{true: "on", false: "off"}[s.trace])
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, try :help\n", fields[0])
+	}
+	return true
+}
+
+func (s *replSession) parse(input string) {
+	if s.start == "" {
+		fmt.Fprintln(s.out, "error: no start rule, use :start RULE")
+		return
+	}
+	if !s.parsers.HasRule(parser.Rule(s.start)) {
+		fmt.Fprintf(s.out, "error: start rule '%s' not in grammar, use :start RULE\n", s.start)
+		return
+	}
+	if s.trace {
+		level := logrus.GetLevel()
+		logrus.SetLevel(logrus.TraceLevel)
+		defer logrus.SetLevel(level)
+	}
+	tree, err := s.parsers.Parse(parser.Rule(s.start), parser.NewScanner(input))
+	if err != nil {
+		uci, ok := err.(parser.UnconsumedInputError)
+		if !ok {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+			return
+		}
+		tree = uci.Result()
+		defer fmt.Fprintf(s.out, "error: %v\n", err)
+	}
+	var a ast.Node
+	if leaf, ok := tree.(parser.Scanner); ok {
+		a = ast.Leaf(leaf)
+	} else {
+		a = ast.FromParserNode(s.parsers.Grammar(), tree)
+	}
+	fmt.Fprintln(s.out, ast.BuildTreeView(s.start, a, true))
+}
+
+// eval runs a command or parses input, reporting a panic as an error so that
+// one bad line doesn't end the session. It returns false when the session
+// should end.
+func (s *replSession) eval(input string, isCommand bool) (more bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(s.out, "error: %v\n", r)
+			more = true
+		}
+	}()
+	if isCommand {
+		return s.command(input)
+	}
+	s.parse(input)
+	return true
+}
+
+func (s *replSession) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var pending []string
+	prompt := func() {
+		if len(pending) > 0 {
+			fmt.Fprint(s.out, "... ")
+		} else {
+			fmt.Fprintf(s.out, "%s> ", s.start)
+		}
+	}
+	for prompt(); scanner.Scan(); prompt() {
+		line := scanner.Text()
+		if strings.HasSuffix(line, `\`) {
+			pending = append(pending, strings.TrimSuffix(line, `\`))
+			continue
+		}
+		input := strings.Join(append(pending, line), "\n")
+		isCommand := len(pending) == 0 && strings.HasPrefix(line, ":")
+		pending = nil
+		if !s.eval(input, isCommand) {
+			return nil
+		}
+	}
+	fmt.Fprintln(s.out)
+	return scanner.Err()
+}
+
+func repl(c *cli.Context) error {
+	s := &replSession{
+		filename: inGrammarFile,
+		start:    startingRule,
+		out:      os.Stdout,
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "loaded %s, type :help for help\n", s.filename)
+	return s.run(os.Stdin)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type replStep struct {
+	grammar string // if set, written to the grammar file before the script runs
+	script  string
+	want    []string
+}
+
+// panickyWriter panics on writes containing "boom", standing in for a
+// failure deep inside a command.
+type panickyWriter struct {
+	bytes.Buffer
+}
+
+func (w *panickyWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("boom")) {
+		panic("bad write")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestReplSession(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name  string
+		start string
+		steps []replStep
+	}{
+		{"parse", "a", []replStep{
+			{`a -> "x"+;`, "xx\n", []string{"a> ", "x", "a> \n"}},
+		}},
+		{"continuation", "a", []replStep{
+			{`a -> /{[x\n]*};`, "x\\\nx\n", []string{"... ", `x\nx`}},
+		}},
+		{"start", "", []replStep{
+			{`a -> "x"; b -> "y";`, "y\n:start b\ny\n:start c\n", []string{
+				"error: no start rule",
+				"b> ",
+				"error: rule 'c' not in grammar",
+			}},
+		}},
+		{"rules", "a", []replStep{
+			{`a -> b; b -> "y";`, ":rules\n", []string{"a b\n"}},
+		}},
+		{"reload removes start", "a", []replStep{
+			{`a -> "x";`, "x\n", nil},
+			{`b -> "y";`, ":reload\ny\n:start b\ny\n", []string{
+				"warning: start rule 'a' not in grammar",
+				"error: no start rule",
+				"b> ",
+			}},
+		}},
+		{"warnings", "a", []replStep{
+			{`a -> "x" | "xy";`, ":reload\n", []string{
+				`warning: alternative "xy" at 1:12 can never match`,
+				"reloaded",
+			}},
+		}},
+		{"panic", "a", []replStep{
+			{`a -> /{\w*};`, "boom\nx\n", []string{"error: bad write", "a> 0‣x"}},
+		}},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, err := ioutil.TempDir("", "repl")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			filename := filepath.Join(dir, "test.wbnf")
+			var out panickyWriter
+			s := &replSession{filename: filename, start: test.start, out: &out}
+			for i, step := range test.steps {
+				if step.grammar != "" {
+					require.NoError(t, ioutil.WriteFile(filename, []byte(step.grammar), 0600))
+				}
+				out.Reset()
+				if i == 0 {
+					require.NoError(t, s.load())
+				}
+				require.NotPanics(t, func() { require.NoError(t, s.run(strings.NewReader(step.script))) })
+				for _, want := range step.want {
+					assert.Contains(t, out.String(), want, "step %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestReplQuit(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "repl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.wbnf")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`a -> "x";`), 0600))
+
+	for _, quit := range []string{":q", ":quit", ":exit"} {
+		var out bytes.Buffer
+		s := &replSession{filename: filename, start: "a", out: &out}
+		require.NoError(t, s.load())
+		assert.NoError(t, s.run(strings.NewReader("x\n"+quit+"\n:rules\nx\n")), quit)
+		// The session ends at once: nothing after the command runs, and the
+		// line isn't ended as it is at the end of the input.
+		assert.Equal(t, "a> 0‣x\n\na> ", out.String(), quit)
+	}
+}
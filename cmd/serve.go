@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/urfave/cli"
+
+	"github.com/arr-ai/wbnf/cmd/playground"
+)
+
+var serveAddr string
+var serveCommand = cli.Command{
+	Name:   "serve",
+	Usage:  "Start a local web playground for writing grammars",
+	Action: serve,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "addr",
+			Usage:       "address to listen on",
+			Value:       "localhost:8080",
+			Required:    false,
+			TakesFile:   false,
+			Destination: &serveAddr,
+		},
+	},
+}
+
+func serve(c *cli.Context) error {
+	fmt.Printf("ωBNF playground listening on http://%s/\n", serveAddr)
+	return http.ListenAndServe(serveAddr, playground.NewHandler())
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/arr-ai/wbnf/ast"
+	"github.com/arr-ai/wbnf/dot"
 	"github.com/arr-ai/wbnf/parser"
 	"github.com/arr-ai/wbnf/wbnf"
 
@@ -20,6 +22,9 @@ var inGrammarFile string
 var startingRule string
 var verboseMode bool
 var printTree bool
+var outFormat string
+var rawTree bool
+var maxDepth int
 var testCommand = cli.Command{
 	Name:    "test",
 	Aliases: []string{"t"},
@@ -65,6 +70,26 @@ var testCommand = cli.Command{
 			Hidden:      false,
 			Destination: &printTree,
 		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "output format: text, tree or dot",
+			Value:       "text",
+			Required:    false,
+			TakesFile:   false,
+			Destination: &outFormat,
+		},
+		cli.BoolFlag{
+			Name:        "raw",
+			Usage:       "output the raw parse tree instead of the AST",
+			Required:    false,
+			Destination: &rawTree,
+		},
+		cli.IntFlag{
+			Name:        "max-depth",
+			Usage:       "limit the depth of dot output (0 = unlimited)",
+			Required:    false,
+			Destination: &maxDepth,
+		},
 	},
 }
 
@@ -83,28 +108,82 @@ func makeResolver(firstFilename string) resolver {
 	return resolver{filepath.Dir(firstFilename)}
 }
 
-func loadTestGrammar() parser.Parsers {
-	text, err := ioutil.ReadFile(inGrammarFile)
+// compileFile compiles the grammar in filename, along with the warnings about
+// it, so that every command can show them.
+func compileFile(filename string) (parser.Parsers, []error, error) {
+	text, err := ioutil.ReadFile(filename)
 	if err != nil {
-		panic(err)
+		return parser.Parsers{}, nil, err
+	}
+	return wbnf.CompileWithWarnings(string(text), makeResolver(filename))
+}
+
+// loadGrammar compiles the grammar in filename and logs the warnings about it.
+func loadGrammar(filename string) (parser.Parsers, error) {
+	p, warnings, err := compileFile(filename)
+	for _, warning := range warnings {
+		logrus.Warningln(warning)
 	}
+	return p, err
+}
+
+func loadTestGrammar() parser.Parsers {
 	if startingRule == "" {
 		panic(fmt.Errorf("--start missing"))
 	}
-	return wbnf.MustCompile(string(text), makeResolver(inGrammarFile))
+	g, err := loadGrammar(inGrammarFile)
+	if err != nil {
+		panic(err)
+	}
+	return g
 }
 
-func testWbnfFile(filename, grammar string) error {
-	g := wbnf.MustCompile(grammar, makeResolver(filename))
-	if printTree {
-		fmt.Println(ast.BuildTreeView("grammar", g.Node().(wbnf.GrammarNode).Node, true))
+// printOutput writes tree to w in the given format.
+func printOutput(w io.Writer, format, rootname string, g parser.Grammar, tree parser.TreeElement) error {
+	if printTree && format == "text" {
+		format = "tree"
+	}
+	opts := dot.Options{SkipAtNodes: true, MaxDepth: maxDepth}
+	if rawTree {
+		switch format {
+		case "dot":
+			fmt.Fprint(w, parser.BuildDotView(rootname, tree, opts))
+		case "text", "tree":
+			fmt.Fprintln(w, tree)
+		default:
+			return fmt.Errorf("unknown output format '%s'", format)
+		}
+		return nil
+	}
+	var a ast.Node
+	if leaf, ok := tree.(parser.Scanner); ok {
+		a = ast.Leaf(leaf)
 	} else {
-		fmt.Println(g.Node().(ast.Node))
+		a = ast.FromParserNode(g, tree)
+	}
+	switch format {
+	case "dot":
+		fmt.Fprint(w, ast.BuildDotView(rootname, a, opts))
+	case "tree":
+		fmt.Fprintln(w, ast.BuildTreeView(rootname, a, true))
+	case "text":
+		fmt.Fprintln(w, a)
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
 	}
-
 	return nil
 }
 
+// testWbnfFile writes the parse tree of a grammar to w in the given format.
+func testWbnfFile(w io.Writer, format, grammar string) error {
+	core := wbnf.Core()
+	tree, err := core.Parse("grammar", parser.NewScanner(grammar))
+	if err != nil {
+		return err
+	}
+	return printOutput(w, format, "grammar", core.Grammar(), tree)
+}
+
 func test(c *cli.Context) error {
 	source := inFile
 
@@ -131,7 +210,7 @@ func test(c *cli.Context) error {
 		input = string(buf)
 	}
 	if inGrammarFile == "" {
-		return testWbnfFile(source, input)
+		return testWbnfFile(os.Stdout, outFormat, input)
 	}
 	g := loadTestGrammar()
 
@@ -150,11 +229,8 @@ func test(c *cli.Context) error {
 			return err
 		}
 	}
-	a := ast.FromParserNode(g.Grammar(), tree)
-	if printTree {
-		fmt.Println(ast.BuildTreeView(startingRule, a, true))
-	} else {
-		fmt.Println(a)
+	if err := printOutput(os.Stdout, outFormat, startingRule, g.Grammar(), tree); err != nil {
+		return err
 	}
 	if err, ok := err.(parser.UnconsumedInputError); ok {
 		return err
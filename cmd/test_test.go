@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWbnfFile(t *testing.T) {
+	t.Parallel()
+
+	for _, grammar := range []string{
+		`a -> "x" && "y"? && b; b -> "p" || "pq";`,
+		`a -> ("y" && "x") ("p" || "q"):",";`,
+		`a -> x { x -> "k" && "m"; } "k"*;`,
+		`a -> %!M(b, "y") %!M("(", ")"); b -> "x"; .macro M(p, q) { "(" p:q? ")" };`,
+	} {
+		var out bytes.Buffer
+		if assert.NoError(t, testWbnfFile(&out, "text", grammar), grammar) {
+			assert.Contains(t, out.String(), "stmt:", grammar)
+		}
+	}
+
+	for _, filename := range []string{
+		"../examples/wbnf.wbnf",
+		"../examples/xml.wbnf",
+		"../examples/sysl/sysl.wbnf",
+	} {
+		text, err := ioutil.ReadFile(filepath.FromSlash(filename))
+		require.NoError(t, err)
+		for _, format := range []string{"text", "tree", "dot"} {
+			var out bytes.Buffer
+			assert.NoError(t, testWbnfFile(&out, format, string(text)), "%s %s", filename, format)
+			assert.NotEmpty(t, out.String(), "%s %s", filename, format)
+		}
+	}
+
+	var out bytes.Buffer
+	assert.Error(t, testWbnfFile(&out, "text", `a -> "x"`))
+	assert.Empty(t, out.String())
+	assert.Error(t, testWbnfFile(&out, "xml", `a -> "x";`))
+}
@@ -0,0 +1,113 @@
+// Package dot writes graphs in the Graphviz DOT language.
+package dot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Options controls how trees are exported as graphs.
+type Options struct {
+	// SkipAtNodes omits nodes whose names start with "@", as
+	// ast.BuildTreeView does.
+	SkipAtNodes bool
+	// MaxDepth limits how deep the tree is exported. Deeper subtrees are
+	// replaced by a single elided node. Zero means no limit.
+	MaxDepth int
+}
+
+// Elided reports whether nodes at the given depth (the root is depth 0) should
+// be replaced with an elision marker.
+func (o Options) Elided(depth int) bool {
+	return o.MaxDepth > 0 && depth > o.MaxDepth
+}
+
+// Graph accumulates nodes and edges of a directed graph.
+type Graph struct {
+	name  string
+	attrs []string
+	lines []string
+	next  int
+}
+
+func New(name string, attrs ...string) *Graph {
+	return &Graph{name: name, attrs: attrs}
+}
+
+// Quote returns s as a DOT string literal.
+func Quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func attrList(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+Quote(attrs[k]))
+	}
+	return " [" + strings.Join(parts, ", ") + "]"
+}
+
+// Node adds an anonymous node and returns its id.
+func (g *Graph) Node(label string, attrs map[string]string) string {
+	id := fmt.Sprintf("n%d", g.next)
+	g.next++
+	g.NamedNode(id, label, attrs)
+	return id
+}
+
+// NamedNode adds a node with a caller-chosen id.
+func (g *Graph) NamedNode(id, label string, attrs map[string]string) {
+	all := map[string]string{"label": label}
+	for k, v := range attrs {
+		all[k] = v
+	}
+	g.lines = append(g.lines, Quote(id)+attrList(all))
+}
+
+// Edge adds an edge between two node ids.
+func (g *Graph) Edge(from, to string, attrs map[string]string) {
+	g.lines = append(g.lines, Quote(from)+" -> "+Quote(to)+attrList(attrs))
+}
+
+// Subgraph groups existing node ids. Naming it "cluster_..." makes Graphviz
+// draw a box around its members.
+func (g *Graph) Subgraph(name string, ids []string, attrs map[string]string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "subgraph %s {", Quote(name))
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%s;", k, Quote(attrs[k]))
+	}
+	for _, id := range ids {
+		fmt.Fprintf(&sb, " %s;", Quote(id))
+	}
+	sb.WriteString(" }")
+	g.lines = append(g.lines, sb.String())
+}
+
+func (g *Graph) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", Quote(g.name))
+	for _, attr := range g.attrs {
+		fmt.Fprintf(&sb, "  %s;\n", attr)
+	}
+	for _, line := range g.lines {
+		fmt.Fprintf(&sb, "  %s;\n", line)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
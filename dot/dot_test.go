@@ -0,0 +1,42 @@
+package dot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c\nd"`, Quote("a\"b\\c\nd"))
+}
+
+func TestGraph(t *testing.T) {
+	g := New("g", "rankdir=LR")
+	a := g.Node("a", nil)
+	b := g.Node("b", map[string]string{"shape": "ellipse"})
+	g.Edge(a, b, map[string]string{"label": "x"})
+	assert.Equal(t, `digraph "g" {
+  rankdir=LR;
+  "n0" [label="a"];
+  "n1" [label="b", shape="ellipse"];
+  "n0" -> "n1" [label="x"];
+}
+`, g.String())
+}
+
+func TestOptionsElided(t *testing.T) {
+	assert.False(t, Options{}.Elided(100))
+	assert.False(t, Options{MaxDepth: 2}.Elided(2))
+	assert.True(t, Options{MaxDepth: 2}.Elided(3))
+}
+
+func TestSubgraph(t *testing.T) {
+	g := New("g")
+	g.NamedNode("a", "a", nil)
+	g.Subgraph("cluster_0", []string{"a"}, map[string]string{"label": "scc"})
+	assert.Equal(t, `digraph "g" {
+  "a" [label="a"];
+  subgraph "cluster_0" { label="scc"; "a"; };
+}
+`, g.String())
+}
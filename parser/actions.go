@@ -0,0 +1,37 @@
+package parser
+
+// Action will be called when the parser has matched a rule. It receives the
+// match and its values: the results of the actions of rules matched within
+// it, interleaved with the tokens (as Scanners) matched outside those rules,
+// in input order. The result replaces the match in the parse tree as a Value.
+// It is also called for matches the parser later backtracks over, whose results
+// are dropped.
+type Action func(match TreeElement, values []interface{}) (interface{}, error)
+
+type Actions map[Rule]Action
+
+// Value holds the result of an Action in place of the match it was given.
+type Value struct {
+	V interface{}
+}
+
+func (Value) IsTreeElement() {}
+
+// Values returns the values of e as passed to an Action.
+func Values(e TreeElement) []interface{} {
+	return appendValues(nil, e)
+}
+
+func appendValues(values []interface{}, e TreeElement) []interface{} {
+	switch e := e.(type) {
+	case Value:
+		values = append(values, e.V)
+	case Scanner:
+		values = append(values, e)
+	case Node:
+		for _, child := range e.Children {
+			values = appendValues(values, child)
+		}
+	}
+	return values
+}
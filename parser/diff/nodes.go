@@ -32,7 +32,7 @@ func (d NodeDiff) report(path []string, w io.Writer) {
 	if d.A.Tag != d.B.Tag {
 		fmt.Fprintf(w, "%sTag: %v != %v", prefix, d.A.Tag, d.B.Tag)
 	}
-	if d.A.Extra != d.B.Extra {
+	if !reflect.DeepEqual(d.A.Extra, d.B.Extra) {
 		fmt.Fprintf(w, "%sExtra: %v != %v", prefix, d.A.Extra, d.B.Extra)
 	}
 	if len(d.A.Children) != len(d.B.Children) {
@@ -49,7 +49,7 @@ func (d NodeDiff) report(path []string, w io.Writer) {
 func (d NodeDiff) Equal() bool {
 	return len(d.A.Children) == len(d.B.Children) &&
 		d.A.Tag == d.B.Tag &&
-		d.A.Extra == d.B.Extra &&
+		reflect.DeepEqual(d.A.Extra, d.B.Extra) &&
 		len(d.Children) == 0 &&
 		len(d.Types) == 0
 }
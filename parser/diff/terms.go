@@ -3,6 +3,7 @@ package diff
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/arr-ai/wbnf/parser"
 )
@@ -94,10 +95,16 @@ func DiffTerms(a, b parser.Term) TermDiff {
 		return diffSes(a, b.(parser.S))
 	case parser.RE:
 		return diffREs(a, b.(parser.RE))
+	case parser.CaselessS:
+		return diffCaselessSes(a, b.(parser.CaselessS))
 	case parser.Seq:
 		return diffSeqs(a, b.(parser.Seq))
 	case parser.Oneof:
 		return diffOneofs(a, b.(parser.Oneof))
+	case parser.Longest:
+		return diffOneofs(parser.Oneof(a), parser.Oneof(b.(parser.Longest)))
+	case parser.Perm:
+		return diffSeqs(parser.Seq(a), parser.Seq(b.(parser.Perm)))
 	case parser.Stack:
 		return diffTowers(a, b.(parser.Stack))
 	case parser.Delim:
@@ -110,6 +117,22 @@ func DiffTerms(a, b parser.Term) TermDiff {
 		return diffScopedGrammars(a, b.(parser.ScopedGrammar))
 	case parser.CutPoint:
 		return DiffTerms(a.Term, b.(parser.CutPoint).Term)
+	case parser.Lexical:
+		return DiffTerms(a.Term, b.(parser.Lexical).Term)
+	case parser.LookAhead:
+		return diffLookAheads(a, b.(parser.LookAhead))
+	case parser.Exclude:
+		return diffExcludes(a, b.(parser.Exclude))
+	case parser.Parametric:
+		return diffParametrics(a, b.(parser.Parametric))
+	case parser.Call:
+		return diffCalls(a, b.(parser.Call))
+	case parser.ExtPred:
+		return diffExtPreds(a, b.(parser.ExtPred))
+	case parser.Bytes:
+		return diffInterfaces(a.Ref, b.(parser.Bytes).Ref)
+	case parser.Offside:
+		return diffInterfaces(a, b.(parser.Offside))
 	case parser.ExtRef:
 		return diffSes(parser.S(string(a)), parser.S(string(a)))
 	default:
@@ -147,6 +170,20 @@ func diffSes(a, b parser.S) SDiff {
 
 //-----------------------------------------------------------------------------
 
+type CaselessSDiff struct {
+	A, B parser.CaselessS
+}
+
+func (d CaselessSDiff) Equal() bool {
+	return d.A == d.B
+}
+
+func diffCaselessSes(a, b parser.CaselessS) CaselessSDiff {
+	return CaselessSDiff{A: a, B: b}
+}
+
+//-----------------------------------------------------------------------------
+
 type REDiff struct {
 	A, B parser.RE
 }
@@ -250,20 +287,24 @@ func diffDelims(a, b parser.Delim) DelimDiff {
 //-----------------------------------------------------------------------------
 
 type QuantDiff struct {
-	Term TermDiff
-	Min  InterfaceDiff
-	Max  InterfaceDiff
+	Term   TermDiff
+	Min    InterfaceDiff
+	Max    InterfaceDiff
+	MinRef InterfaceDiff
+	MaxRef InterfaceDiff
 }
 
 func (d QuantDiff) Equal() bool {
-	return d.Term.Equal() && d.Min.Equal() && d.Max.Equal()
+	return d.Term.Equal() && d.Min.Equal() && d.Max.Equal() && d.MinRef.Equal() && d.MaxRef.Equal()
 }
 
 func diffQuants(a, b parser.Quant) QuantDiff {
 	return QuantDiff{
-		Term: DiffTerms(a.Term, b.Term),
-		Min:  diffInterfaces(a.Min, b.Min),
-		Max:  diffInterfaces(a.Max, b.Max),
+		Term:   DiffTerms(a.Term, b.Term),
+		Min:    diffInterfaces(a.Min, b.Min),
+		Max:    diffInterfaces(a.Max, b.Max),
+		MinRef: diffInterfaces(a.MinRef, b.MinRef),
+		MaxRef: diffInterfaces(a.MaxRef, b.MaxRef),
 	}
 }
 
@@ -302,3 +343,93 @@ func diffScopedGrammars(a, b parser.ScopedGrammar) ScopedGrammarDiff {
 		Grammar: DiffGrammars(a.Grammar, b.Grammar),
 	}
 }
+
+//-----------------------------------------------------------------------------
+
+type LookAheadDiff struct {
+	Term     TermDiff
+	Negative InterfaceDiff
+}
+
+func (d LookAheadDiff) Equal() bool {
+	return d.Term.Equal() && d.Negative.Equal()
+}
+
+func diffLookAheads(a, b parser.LookAhead) LookAheadDiff {
+	return LookAheadDiff{
+		Term:     DiffTerms(a.Term, b.Term),
+		Negative: diffInterfaces(a.Negative, b.Negative),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+type ExcludeDiff struct {
+	Term   TermDiff
+	Except TermDiff
+}
+
+func (d ExcludeDiff) Equal() bool {
+	return d.Term.Equal() && d.Except.Equal()
+}
+
+func diffExcludes(a, b parser.Exclude) ExcludeDiff {
+	return ExcludeDiff{
+		Term:   DiffTerms(a.Term, b.Term),
+		Except: DiffTerms(a.Except, b.Except),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+type ParametricDiff struct {
+	Params InterfaceDiff
+	Term   TermDiff
+}
+
+func (d ParametricDiff) Equal() bool {
+	return d.Params.Equal() && d.Term.Equal()
+}
+
+func diffParametrics(a, b parser.Parametric) ParametricDiff {
+	return ParametricDiff{
+		Params: diffInterfaces(strings.Join(a.Params, ","), strings.Join(b.Params, ",")),
+		Term:   DiffTerms(a.Term, b.Term),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+type CallDiff struct {
+	Rule RuleDiff
+	Args termsesDiff
+}
+
+func (d CallDiff) Equal() bool {
+	return d.Rule.Equal() && d.Args.Equal()
+}
+
+func diffCalls(a, b parser.Call) CallDiff {
+	return CallDiff{
+		Rule: diffRules(a.Rule, b.Rule),
+		Args: diffTermses(a.Args, b.Args),
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+type ExtPredDiff struct {
+	Term  TermDiff
+	Ident InterfaceDiff
+}
+
+func (d ExtPredDiff) Equal() bool {
+	return d.Term.Equal() && d.Ident.Equal()
+}
+
+func diffExtPreds(a, b parser.ExtPred) ExtPredDiff {
+	return ExtPredDiff{
+		Term:  DiffTerms(a.Term, b.Term),
+		Ident: diffInterfaces(a.Ident, b.Ident),
+	}
+}
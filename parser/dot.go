@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arr-ai/wbnf/dot"
+)
+
+// BuildDotView renders a parse tree as a Graphviz DOT graph. Node labels show
+// the rule tag and any choice index or associativity; leaves show the matched
+// text and its offset.
+func BuildDotView(rootname string, root TreeElement, opts dot.Options) string {
+	g := dot.New(rootname, "node [shape=box, fontname=monospace]")
+	dotNode(g, root, 0, opts)
+	return g.String()
+}
+
+func dotNode(g *dot.Graph, e TreeElement, depth int, opts dot.Options) string {
+	if opts.Elided(depth) {
+		return g.Node("…", map[string]string{"shape": "plaintext"})
+	}
+	switch e := e.(type) {
+	case Node:
+		label := e.Tag
+		if e.Extra != nil {
+			label = fmt.Sprintf("%s ║ %v", label, e.Extra)
+		}
+		id := g.Node(label, nil)
+		for _, child := range e.Children {
+			if child, ok := child.(Node); ok && opts.SkipAtNodes && strings.HasPrefix(child.Tag, "@") {
+				continue
+			}
+			g.Edge(id, dotNode(g, child, depth+1, opts), nil)
+		}
+		return id
+	case Scanner:
+		return g.Node(fmt.Sprintf("%d‣%s", e.Offset(), e.String()), map[string]string{"shape": "ellipse"})
+	case Empty:
+		return g.Node("ε", map[string]string{"shape": "plaintext"})
+	default:
+		return g.Node(fmt.Sprintf("%v", e), map[string]string{"shape": "plaintext"})
+	}
+}
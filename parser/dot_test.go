@@ -0,0 +1,26 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arr-ai/wbnf/dot"
+)
+
+func TestBuildDotView(t *testing.T) {
+	p := Grammar{"a": Seq{S("x"), Oneof{S("y"), S("z")}}}.Compile(nil)
+	tree, err := p.Parse("a", NewScanner("xz"))
+	assert.NoError(t, err)
+
+	out := BuildDotView("a", tree, dot.Options{})
+	assert.True(t, strings.HasPrefix(out, `digraph "a" {`))
+	assert.Contains(t, out, `label="a"`)
+	assert.Contains(t, out, `label="| ║ 1"`)
+	assert.Contains(t, out, `label="1‣z"`)
+
+	out = BuildDotView("a", tree, dot.Options{MaxDepth: 1})
+	assert.NotContains(t, out, `label="1‣z"`)
+	assert.Contains(t, out, `label="…"`)
+}
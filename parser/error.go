@@ -69,7 +69,7 @@ func UnconsumedInput(residue Scanner, result TreeElement) UnconsumedInputError {
 }
 
 func (e UnconsumedInputError) Error() string {
-	return fmt.Sprintf("unconsumed input: %v", e.residue)
+	return fmt.Sprintf("unconsumed input at %v: %v", e.residue.Position(), e.residue)
 }
 
 func (e UnconsumedInputError) Result() TreeElement { return e.tree }
@@ -5,3 +5,12 @@ package parser
 type ExternalRef func(scope Scope, input *Scanner) (TreeElement, error)
 
 type ExternalRefs map[string]ExternalRef
+
+// Predicate will be called when the parser has matched a term followed by
+// &%%ref. It receives the match and the context passed to ParseWithOptions,
+// and returns false to reject the match, which then fails like any other.
+// It is also called for matches the parser later backtracks over, and any
+// change it made to the context is not undone.
+type Predicate func(scope Scope, match TreeElement, ctx interface{}) bool
+
+type Predicates map[string]Predicate
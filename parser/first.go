@@ -0,0 +1,383 @@
+package parser
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arr-ai/wbnf/errors"
+)
+
+// charset is a set of bytes.
+type charset [4]uint64
+
+var anyChar = charset{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}
+
+func (cs *charset) add(b byte) {
+	cs[b/64] |= 1 << (b % 64)
+}
+
+func (cs charset) has(b byte) bool {
+	return cs[b/64]&(1<<(b%64)) != 0
+}
+
+func (cs *charset) union(other charset) {
+	for i := range cs {
+		cs[i] |= other[i]
+	}
+}
+
+// String returns a regexp character class matching the bytes in cs.
+func (cs charset) String() string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for b := 0; b < 256; b++ {
+		if !cs.has(byte(b)) {
+			continue
+		}
+		lo := b
+		for b+1 < 256 && cs.has(byte(b+1)) {
+			b++
+		}
+		writeClassByte(&sb, byte(lo))
+		if b > lo+1 {
+			sb.WriteByte('-')
+		}
+		if b > lo {
+			writeClassByte(&sb, byte(b))
+		}
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+func writeClassByte(sb *strings.Builder, b byte) {
+	switch {
+	case strings.IndexByte(`\]-^`, b) >= 0:
+		sb.WriteByte('\\')
+		sb.WriteByte(b)
+	case b > ' ' && b < utf8.RuneSelf-1:
+		sb.WriteByte(b)
+	default:
+		fmt.Fprintf(sb, `\x%02x`, b)
+	}
+}
+
+// addRange adds the bytes that the UTF-8 encodings of runes from lo to hi can
+// start with. Every byte that isn't ASCII is added for runes that aren't, as
+// invalid UTF-8 may match them too.
+func (cs *charset) addRange(lo, hi rune) {
+	for r := lo; r <= hi && r < utf8.RuneSelf; r++ {
+		cs.add(byte(r))
+	}
+	if hi >= utf8.RuneSelf {
+		for b := utf8.RuneSelf; b <= 0xff; b++ {
+			cs.add(byte(b))
+		}
+	}
+}
+
+// first is what a term's matches can start with: a byte in chars, or nothing
+// at all if nullable.
+type first struct {
+	chars    charset
+	nullable bool
+}
+
+var anything = first{chars: anyChar, nullable: true}
+
+// viable reports whether a term could match input.
+func (f first) viable(input string) bool {
+	return f.nullable || input != "" && f.chars.has(input[0])
+}
+
+// firstSets records what the matches of each rule of a grammar can start with.
+// It errs on the side of too much, so no term that could match is ruled out.
+// Rules not found in g are looked up in parent, as with Nullability.
+type firstSets struct {
+	g      Grammar
+	rules  map[Rule]first
+	parent *firstSets
+	// skipped is what the text .skip skips before a token can start with.
+	skipped charset
+}
+
+func newFirstSets(g Grammar, parent *firstSets) *firstSets {
+	f := &firstSets{g: g.ResolveStacks(), parent: parent}
+	f.solve()
+	if skip, has := f.g[Skip]; has {
+		// Tokens within the skip rule aren't skipped to, so it doesn't need
+		// to know what it skips itself.
+		f.skipped = f.term(skip).chars
+		f.solve()
+	}
+	return f
+}
+
+// solve finds the least fixed point, growing the rules' sets from nothing
+// until they stop growing.
+func (f *firstSets) solve() {
+	f.rules = map[Rule]first{}
+	for changed := true; changed; {
+		changed = false
+		for rule, term := range f.g {
+			if fs := f.term(term); fs != f.rules[rule] {
+				f.rules[rule] = fs
+				changed = true
+			}
+		}
+	}
+}
+
+func (f *firstSets) rule(rule Rule) first {
+	for ; f != nil; f = f.parent {
+		if _, has := f.g[rule]; has {
+			return f.rules[rule]
+		}
+	}
+	return anything
+}
+
+func (f *firstSets) term(term Term) first {
+	switch t := term.(type) {
+	case S:
+		return f.token(string(t), prepareS)
+	case CaselessS:
+		return f.token(string(t), prepareCaselessS)
+	case RE:
+		return f.token(string(t), prepareRE)
+	case Rule:
+		return f.rule(t)
+	case Seq:
+		return f.seq(t)
+	case Perm:
+		return f.union(t, true)
+	case Oneof:
+		return f.union(t, false)
+	case Longest:
+		return f.union(t, false)
+	case Delim:
+		fs := f.term(t.Term)
+		if t.CanStartWithSep || fs.nullable {
+			fs.chars.union(f.term(t.Sep).chars)
+		}
+		return fs
+	case Quant:
+		fs := f.term(t.Term)
+		fs.nullable = fs.nullable || t.Min == 0 || t.MinRef != "" || t.MaxRef != ""
+		return fs
+	case Named:
+		return f.term(t.Term)
+	case CutPoint:
+		return f.term(t.Term)
+	case Lexical:
+		return f.term(t.Term)
+	case Exclude:
+		return f.term(t.Term)
+	case Parametric:
+		return f.term(t.Term)
+	case Call:
+		return f.rule(t.Rule)
+	case ScopedGrammar:
+		return newFirstSets(inheritMagic(t.Grammar, f.g), f).term(t.Term)
+	}
+	// LookAhead, REF, ExtRef, ExtPred, Bytes and Offside depend on more
+	// than the next byte, or call out to code that might have side effects
+	// even where the term fails.
+	return anything
+}
+
+// inheritMagic returns g with the magic rules it inherits from outer, as
+// ScopedGrammar.Parser gives it them.
+func inheritMagic(g, outer Grammar) Grammar {
+	for _, magic := range []Rule{WrapRE, Skip} {
+		if term, has := outer[magic]; has {
+			if _, has := g[magic]; !has {
+				g = g.clone()
+				g[magic] = term
+			}
+		}
+	}
+	return g
+}
+
+// token returns what a terminal's matches can start with, including the text
+// skipped before it, and the text .wrapRE matches before it, if any.
+func (f *firstSets) token(re string, prepare func(string) string) first {
+	fs := first{chars: f.skipped}
+	for _, re := range []string{prepare(re), applyWrapRE(re, prepare, cache{grammar: f.g})} {
+		sre, err := syntax.Parse(re, syntax.Perl)
+		if err != nil {
+			return anything
+		}
+		t := reFirst(sre)
+		fs.chars.union(t.chars)
+		fs.nullable = fs.nullable || t.nullable
+	}
+	return fs
+}
+
+func (f *firstSets) seq(terms []Term) first {
+	var fs first
+	for _, term := range terms {
+		t := f.term(term)
+		fs.chars.union(t.chars)
+		if !t.nullable {
+			return fs
+		}
+	}
+	fs.nullable = true
+	return fs
+}
+
+// union returns what any of terms can start with. The terms are nullable if
+// all of them are or, unless all is set, if any of them is.
+func (f *firstSets) union(terms []Term, all bool) first {
+	fs := first{nullable: all}
+	for _, term := range terms {
+		t := f.term(term)
+		fs.chars.union(t.chars)
+		if all {
+			fs.nullable = fs.nullable && t.nullable
+		} else {
+			fs.nullable = fs.nullable || t.nullable
+		}
+	}
+	return fs
+}
+
+// reFirst returns what the matches of a parsed regexp can start with.
+func reFirst(re *syntax.Regexp) first {
+	var fs first
+	switch re.Op {
+	case syntax.OpNoMatch:
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			fs.nullable = true
+			break
+		}
+		r := re.Rune[0]
+		fs.chars.addRange(r, r)
+		if re.Flags&syntax.FoldCase != 0 {
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				fs.chars.addRange(f, f)
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			fs.chars.addRange(re.Rune[i], re.Rune[i+1])
+		}
+	case syntax.OpAnyCharNotNL:
+		fs.chars = anyChar
+		fs.chars['\n'/64] &^= 1 << ('\n' % 64)
+	case syntax.OpAnyChar:
+		fs.chars = anyChar
+	case syntax.OpCapture, syntax.OpPlus:
+		fs = reFirst(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		fs = reFirst(re.Sub[0])
+		fs.nullable = true
+	case syntax.OpRepeat:
+		fs = reFirst(re.Sub[0])
+		fs.nullable = fs.nullable || re.Min == 0
+	case syntax.OpConcat:
+		fs.nullable = true
+		for _, sub := range re.Sub {
+			t := reFirst(sub)
+			fs.chars.union(t.chars)
+			if !t.nullable {
+				fs.nullable = false
+				break
+			}
+		}
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			t := reFirst(sub)
+			fs.chars.union(t.chars)
+			fs.nullable = fs.nullable || t.nullable
+		}
+	default:
+		// Empty matches and assertions such as ^ and \b.
+		fs.nullable = true
+	}
+	return fs
+}
+
+// dispatchOneofs turns dispatch tables on. It can be turned off to compare, as
+// the tests and benchmarks do.
+var dispatchOneofs = true
+
+// dispatch lists the alternatives of a Oneof that could match, by the next
+// byte of input, or by 256 at the end of input.
+type dispatch struct {
+	index  [257]uint16
+	viable [][]int
+}
+
+// newDispatch returns nil if no alternatives could be ruled out.
+func newDispatch(terms []Term, f *firstSets) *dispatch {
+	if f == nil || !dispatchOneofs {
+		return nil
+	}
+	firsts := make([]first, 0, len(terms))
+	for _, term := range terms {
+		firsts = append(firsts, f.term(term))
+	}
+	d := &dispatch{}
+	sets := map[string]uint16{}
+	useful := false
+	for b := range d.index {
+		var viable []int
+		key := make([]byte, 0, len(terms))
+		for i, fs := range firsts {
+			if fs.nullable || b < len(anyChar)*64 && fs.chars.has(byte(b)) {
+				viable = append(viable, i)
+				key = append(key, byte(i), byte(i>>8))
+			}
+		}
+		useful = useful || len(viable) < len(terms)
+		index, has := sets[string(key)]
+		if !has {
+			index = uint16(len(d.viable))
+			sets[string(key)] = index
+			d.viable = append(d.viable, viable)
+		}
+		d.index[b] = index
+	}
+	if !useful {
+		return nil
+	}
+	return d
+}
+
+// ruledOut is the error of an alternative a dispatch table ruled out. As the
+// alternative was never tried, it is tried when the error's message is built,
+// so that the message is the one it fails with when it is tried. By then the
+// parse is over, so it runs without actions, and with a memo of its own.
+type ruledOut struct {
+	p     Parser
+	scope Scope
+	input Scanner
+}
+
+func (e ruledOut) Error() string {
+	scope := e.scope.withMemo(nil)
+	if scope.Has(actionsKey) {
+		scope = scope.WithActions(nil)
+	}
+	input := e.input
+	var v TreeElement
+	if err := e.p.Parse(scope, &input, &v); err != nil {
+		return err.Error()
+	}
+	panic(errors.Inconceivable)
+}
+
+func (d *dispatch) alternatives(input string) []int {
+	if input == "" {
+		return d.viable[d.index[len(d.index)-1]]
+	}
+	return d.viable[d.index[input[0]]]
+}
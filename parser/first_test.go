@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func firstString(fs first) string {
+	var sb strings.Builder
+	for b := 0; b < 256; b++ {
+		if fs.chars.has(byte(b)) {
+			sb.WriteByte(byte(b))
+		}
+	}
+	if fs.nullable {
+		sb.WriteString("?")
+	}
+	return sb.String()
+}
+
+func TestFirstSets(t *testing.T) {
+	g := Grammar{
+		"a": S("a"),
+		"b": Opt(CaselessS("b")),
+		"c": Seq{Rule("b"), Any(Rule("a")), RE(`\d|x*y`)},
+		"d": Oneof{Rule("e"), Rule("c")},
+		"e": Seq{S("("), Rule("d"), S(")")},
+		"f": Delim{Term: Rule("a"), Sep: S(","), CanStartWithSep: true},
+		"g": LookAhead{Term: Rule("a")},
+		"h": ScopedGrammar{Term: Rule("x"), Grammar: Grammar{"x": S("x")}},
+		"i": Stack{Rule("a"), Oneof{Seq{S("("), At, S(")")}, RE(`[ab]`)}},
+		"j": Lexical{Rule("b")},
+	}
+	f := newFirstSets(g, nil)
+	for rule, expected := range map[Rule]string{
+		"a":   "a",
+		"b":   "Bb?",
+		"c":   "0123456789Babxy",
+		"d":   "(0123456789Babxy",
+		"f":   ",a",
+		"h":   "x",
+		"i":   "a",
+		"i@1": "(ab",
+		"j":   "Bb?",
+	} {
+		assert.Equal(t, expected, firstString(f.rule(rule)), "%s", rule)
+	}
+	assert.Equal(t, anything, f.rule("g"))
+
+	g[WrapRE] = RE(`\s*()`)
+	g[Skip] = RE(`#.*\n`)
+	f = newFirstSets(g, nil)
+	assert.Equal(t, "\t\n\f\r #a", firstString(f.rule("a")))
+	assert.Equal(t, "\t\n\f\r #x", firstString(f.rule("h")))
+}
+
+// wideOneofGrammar is modelled on the rules of the wbnf grammar around atom,
+// whose Oneof has eleven alternatives.
+var wideOneofGrammar = Grammar{
+	WrapRE:  RE(`\s*()\s*`),
+	"terms": Some(Rule("atom")),
+	"atom": Oneof{
+		Rule("range"), Rule("STR"), Rule("call"), Rule("IDENT"), Rule("RE"), Rule("macrocall"),
+		Seq{S("%%"), Rule("IDENT")}, Rule("REF"),
+		Seq{S("("), Rule("terms"), S(")")}, Seq{S("("), S(")")}, S("~"),
+	},
+	"range":     Seq{Rule("STR"), S(".."), Rule("STR")},
+	"call":      Seq{Rule("CALLEE"), Rule("terms"), S(")")},
+	"macrocall": Seq{S("%!"), Rule("IDENT"), S("("), Rule("terms"), S(")")},
+	"REF":       Seq{S("%"), Rule("IDENT"), Opt(Seq{S("="), Rule("atom")})},
+	"IDENT":     RE(`@|[A-Za-z_]\w*|\.\w+`),
+	"CALLEE":    RE(`([A-Za-z_]\w*)\(`),
+	"STR":       RE(`"(?:\\.|[^\\"])*"`),
+	"RE":        RE(`/{(?:\\.|[^\\}])*}`),
+}
+
+const wideOneofInput = `a "b" "c".."d" f(g ~) /{h} %!i(j) %%k %l=m (n "o") () ~ `
+
+func withoutDispatch(f func()) {
+	dispatchOneofs = false
+	defer func() { dispatchOneofs = true }()
+	f()
+}
+
+var callRE = regexp.MustCompile(`(?m)^.*\{ident:.*\n`)
+
+// errorString returns err's message, without the call stacks in it, as a call
+// shares its place in the stack with the calls made after it returns.
+func errorString(err error) string {
+	return callRE.ReplaceAllString(fmt.Sprint(err), "")
+}
+
+func TestOneofDispatch(t *testing.T) {
+	with := wideOneofGrammar.Compile(nil)
+	var without Parsers
+	withoutDispatch(func() { without = wideOneofGrammar.Compile(nil) })
+
+	for _, input := range []string{wideOneofInput, "a (b", `"a"..`, "f(g", "%!", ")", ""} {
+		expected, expectedErr := without.Parse("terms", NewScanner(input))
+		actual, err := with.Parse("terms", NewScanner(input))
+		assert.Equal(t, expected, actual, input)
+		assert.Equal(t, errorString(expectedErr), errorString(err), input)
+	}
+}
+
+func BenchmarkOneofDispatch(b *testing.B) {
+	var sequential Parsers
+	withoutDispatch(func() { sequential = wideOneofGrammar.Compile(nil) })
+	dispatched := wideOneofGrammar.Compile(nil)
+
+	input := strings.Repeat(wideOneofInput, 100)
+	// Every atom in bad fails, each on its first byte.
+	bad := strings.Repeat(") ", 1000)
+	for _, p := range []struct {
+		name string
+		p    Parsers
+	}{{"Sequential", sequential}, {"Dispatch", dispatched}} {
+		p := p
+		b.Run(p.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := p.p.Parse("terms", NewScanner(input)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(p.name+"Failing", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < len(bad); j += 2 {
+					if _, err := p.p.Parse("atom", NewScanner(bad[j:])); err == nil {
+						b.Fatal("parsed ')'")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOneofDispatchErrors(t *testing.T) {
+	g := Grammar{
+		WrapRE: RE(`\s*()\s*`),
+		"a":    Oneof{Seq{CutPoint{S("x")}, Rule("b")}, S("y")},
+		"b":    S("b"),
+	}
+	with := g.Compile(nil)
+	var without Parsers
+	withoutDispatch(func() { without = g.Compile(nil) })
+
+	_, expected := without.Parse("a", NewScanner("z"))
+	_, err := with.Parse("a", NewScanner("z"))
+	assert.Equal(t, errorString(expected), errorString(err))
+	assert.Contains(t, errorString(err), `expect: `+NewScanner(`"x"`).Context())
+}
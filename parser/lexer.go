@@ -0,0 +1,524 @@
+package parser
+
+import (
+	"encoding/binary"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// tokenTable returns the table tokens are lexed into, or nil outside lexer mode
+// or within lexical rules.
+func (s Scope) tokenTable() *tokenTable {
+	if m := s.memo(); m != nil {
+		return m.tokens
+	}
+	return nil
+}
+
+// tokenizer lexes the terminals of a grammar in lexer mode. It skips the text
+// .skip and .wrapRE skip before a token, then matches every terminal at once
+// with a DFA shared by the whole grammar. Outside lexer mode, dfa is nil, and
+// the tokenizer only holds the parts of .wrapRE for lexical rules.
+type tokenizer struct {
+	dfa *dfa
+	// id numbers the tokenizers sharing the DFA.
+	id   int
+	skip *skipper
+	// pre and post eat the text .wrapRE wraps around tokens, if any.
+	pre, post *wrapper
+}
+
+// newTokenizer returns nil if .wrapRE doesn't wrap terminals in anything.
+func newTokenizer(g Grammar, skip *skipper, d *dfa) *tokenizer {
+	t := &tokenizer{dfa: d, skip: skip}
+	if d != nil {
+		t.id = d.tokenizers
+		d.tokenizers++
+	}
+	if wrap, has := g[WrapRE]; has {
+		if oneof, ok := wrap.(Oneof); ok {
+			wrap = oneof[len(oneof)-1]
+		}
+		parts := strings.SplitN(string(wrap.(RE)), "()", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		t.pre, t.post = newWrapper(parts[0]), newWrapper(parts[1])
+	}
+	return t
+}
+
+// wrapper eats the text .wrapRE matches on one side of a token. Where that is
+// a run of ASCII characters from a class, such as \s*, it eats them without
+// running a regexp.
+type wrapper struct {
+	re    *regexp.Regexp
+	class *charset
+}
+
+// newWrapper returns nil if re is empty.
+func newWrapper(re string) *wrapper {
+	if re == "" {
+		return nil
+	}
+	w := &wrapper{re: regexp.MustCompile(`(?m)\A(?:` + re + `)`)}
+	if sre, err := syntax.Parse(re, syntax.Perl); err == nil {
+		sre = sre.Simplify()
+		if sre.Op == syntax.OpStar && sre.Sub[0].Flags&syntax.FoldCase == 0 {
+			var class []rune
+			switch sub := sre.Sub[0]; {
+			case sub.Op == syntax.OpCharClass:
+				class = sub.Rune
+			case sub.Op == syntax.OpLiteral && len(sub.Rune) == 1:
+				class = []rune{sub.Rune[0], sub.Rune[0]}
+			}
+			if len(class) > 0 && class[len(class)-1] < utf8.RuneSelf {
+				w.class = &charset{}
+				for i := 0; i+1 < len(class); i += 2 {
+					w.class.addRange(class[i], class[i+1])
+				}
+			}
+		}
+	}
+	return w
+}
+
+func (w *wrapper) eat(input *Scanner) {
+	if w == nil {
+		return
+	}
+	if w.class == nil {
+		input.EatRegexp(w.re, nil, nil)
+		return
+	}
+	text := input.String()
+	n := 0
+	for n < len(text) && w.class.has(text[n]) {
+		n++
+	}
+	input.Eat(n, &Scanner{})
+}
+
+// tokenTable holds what was lexed at each offset during a parse, so the DFA
+// only runs once per offset, and the states the DFA ran through. What each
+// tokenizer lexed is indexed by its id, then by offset from the start of the
+// input. The lexed structs and their kinds are allocated from free and kinds
+// in bulk.
+type tokenTable struct {
+	start, end int
+	lexed      [][]*lexed
+	states     *dfaStates
+	free       []lexed
+	kinds      []kindMatch
+}
+
+// at returns where to keep what t lexed at offset, or nil if the offset is
+// outside the input.
+func (table *tokenTable) at(t *tokenizer, offset int) **lexed {
+	if offset < table.start || offset > table.end {
+		return nil
+	}
+	byOffset := table.lexed[t.id]
+	if byOffset == nil {
+		byOffset = make([]*lexed, table.end-table.start+1)
+		table.lexed[t.id] = byOffset
+	}
+	return &byOffset[offset-table.start]
+}
+
+// keep returns a copy of kinds that lasts as long as the table.
+func (table *tokenTable) keep(kinds []kindMatch) []kindMatch {
+	if cap(table.kinds)-len(table.kinds) < len(kinds) {
+		n := 256
+		if len(kinds) > n {
+			n = len(kinds)
+		}
+		table.kinds = make([]kindMatch, 0, n)
+	}
+	n := len(table.kinds)
+	table.kinds = append(table.kinds, kinds...)
+	return table.kinds[n:len(table.kinds):len(table.kinds)]
+}
+
+func (table *tokenTable) newLexed() *lexed {
+	if len(table.free) == 0 {
+		table.free = make([]lexed, 64)
+	}
+	l := &table.free[0]
+	table.free = table.free[1:]
+	return l
+}
+
+type lexed struct {
+	leading []Scanner
+	// match is the input after the leading skip, and start is the input after
+	// .wrapRE's prefix too.
+	match, start Scanner
+	kinds        []kindMatch
+}
+
+// kindMatch records where the match of one kind of terminal ends.
+type kindMatch struct {
+	kind, end int
+}
+
+// tokenize lexes input into a stream of tokens ahead of parsing it, taking the
+// longest match at each offset as the token there. The parser takes its tokens
+// from the table, only lexing the offsets tokenize didn't reach, such as where
+// it takes a shorter match as the token or within lexical rules.
+func (t *tokenizer) tokenize(scope Scope, table *tokenTable, input Scanner) {
+	for {
+		l, err := t.lex(scope, table, &input)
+		if err != nil {
+			// The parser reports the error if it gets this far.
+			return
+		}
+		longest := 0
+		for _, k := range l.kinds {
+			if k.end > longest {
+				longest = k.end
+			}
+		}
+		if longest == 0 {
+			return
+		}
+		input.Eat(longest, &Scanner{})
+		t.post.eat(&input)
+		if _, err := t.skip.skip(scope, &input); err != nil {
+			return
+		}
+	}
+}
+
+// lex returns what is lexed at input's offset, advancing input past the leading
+// skip and .wrapRE's prefix.
+func (t *tokenizer) lex(scope Scope, table *tokenTable, input *Scanner) (*lexed, error) {
+	at := table.at(t, input.offset)
+	if at != nil && *at != nil {
+		*input = (*at).start
+		return *at, nil
+	}
+	leading, err := t.skip.skip(scope, input)
+	if err != nil {
+		return nil, err
+	}
+	l := table.newLexed()
+	l.leading, l.match = leading, *input
+	t.pre.eat(input)
+	l.start = *input
+	l.kinds = table.keep(table.states.match(t.dfa, input.String()))
+	if at != nil {
+		*at = l
+	}
+	return l, nil
+}
+
+// length returns the length of the match of the given kind of terminal, or -1
+// if it doesn't match.
+func (l *lexed) length(kind int) int {
+	for _, k := range l.kinds {
+		if k.kind == kind {
+			return k.end
+		}
+	}
+	return -1
+}
+
+// lex eats the terminal in lexer mode, along with any text skipped before and
+// after it.
+func (m tokenMatcher) lex(scope Scope, table *tokenTable, input *Scanner, output *TreeElement) (bool, error) {
+	l, err := m.tokens.lex(scope, table, input)
+	if err != nil {
+		return false, err
+	}
+	n := l.length(m.kind)
+	if n < 0 {
+		*input = l.match
+		return false, nil
+	}
+	var token Scanner
+	input.Eat(n, &token)
+	m.tokens.post.eat(input)
+	match := *l.match.Slice(0, input.offset-l.match.offset)
+	trailing, err := m.skip.skip(scope, input)
+	if err != nil {
+		return false, err
+	}
+	*output = tokenWithTrivia(scope, token, match, l.leading, trailing)
+	return true, nil
+}
+
+// dfa matches all the terminals of a grammar at once, finding where each of
+// their matches end in one pass over the input. Its terminals are added as the
+// grammar is compiled in lexer mode, after which it doesn't change, so
+// concurrent parses can share it. Each parse makes the DFA's states from the
+// terminals' compiled regexps as the input calls for them, in dfaStates of its
+// own, which later parses reuse.
+type dfa struct {
+	kinds map[string]int
+	progs []*syntax.Prog
+	// empty holds the empty-width assertions the terminals make.
+	empty      syntax.EmptyOp
+	tokenizers int
+	pool       sync.Pool
+}
+
+// maxDFAStates bounds the states a dfaStates keeps between scans. When there
+// are more, they are all dropped, to be made again as needed.
+const maxDFAStates = 10000
+
+type dfaStates struct {
+	states map[string]*dfaState
+	start  *dfaState
+	dead   *dfaState
+	// ends holds where the match of each kind ends during a match, or -1,
+	// and matched the kinds that have matched. kinds holds what match
+	// returns.
+	ends    []int
+	matched []int
+	kinds   []kindMatch
+}
+
+// thread is an instruction of a terminal's program: kind<<32 | pc. A state's
+// threads are kept in order of kind, and within a kind in the order the
+// terminal's regexp prefers them, so that the DFA finds the match the regexp
+// would.
+type thread uint64
+
+func (t thread) kind() int { return int(t >> 32) }
+
+func (t thread) goTo(pc uint32) thread { return t&^0xffffffff | thread(pc) }
+
+type dfaState struct {
+	kernel []thread
+	// closures holds the state's closure in each context of empty-width
+	// assertions it has been in. There are only ever a few.
+	closures []*dfaClosure
+}
+
+type dfaClosure struct {
+	ctx syntax.EmptyOp
+	// steps are the instructions that match a rune.
+	steps   []thread
+	matches []int
+	ascii   [utf8.RuneSelf]*dfaState
+	next    map[rune]*dfaState
+}
+
+func newDFA() *dfa {
+	return &dfa{kinds: map[string]int{}}
+}
+
+// add returns the kind of the terminal matched by re, adding it to the DFA if
+// it is new.
+func (d *dfa) add(re *regexp.Regexp) int {
+	if kind, has := d.kinds[re.String()]; has {
+		return kind
+	}
+	sre, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		panic(err)
+	}
+	prog, err := syntax.Compile(sre.Simplify())
+	if err != nil {
+		panic(err)
+	}
+	for _, inst := range prog.Inst {
+		if inst.Op == syntax.InstEmptyWidth {
+			d.empty |= syntax.EmptyOp(inst.Arg)
+		}
+	}
+	kind := len(d.progs)
+	d.kinds[re.String()] = kind
+	d.progs = append(d.progs, prog)
+	return kind
+}
+
+// newTable returns a table for a parse of input, with states left by earlier
+// parses. It should be released once the parse is done.
+func (d *dfa) newTable(input Scanner) *tokenTable {
+	states, _ := d.pool.Get().(*dfaStates)
+	if states == nil {
+		states = &dfaStates{}
+	}
+	return &tokenTable{
+		start:  input.offset,
+		end:    input.offset + len(input.String()),
+		lexed:  make([][]*lexed, d.tokenizers),
+		states: states,
+	}
+}
+
+func (d *dfa) release(table *tokenTable) {
+	d.pool.Put(table.states)
+}
+
+// match returns where the match of each kind of terminal at the start of text
+// ends, in a slice it reuses on the next call. As in the terminals' regexps, the match that ends last isn't always the
+// one preferred, so the end of a kind's match is moved on only by threads the
+// regexp prefers to the one that last matched.
+func (s *dfaStates) match(d *dfa, text string) []kindMatch {
+	if s.start == nil || len(s.states) > maxDFAStates {
+		s.states = map[string]*dfaState{}
+		s.dead = &dfaState{}
+		kernel := make([]thread, 0, len(d.progs))
+		for kind, prog := range d.progs {
+			kernel = append(kernel, thread(kind)<<32|thread(prog.Start))
+		}
+		s.start = s.state(kernel)
+	}
+
+	if len(s.ends) != len(d.progs) {
+		s.ends = make([]int, len(d.progs))
+		for i := range s.ends {
+			s.ends[i] = -1
+		}
+	}
+	s.matched = s.matched[:0]
+	state, prev := s.start, rune(-1)
+	for i := 0; state != s.dead; {
+		r, size := rune(-1), 0
+		if i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+		}
+		c := state.closure(d, syntax.EmptyOpContext(prev, r)&d.empty)
+		for _, kind := range c.matches {
+			if s.ends[kind] < 0 {
+				s.matched = append(s.matched, kind)
+			}
+			s.ends[kind] = i
+		}
+		if r < 0 {
+			break
+		}
+		state = c.step(d, s, r)
+		prev = r
+		i += size
+	}
+
+	s.kinds = s.kinds[:0]
+	for _, kind := range s.matched {
+		s.kinds = append(s.kinds, kindMatch{kind: kind, end: s.ends[kind]})
+		s.ends[kind] = -1
+	}
+	return s.kinds
+}
+
+// state returns the state for the given kernel, making it if need be. Threads
+// that are in the kernel already are dropped, as they matter only the first
+// time.
+func (s *dfaStates) state(kernel []thread) *dfaState {
+	if len(kernel) == 0 {
+		return s.dead
+	}
+	key := make([]byte, 0, 8*len(kernel))
+	var buf [8]byte
+	n := 0
+	for _, t := range kernel {
+		if containsThread(kernel[:n], t) {
+			continue
+		}
+		kernel[n] = t
+		n++
+		binary.LittleEndian.PutUint64(buf[:], uint64(t))
+		key = append(key, buf[:]...)
+	}
+	if state, has := s.states[string(key)]; has {
+		return state
+	}
+	state := &dfaState{kernel: kernel[:n]}
+	s.states[string(key)] = state
+	return state
+}
+
+func containsThread(threads []thread, t thread) bool {
+	for _, u := range threads {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dfaState) closure(d *dfa, ctx syntax.EmptyOp) *dfaClosure {
+	for _, c := range s.closures {
+		if c.ctx == ctx {
+			return c
+		}
+	}
+	c := &dfaClosure{ctx: ctx}
+	seen := map[thread]bool{}
+	// cut is the kind that has matched. Its threads that come after the one
+	// that matched are dropped, as the regexp prefers that match to theirs.
+	cut := -1
+	var visit func(t thread)
+	visit = func(t thread) {
+		if seen[t] || t.kind() == cut {
+			return
+		}
+		seen[t] = true
+		inst := &d.progs[t.kind()].Inst[uint32(t)]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			visit(t.goTo(inst.Out))
+			visit(t.goTo(inst.Arg))
+		case syntax.InstCapture, syntax.InstNop:
+			visit(t.goTo(inst.Out))
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(inst.Arg)&^ctx == 0 {
+				visit(t.goTo(inst.Out))
+			}
+		case syntax.InstMatch:
+			c.matches = append(c.matches, t.kind())
+			cut = t.kind()
+		case syntax.InstFail:
+		default:
+			c.steps = append(c.steps, t)
+		}
+	}
+	for _, t := range s.kernel {
+		visit(t)
+	}
+	s.closures = append(s.closures, c)
+	return c
+}
+
+func (c *dfaClosure) step(d *dfa, states *dfaStates, r rune) *dfaState {
+	if r < utf8.RuneSelf {
+		if s := c.ascii[r]; s != nil {
+			return s
+		}
+	} else if s, has := c.next[r]; has {
+		return s
+	}
+	var kernel []thread
+	for _, t := range c.steps {
+		if inst := &d.progs[t.kind()].Inst[uint32(t)]; matchRune(inst, r) {
+			kernel = append(kernel, t.goTo(inst.Out))
+		}
+	}
+	s := states.state(kernel)
+	if r < utf8.RuneSelf {
+		c.ascii[r] = s
+	} else {
+		if c.next == nil {
+			c.next = map[rune]*dfaState{}
+		}
+		c.next[r] = s
+	}
+	return s
+}
+
+func matchRune(inst *syntax.Inst, r rune) bool {
+	switch inst.Op {
+	case syntax.InstRuneAny:
+		return true
+	case syntax.InstRuneAnyNotNL:
+		return r != '\n'
+	default:
+		return inst.MatchRune(r)
+	}
+}
@@ -0,0 +1,57 @@
+package parser
+
+type lexicalParser struct {
+	rule Rule
+	t    Lexical
+	p    Parser
+	// pre and post eat the text .wrapRE wraps around tokens, if any.
+	pre, post *wrapper
+	skip      *skipper
+}
+
+func (p *lexicalParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	if scope.Has(lexicalKey) {
+		return p.parse(scope, input, output)
+	}
+	leading, err := p.skip.skip(scope, input)
+	if err != nil {
+		return err
+	}
+	match := *input
+	p.pre.eat(input)
+	var token TreeElement
+	if err := p.parse(scope.withLexical(), input, &token); err != nil {
+		return err
+	}
+	p.post.eat(input)
+	match = *match.Slice(0, input.offset-match.offset)
+	trailing, err := p.skip.skip(scope, input)
+	if err != nil {
+		return err
+	}
+	*output = tokenWithTrivia(scope, token.(Scanner), match, leading, trailing)
+	return nil
+}
+
+// parse parses the term, and outputs the text it matched.
+func (p *lexicalParser) parse(scope Scope, input *Scanner, output *TreeElement) error {
+	start := *input
+	var v TreeElement
+	if err := p.p.Parse(scope, input, &v); err != nil {
+		return err
+	}
+	*output = *start.Slice(0, input.offset-start.offset)
+	return nil
+}
+
+func (p *lexicalParser) AsTerm() Term { return p.t }
+
+func (t Lexical) Parser(rule Rule, c cache) Parser {
+	p := &lexicalParser{rule: rule, t: t, p: t.Term.Parser(rule, c), skip: c.skip}
+	c.registerRule(&p.p)
+	if c.tokens != nil {
+		p.pre, p.post = c.tokens.pre, c.tokens.post
+	}
+	return p
+}
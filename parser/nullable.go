@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Nullability records which rules of a grammar can match without consuming
+// any input. Rules not found in g are looked up in parent, which is how the
+// grammars of ScopedGrammars see the rules around them.
+type Nullability struct {
+	g      Grammar
+	rules  map[Rule]bool
+	parent *Nullability
+}
+
+// NewNullability works out which rules of g can match nothing, looking up
+// rules that g doesn't define in parent, which may be nil.
+func NewNullability(g Grammar, parent *Nullability) *Nullability {
+	n := &Nullability{g: g.ResolveStacks(), rules: map[Rule]bool{}, parent: parent}
+	// Least fixed point: start with nothing nullable and iterate until no
+	// more rules are found to be.
+	for changed := true; changed; {
+		changed = false
+		for rule, term := range n.g {
+			if !n.rules[rule] && n.Term(term) {
+				n.rules[rule] = true
+				changed = true
+			}
+		}
+	}
+	return n
+}
+
+// Rule returns true if rule can match without consuming any input. Rules that
+// aren't defined can't.
+func (n *Nullability) Rule(rule Rule) bool {
+	for ; n != nil; n = n.parent {
+		if _, has := n.g[rule]; has {
+			return n.rules[rule]
+		}
+	}
+	return false
+}
+
+// Term returns true if term can match without consuming any input.
+func (n *Nullability) Term(term Term) bool {
+	switch t := term.(type) {
+	case S:
+		return t == ""
+	case CaselessS:
+		return t == ""
+	case RE:
+		re, err := regexp.Compile(`\A(?:` + string(t) + `)`)
+		return err == nil && re.MatchString("")
+	case Rule:
+		return n.Rule(t)
+	case Seq:
+		return n.all(t)
+	case Perm:
+		return n.all(t)
+	case Oneof:
+		return n.any(t)
+	case Longest:
+		return n.any(t)
+	case Delim:
+		return n.Term(t.Term)
+	case Quant:
+		return t.Min == 0 || n.Term(t.Term)
+	case Named:
+		return n.Term(t.Term)
+	case CutPoint:
+		return n.Term(t.Term)
+	case Lexical:
+		return n.Term(t.Term)
+	case LookAhead:
+		return true
+	case Exclude:
+		return n.Term(t.Term)
+	case REF:
+		return t.Default != nil && n.Term(t.Default)
+	case ScopedGrammar:
+		return NewNullability(t.Grammar, n).Term(t.Term)
+	case Parametric:
+		return n.Term(t.Term)
+	case Call:
+		return n.Rule(t.Rule)
+	case ExtPred:
+		return n.Term(t.Term)
+	case Bytes:
+		return true
+	case Offside:
+		return true
+	}
+	return false
+}
+
+func (n *Nullability) all(terms []Term) bool {
+	for _, t := range terms {
+		if !n.Term(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Nullability) any(terms []Term) bool {
+	for _, t := range terms {
+		if n.Term(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NullableRules returns the rules of g that can match without consuming any
+// input.
+func (g Grammar) NullableRules() []Rule {
+	n := NewNullability(g, nil)
+	rules := make([]Rule, 0, len(n.rules))
+	for rule := range n.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i] < rules[j] })
+	return rules
+}
+
+// NullableLoops returns, for each rule in g, the unbounded repetitions in its
+// term that repeat something which can match without consuming any input.
+// Such loops would never end if the parser didn't stop them. Rules of nested
+// ScopedGrammars are reported under their own names.
+func (g Grammar) NullableLoops() map[Rule][]Term {
+	loops := map[Rule][]Term{}
+	NewNullability(g, nil).loops(loops)
+	return loops
+}
+
+func (n *Nullability) loops(out map[Rule][]Term) {
+	for rule, term := range n.g {
+		n.findLoops(rule, term, out)
+	}
+}
+
+func (n *Nullability) findLoops(rule Rule, term Term, out map[Rule][]Term) {
+	switch t := term.(type) {
+	case Seq:
+		for _, t := range t {
+			n.findLoops(rule, t, out)
+		}
+	case Perm:
+		for _, t := range t {
+			n.findLoops(rule, t, out)
+		}
+	case Oneof:
+		for _, t := range t {
+			n.findLoops(rule, t, out)
+		}
+	case Longest:
+		for _, t := range t {
+			n.findLoops(rule, t, out)
+		}
+	case Delim:
+		if n.Term(t.Term) && n.Term(t.Sep) {
+			out[rule] = append(out[rule], t)
+		}
+		n.findLoops(rule, t.Term, out)
+		n.findLoops(rule, t.Sep, out)
+	case Quant:
+		if t.Max == 0 && t.MaxRef == "" && n.Term(t.Term) {
+			out[rule] = append(out[rule], t)
+		}
+		n.findLoops(rule, t.Term, out)
+	case Named:
+		n.findLoops(rule, t.Term, out)
+	case CutPoint:
+		n.findLoops(rule, t.Term, out)
+	case Lexical:
+		n.findLoops(rule, t.Term, out)
+	case LookAhead:
+		n.findLoops(rule, t.Term, out)
+	case Exclude:
+		n.findLoops(rule, t.Term, out)
+		n.findLoops(rule, t.Except, out)
+	case Parametric:
+		n.findLoops(rule, t.Term, out)
+	case Call:
+		for _, t := range t.Args {
+			n.findLoops(rule, t, out)
+		}
+	case ExtPred:
+		n.findLoops(rule, t.Term, out)
+	case ScopedGrammar:
+		inner := NewNullability(t.Grammar, n)
+		inner.loops(out)
+		inner.findLoops(rule, t.Term, out)
+	}
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNullableRules(t *testing.T) {
+	g := Grammar{
+		"a": S("a"),
+		"b": Opt(S("b")),
+		"c": Seq{Rule("b"), Any(Rule("a"))},
+		"d": Oneof{Rule("a"), Rule("c")},
+		"e": Seq{Rule("d"), Rule("a")},
+		"f": RE(`\d*`),
+		"g": LookAhead{Term: Rule("a")},
+		"h": ScopedGrammar{Term: Rule("x"), Grammar: Grammar{"x": Rule("b")}},
+		"i": Stack{Rule("a"), Oneof{Seq{S("("), At, S(")")}, Rule("f")}},
+	}
+	assert.Equal(t, []Rule{"b", "c", "d", "f", "g", "h", "i@1"}, g.NullableRules())
+}
+
+func TestNullableLoops(t *testing.T) {
+	g := Grammar{
+		"a": Any(Opt(S("a"))),
+		"b": Some(Rule("n")),
+		"c": Any(S("c")),
+		"d": Delim{Term: Rule("n"), Sep: Opt(S(","))},
+		"e": Delim{Term: Rule("n"), Sep: S(",")},
+		"f": Quant{Term: Rule("n"), Max: 3},
+		"g": ScopedGrammar{Term: S("g"), Grammar: Grammar{"x": Any(Rule("n"))}},
+		"n": Opt(S("n")),
+	}
+	assert.Equal(t, map[Rule][]Term{
+		"a": {Any(Opt(S("a")))},
+		"b": {Some(Rule("n"))},
+		"d": {Delim{Term: Rule("n"), Sep: Opt(S(","))}},
+		"x": {Any(Rule("n"))},
+	}, g.NullableLoops())
+}
+
+func TestNullableLoopTerminates(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		term  Term
+		input string
+	}{
+		{name: "any", term: Any(Opt(S("a"))), input: "aaa"},
+		{name: "min", term: Quant{Term: Opt(S("a")), Min: 3}, input: "a"},
+		{name: "delim", term: Delim{Term: Opt(S("a")), Sep: Opt(S(","))}, input: "a,,a"},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := Grammar{"a": Seq{test.term, S("!")}}.Compile(nil)
+			_, err := p.Parse("a", NewScanner(test.input+"!"))
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// OffsideKind says which layout token an Offside term matches.
+type OffsideKind int
+
+const (
+	// Newline matches the end of a line, along with the indentation of the
+	// next line if it is at the current level. It doesn't match if the next
+	// line is indented further.
+	Newline OffsideKind = iota
+	// Indent matches the end of a line and the indentation of the next,
+	// which must be deeper than the current level. It becomes the current
+	// level for the rest of the sequence it appears in.
+	Indent
+	// Dedent matches, without consuming the indentation, where the next line
+	// returns to an enclosing level. It consumes the end of the current line
+	// if that hasn't been matched yet.
+	Dedent
+)
+
+func (k OffsideKind) String() string {
+	switch k {
+	case Indent:
+		return "indent"
+	case Dedent:
+		return "dedent"
+	}
+	return "newline"
+}
+
+// indentLevels is the stack of indentations of the blocks enclosing a scope.
+// The nil stack is the outermost level, which has no indentation.
+type indentLevels struct {
+	indent string
+	outer  *indentLevels
+}
+
+func (l *indentLevels) current() string {
+	if l == nil {
+		return ""
+	}
+	return l.indent
+}
+
+// encloses returns true if indent is the level of a block enclosing l.
+func (l *indentLevels) encloses(indent string) bool {
+	if l == nil {
+		return false
+	}
+	for l = l.outer; l != nil; l = l.outer {
+		if l.indent == indent {
+			return true
+		}
+	}
+	return indent == ""
+}
+
+const indentLevelsKey = ".IndentLevels-key."
+
+func (s Scope) withIndent(indent string) Scope {
+	return s.With(indentLevelsKey, &indentLevels{indent: indent, outer: s.indentLevels()})
+}
+
+func (s Scope) indentLevels() *indentLevels {
+	l, _ := s.m.GetElse(indentLevelsKey, (*indentLevels)(nil)).(*indentLevels)
+	return l
+}
+
+// indentOf returns the indentation matched by an Indent term.
+func indentOf(e TreeElement) string {
+	s := textFromRefVal(e)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// isIndent returns true if term is an Indent, which changes the level of the
+// terms after it in a sequence.
+func isIndent(term Term) bool {
+	switch t := term.(type) {
+	case Offside:
+		return t.Kind == Indent
+	case Named:
+		return isIndent(t.Term)
+	case CutPoint:
+		return isIndent(t.Term)
+	}
+	return false
+}
+
+// MisplacedIndents returns, for each rule in g, the Indent terms that aren't
+// followed by more terms of the sequence they appear in. An Indent only sets
+// the level for the rest of its sequence, so anywhere else, such as alone in a
+// rule, quant or alternative, the level it matches would be ignored. Rules of
+// nested ScopedGrammars are reported under their own names.
+func (g Grammar) MisplacedIndents() map[Rule][]Term {
+	out := map[Rule][]Term{}
+	for rule, term := range g {
+		findIndents(rule, term, false, out)
+	}
+	return out
+}
+
+// findIndents adds the Indent terms within term to out, unless placed is true,
+// meaning term is followed by more terms of a sequence.
+func findIndents(rule Rule, term Term, placed bool, out map[Rule][]Term) {
+	var children []Term
+	switch t := term.(type) {
+	case Offside:
+		if t.Kind == Indent && !placed {
+			out[rule] = append(out[rule], t)
+		}
+		return
+	case Seq:
+		for i, u := range t {
+			findIndents(rule, u, i < len(t)-1, out)
+		}
+		return
+	case Named:
+		findIndents(rule, t.Term, placed, out)
+		return
+	case CutPoint:
+		findIndents(rule, t.Term, placed, out)
+		return
+	case Stack:
+		children = t
+	case Perm:
+		children = t
+	case Oneof:
+		children = t
+	case Longest:
+		children = t
+	case Delim:
+		children = []Term{t.Term, t.Sep}
+	case Quant:
+		children = []Term{t.Term}
+	case Lexical:
+		children = []Term{t.Term}
+	case LookAhead:
+		children = []Term{t.Term}
+	case Exclude:
+		children = []Term{t.Term, t.Except}
+	case REF:
+		if t.Default != nil {
+			children = []Term{t.Default}
+		}
+	case Parametric:
+		children = []Term{t.Term}
+	case Call:
+		children = t.Args
+	case ExtPred:
+		children = []Term{t.Term}
+	case ScopedGrammar:
+		for rule, term := range t.Grammar {
+			findIndents(rule, term, false, out)
+		}
+		children = []Term{t.Term}
+	}
+	for _, t := range children {
+		findIndents(rule, t, false, out)
+	}
+}
+
+type offsideParser struct {
+	rule Rule
+	t    Offside
+	// lineEnd matches the rest of a line that holds no more tokens, with its
+	// line break, if any.
+	lineEnd *regexp.Regexp
+}
+
+// nextLine returns the length of the line end at the start of input, plus any
+// blank lines after it, and the indentation of the line that follows. ok is
+// false if input isn't at the end of a line.
+func (p *offsideParser) nextLine(input string) (n int, indent string, ok bool) {
+	for {
+		loc := p.lineEnd.FindStringIndex(input[n:])
+		if loc == nil {
+			break
+		}
+		ok = true
+		n += loc[1]
+		if n == len(input) || loc[1] == 0 {
+			return n, "", ok
+		}
+	}
+	if !ok {
+		return 0, "", false
+	}
+	rest := input[n:]
+	return n, rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))], true
+}
+
+func atLineStart(input *Scanner) bool {
+	if input.offset == 0 {
+		return true
+	}
+	return input.offset <= len(input.src) && input.src[input.offset-1] == '\n'
+}
+
+func (p *offsideParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	levels := scope.indentLevels()
+	level := levels.current()
+
+	n, indent, ok := 0, "", false
+	if p.t.Kind == Dedent && atLineStart(input) {
+		text := input.String()
+		indent, ok = text[:len(text)-len(strings.TrimLeft(text, " \t"))], true
+	} else {
+		n, indent, ok = p.nextLine(input.String())
+	}
+	if !ok {
+		return newParseError(p.rule, "expected end of line", scope.GetCutPoint(),
+			fmt.Errorf("actual: %s", getErrorStrings(input)), scope.GetCallStack())
+	}
+
+	deeper := len(indent) > len(level) && strings.HasPrefix(indent, level)
+	outer := levels.encloses(indent)
+	if indent != level && !deeper && !outer {
+		msg := "inconsistent indentation"
+		if strings.HasPrefix(level, indent) {
+			msg = "unindent does not match any outer indentation level"
+		}
+		return newParseError(p.rule, msg, cutpointdata(1),
+			fmt.Errorf("at: %s", input.Skip(n).Position()), scope.GetCallStack())
+	}
+
+	switch p.t.Kind {
+	case Newline:
+		switch {
+		case indent == level:
+			n += len(indent)
+		case deeper:
+			return newParseError(p.rule, "unexpected indent", scope.GetCutPoint(),
+				fmt.Errorf("at: %s", input.Skip(n).Position()), scope.GetCallStack())
+		}
+	case Indent:
+		if !deeper {
+			return newParseError(p.rule, "expected indent", scope.GetCutPoint(),
+				fmt.Errorf("at: %s", input.Skip(n).Position()), scope.GetCallStack())
+		}
+		n += len(indent)
+	case Dedent:
+		if !outer {
+			return newParseError(p.rule, "expected dedent", scope.GetCutPoint(),
+				fmt.Errorf("at: %s", input.Skip(n).Position()), scope.GetCallStack())
+		}
+		if levels.outer.current() == indent {
+			// This is the last block to end here, so the line carries on at
+			// the enclosing level.
+			n += len(indent)
+		}
+	}
+	var eaten Scanner
+	input.Eat(n, &eaten)
+	*output = eaten
+	return nil
+}
+
+func (p *offsideParser) AsTerm() Term { return p.t }
+
+func (t Offside) Parser(rule Rule, c cache) Parser {
+	comment := ""
+	if t.Comment != "" {
+		comment = `(?:` + string(t.Comment) + `)?`
+	}
+	return &offsideParser{
+		rule:    ruleOrAlt(rule, Rule(t.String())),
+		t:       t,
+		lineEnd: regexp.MustCompile(`\A[ \t]*` + comment + `(?:\r?\n|\z)`),
+	}
+}
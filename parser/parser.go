@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/arr-ai/wbnf/errors"
@@ -17,6 +18,7 @@ const (
 	oneofTag = "|"
 	delimTag = ":"
 	quantTag = "?"
+	permTag  = "&"
 	WrapRE   = Rule(".wrapRE")
 )
 
@@ -24,6 +26,11 @@ type cache struct {
 	parsers    map[Rule]Parser
 	grammar    Grammar
 	rulePtrses map[Rule][]*Parser
+	skip       *skipper
+	dfa        *dfa
+	tokens     *tokenizer
+	first      *firstSets
+	mode       mode
 }
 
 func (c cache) registerRule(parser *Parser) {
@@ -92,9 +99,10 @@ func (g Grammar) resolveStacks() {
 	}
 }
 
-// Compile prepares a grammar for parsing. The parser holds a copy of the
-// grammar modified to support parser execution.
-func (g Grammar) Compile(node interface{}) Parsers {
+// ResolveStacks returns g with every Stack rule split into one rule per layer
+// (rule, rule@1, rule@2, ...). If g has no stacks, it is returned unchanged,
+// otherwise a modified copy is returned.
+func (g Grammar) ResolveStacks() Grammar {
 	for _, term := range g {
 		if _, ok := term.(Stack); ok {
 			g = g.clone()
@@ -102,12 +110,36 @@ func (g Grammar) Compile(node interface{}) Parsers {
 			break
 		}
 	}
+	return g
+}
+
+// Compile prepares a grammar for parsing. The parser holds a copy of the
+// grammar modified to support parser execution.
+func (g Grammar) Compile(node interface{}) Parsers {
+	g = g.ResolveStacks()
+	return Parsers{
+		parsers:  g.compile(mode{}).parsers,
+		grammar:  g,
+		node:     node,
+		variants: &variants{},
+	}
+}
 
+// compile builds the parsers of g, whose stacks have been resolved, for the
+// given mode.
+func (g Grammar) compile(m mode) compiled {
 	c := cache{
 		parsers:    map[Rule]Parser{},
 		grammar:    g,
 		rulePtrses: map[Rule][]*Parser{},
+		skip:       newSkipper(g),
+		first:      newFirstSets(g, nil),
+		mode:       m,
 	}
+	if m.lexer {
+		c.dfa = newDFA()
+	}
+	c.tokens = newTokenizer(g, c.skip, c.dfa)
 	for rule, term := range g {
 		for {
 			switch r := term.(type) {
@@ -117,7 +149,7 @@ func (g Grammar) Compile(node interface{}) Parsers {
 			}
 			break
 		}
-		c.parsers[rule] = term.Parser(rule, c)
+		c.parsers[rule] = c.ruleParser(rule, term)
 	}
 
 	for rule, rulePtrs := range c.rulePtrses {
@@ -126,12 +158,20 @@ func (g Grammar) Compile(node interface{}) Parsers {
 			*rulePtr = p
 		}
 	}
+	if c.skip != nil {
+		c.skip.p = c.parsers[Skip]
+	}
+	return compiled{parsers: c.parsers, tokens: c.tokens}
+}
 
-	return Parsers{
-		parsers: c.parsers,
-		grammar: g,
-		node:    node,
+// ruleParser returns the parser of a rule, which applies the rule's Action in
+// the actions mode.
+func (c cache) ruleParser(rule Rule, term Term) Parser {
+	p := term.Parser(rule, c)
+	if c.mode.actions {
+		p = &actionParser{rule: rule, p: p}
 	}
+	return p
 }
 
 //-----------------------------------------------------------------------------
@@ -178,6 +218,28 @@ func (t Rule) Parser(rule Rule, c cache) Parser {
 	}
 }
 
+// actionParser parses a rule, then reduces its match with the rule's Action,
+// if there is one.
+type actionParser struct {
+	rule Rule
+	p    Parser
+}
+
+func (p *actionParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
+	if err := p.p.Parse(scope, input, output); err != nil {
+		return err
+	}
+	if action := scope.GetAction(p.rule); action != nil {
+		v, err := action(*output, Values(*output))
+		if err != nil {
+			return newParseError(p.rule, "action failed", cutpointdata(1), err, scope.GetCallStack())
+		}
+		*output = Value{V: v}
+	}
+	return nil
+}
+func (p *actionParser) AsTerm() Term { return p.p.AsTerm() }
+
 //-----------------------------------------------------------------------------
 
 func getErrorStrings(input *Scanner) string {
@@ -198,6 +260,74 @@ func eatRegexp(input *Scanner, re *regexp.Regexp, output *TreeElement) bool {
 	return false
 }
 
+// tokenMatcher matches a terminal, along with any text skipped around it.
+type tokenMatcher struct {
+	// re matches the terminal, wrapped by .wrapRE.
+	re *regexp.Regexp
+	// bare matches the terminal alone, within lexical rules.
+	bare *regexp.Regexp
+	skip *skipper
+	// tokens lexes the terminal, as the given kind, in lexer mode. It is nil
+	// outside lexer mode, or if .wrapRE doesn't wrap the terminal like the
+	// grammar's other terminals.
+	tokens *tokenizer
+	kind   int
+}
+
+func newTokenMatcher(re string, prepare func(string) string, c cache) tokenMatcher {
+	wrapped := applyWrapRE(re, prepare, c)
+	m := tokenMatcher{
+		re:   regexp.MustCompile(`(?m)\A` + wrapped),
+		skip: c.skip,
+	}
+	m.bare = m.re
+	if bare := `(?m)\A` + prepare(re); bare != m.re.String() {
+		m.bare = regexp.MustCompile(bare)
+	}
+	if _, has := c.grammar[WrapRE]; c.dfa != nil && c.tokens != nil && (!has || wrapped != prepare(re)) {
+		m.tokens = c.tokens
+		m.kind = c.dfa.add(m.bare)
+	}
+	return m
+}
+
+// eat eats a match of the terminal, along with any text skipped before and
+// after it. If trivia is being kept, the skipped text is attached to the token.
+func (m tokenMatcher) eat(scope Scope, input *Scanner, output *TreeElement) (bool, error) {
+	if m.tokens != nil {
+		if table := scope.tokenTable(); table != nil {
+			return m.lex(scope, table, input, output)
+		}
+	}
+	re := m.re
+	if scope.Has(lexicalKey) {
+		re = m.bare
+	}
+	leading, err := m.skip.skip(scope, input)
+	if err != nil {
+		return false, err
+	}
+	var match Scanner
+	var eaten [2]Scanner
+	n, ok := input.EatRegexp(re, &match, eaten[:])
+	if !ok {
+		return false, nil
+	}
+	token := eaten[n-1]
+	trailing, err := m.skip.skip(scope, input)
+	if err != nil {
+		return false, err
+	}
+	*output = tokenWithTrivia(scope, token, match, leading, trailing)
+	return true, nil
+}
+
+// prepareS, prepareCaselessS and prepareRE turn a terminal into a regexp
+// that captures its match.
+func prepareS(s string) string         { return "(" + regexp.QuoteMeta(s) + ")" }
+func prepareCaselessS(s string) string { return "((?i:" + regexp.QuoteMeta(s) + "))" }
+func prepareRE(re string) string       { return "(" + re + ")" }
+
 func applyWrapRE(re string, prepare func(string) string, c cache) string {
 	pre := prepare(re)
 	if wrap, has := c.grammar[WrapRE]; has {
@@ -212,6 +342,10 @@ func applyWrapRE(re string, prepare func(string) string, c cache) string {
 					if string(t) == re {
 						return pre
 					}
+				case CaselessS:
+					if string(t) == re {
+						return pre
+					}
 				}
 			}
 			wrap = oneof[len(oneof)-1]
@@ -224,14 +358,16 @@ func applyWrapRE(re string, prepare func(string) string, c cache) string {
 type sParser struct {
 	rule Rule
 	t    S
-	re   *regexp.Regexp
+	tokenMatcher
 }
 
 func (p *sParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
 	if escaped, err := parseEscape(p, scope.PushCall(string(p.rule), p.t), input, output); escaped || err != nil {
 		return err
 	}
-	if ok := eatRegexp(input, p.re, output); !ok {
+	if ok, err := p.eat(scope, input, output); err != nil {
+		return err
+	} else if !ok {
 		return newParseError(p.rule, "", scope.GetCutPoint(),
 			fmt.Errorf("expect: %s", NewScanner(p.t.String()).Context()),
 			fmt.Errorf("actual: %s", getErrorStrings(input)), scope.GetCallStack())
@@ -241,25 +377,55 @@ func (p *sParser) Parse(scope Scope, input *Scanner, output *TreeElement) error
 func (p *sParser) AsTerm() Term { return p.t }
 
 func (t S) Parser(rule Rule, c cache) Parser {
-	re := applyWrapRE(string(t), func(re string) string { return "(" + regexp.QuoteMeta(re) + ")" }, c)
 	return &sParser{
-		rule: rule,
-		t:    t,
-		re:   regexp.MustCompile(`(?m)\A` + re),
+		rule:         rule,
+		t:            t,
+		tokenMatcher: newTokenMatcher(string(t), prepareS, c),
+	}
+}
+
+type caselessSParser struct {
+	rule Rule
+	t    CaselessS
+	tokenMatcher
+}
+
+func (p *caselessSParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
+	if escaped, err := parseEscape(p, scope.PushCall(string(p.rule), p.t), input, output); escaped || err != nil {
+		return err
+	}
+	if ok, err := p.eat(scope, input, output); err != nil {
+		return err
+	} else if !ok {
+		return newParseError(p.rule, "", scope.GetCutPoint(),
+			fmt.Errorf("expect: %s", NewScanner(p.t.String()).Context()),
+			fmt.Errorf("actual: %s", getErrorStrings(input)), scope.GetCallStack())
+	}
+	return nil
+}
+func (p *caselessSParser) AsTerm() Term { return p.t }
+
+func (t CaselessS) Parser(rule Rule, c cache) Parser {
+	return &caselessSParser{
+		rule:         rule,
+		t:            t,
+		tokenMatcher: newTokenMatcher(string(t), prepareCaselessS, c),
 	}
 }
 
 type reParser struct {
 	rule Rule
 	t    RE
-	re   *regexp.Regexp
+	tokenMatcher
 }
 
 func (p *reParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
 	if escaped, err := parseEscape(p, scope.PushCall(string(p.rule), p.t), input, output); escaped || err != nil {
 		return err
 	}
-	if ok := eatRegexp(input, p.re, output); !ok {
+	if ok, err := p.eat(scope, input, output); err != nil {
+		return err
+	} else if !ok {
 		return newParseError(p.rule, "", scope.GetCutPoint(),
 			fmt.Errorf("expect: %s", NewScanner(p.re.String()).Context()),
 			fmt.Errorf("actual: %s", getErrorStrings(input)), scope.GetCallStack())
@@ -269,11 +435,10 @@ func (p *reParser) Parse(scope Scope, input *Scanner, output *TreeElement) error
 func (p *reParser) AsTerm() Term { return p.t }
 
 func (t RE) Parser(rule Rule, c cache) Parser {
-	re := applyWrapRE(string(t), func(re string) string { return "(" + re + ")" }, c)
 	return &reParser{
-		rule: rule,
-		t:    t,
-		re:   regexp.MustCompile(`(?m)\A` + re),
+		rule:         rule,
+		t:            t,
+		tokenMatcher: newTokenMatcher(string(t), prepareRE, c),
 	}
 }
 
@@ -348,6 +513,9 @@ func (p *seqParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out
 			scope, _, _ = scope.ReplaceCutPoint(true)
 		}
 		scope = scope.WithVal(ident, p.parsers[i], v)
+		if isIndent(p.t[i]) {
+			scope = scope.withIndent(indentOf(v))
+		}
 		furthest = *input
 		result = append(result, v)
 	}
@@ -512,14 +680,26 @@ func (p *quantParser) Parse(scope Scope, input *Scanner, output *TreeElement) (o
 	if escaped, err := parseEscape(p, scope, input, output); escaped || err != nil {
 		return err
 	}
-	result := make([]TreeElement, 0, p.t.Min)
+	min, max := p.t.Min, p.t.Max
+	if p.t.MinRef != "" {
+		if min, out = countFromScope(scope, p.rule, p.t.MinRef); out != nil {
+			return out
+		}
+	}
+	if p.t.MaxRef != "" {
+		if max, out = countFromScope(scope, p.rule, p.t.MaxRef); out != nil {
+			return out
+		}
+	}
+	unbounded := p.t.Max == 0 && p.t.MaxRef == ""
+	result := make([]TreeElement, 0, min)
 	var v TreeElement
 	start := *input
 
 	scope = scope.PushCall(string(p.rule), p.AsTerm())
 
 	scope, prevcp, mycp := scope.ReplaceCutPoint(false)
-	for p.t.Max == 0 || len(result) < p.t.Max {
+	for unbounded || len(result) < max {
 		if out = p.term.Parse(scope, &start, &v); out != nil {
 			if isNotMyFatalError(out, mycp) {
 				return out
@@ -527,16 +707,24 @@ func (p *quantParser) Parse(scope Scope, input *Scanner, output *TreeElement) (o
 			break
 		}
 		result = append(result, v)
+		if start.Offset() == input.Offset() {
+			// Nothing was consumed, so every further iteration would match
+			// the same way. Stop rather than loop forever.
+			for len(result) < min {
+				result = append(result, v)
+			}
+			break
+		}
 		*input = start
 	}
 
-	if len(result) >= p.t.Min {
+	if len(result) >= min {
 		return p.put(output, nil, result...)
 	}
 
 	return newParseError(p.rule,
 		fmt.Sprintf("quant failed, expected: (%d, %d), have %d value(s)",
-			p.t.Min, p.t.Max, len(result)), prevcp, out, scope.GetCallStack())
+			min, max, len(result)), prevcp, out, scope.GetCallStack())
 }
 func (p *quantParser) AsTerm() Term { return p.t }
 
@@ -554,10 +742,11 @@ func (t Quant) Parser(rule Rule, c cache) Parser {
 //-----------------------------------------------------------------------------
 
 type oneofParser struct {
-	rule    Rule
-	t       Oneof
-	parsers []Parser
-	put     putter
+	rule     Rule
+	t        Oneof
+	parsers  []Parser
+	put      putter
+	dispatch *dispatch
 }
 
 func (p *oneofParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
@@ -569,22 +758,42 @@ func (p *oneofParser) Parse(scope Scope, input *Scanner, output *TreeElement) (o
 
 	scope = scope.PushCall(string(p.rule), p.AsTerm())
 	scope, prevcp, mycp := scope.ReplaceCutPoint(false)
-	var errors []error
-	for i, par := range p.parsers {
+	errors := make([]error, len(p.parsers), len(p.parsers)+1)
+	try := func(i int) (bool, error) {
 		var v TreeElement
 		start := *input
-		if err := par.Parse(scope, &start, &v); err != nil {
+		if err := p.parsers[i].Parse(scope, &start, &v); err != nil {
 			if isNotMyFatalError(err, mycp) {
-				return err
+				return false, err
 			}
-			errors = append(errors, err)
+			errors[i] = err
 
 			if furthest.Offset() < start.Offset() {
 				furthest = start
 			}
-		} else {
-			*input = start
-			return p.put(output, Choice(i), v)
+			return false, nil
+		}
+		*input = start
+		return true, p.put(output, Choice(i), v)
+	}
+	if p.dispatch != nil && scope.GetParserEscape() == nil {
+		for _, i := range p.dispatch.alternatives(input.String()) {
+			if ok, err := try(i); ok || err != nil {
+				return err
+			}
+		}
+		// Alternatives ruled out by the dispatch table can't match, so they
+		// aren't tried unless their errors are reported.
+		for i, q := range p.parsers {
+			if errors[i] == nil {
+				errors[i] = ruledOut{p: q, scope: scope, input: *input}
+			}
+		}
+	} else {
+		for i := range p.parsers {
+			if ok, err := try(i); ok || err != nil {
+				return err
+			}
 		}
 	}
 	errors = append(errors, scope.GetCallStack())
@@ -595,10 +804,11 @@ func (p *oneofParser) AsTerm() Term { return p.t }
 
 func (t Oneof) Parser(rule Rule, c cache) Parser {
 	return &oneofParser{
-		rule:    rule,
-		t:       t,
-		parsers: c.makeParsers(t),
-		put:     tag(rule, oneofTag),
+		rule:     rule,
+		t:        t,
+		parsers:  c.makeParsers(t),
+		put:      tag(rule, oneofTag),
+		dispatch: newDispatch(t, c.first),
 	}
 }
 
@@ -633,13 +843,38 @@ func termFromRefVal(from TreeElement) Term {
 	return term
 }
 
-func (t *REF) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+type refParser struct {
+	t   REF
+	def Parser
+}
+
+func (p *refParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	t := p.t
 	scope = scope.PushCall(t.Ident, t.AsTerm())
-	if escaped, err := parseEscape(t, scope, input, output); escaped || err != nil {
+	if escaped, err := parseEscape(p, scope, input, output); escaped || err != nil {
 		return err
 	}
+	if p, caller, ok := scope.GetParam(t.Ident); ok {
+		// Arguments are parsed in the scope they were passed from, but the
+		// cutpoint is where they are parsed.
+		return p.Parse(caller.With(cutpointkey, scope.GetCutPoint()), input, output)
+	}
 	var v TreeElement
 	if _, expected, ok := scope.GetVal(t.Ident); ok {
+		if len(t.Mods) > 0 {
+			// The modified term decides what matches, so there is nothing
+			// to compare the match with.
+			term, err := refTerm(textFromRefVal(expected), t.Mods)
+			if err != nil {
+				return newParseError(Rule(t.Ident), "Backref modifier failed", cutpointdata(1), err,
+					scope.GetCallStack())
+			}
+			if err := term.Parser(Rule(t.Ident), cache{}).Parse(scope, input, &v); err != nil {
+				return err
+			}
+			*output = v
+			return nil
+		}
 		term := termFromRefVal(expected)
 		parser := term.Parser(Rule(t.Ident), cache{})
 		if err := parser.Parse(scope, input, &v); err != nil {
@@ -650,8 +885,8 @@ func (t *REF) Parse(scope Scope, input *Scanner, output *TreeElement) (out error
 				fmt.Errorf("expected: %s", expected),
 				fmt.Errorf("actual: %s", v), scope.GetCallStack())
 		}
-	} else if t.Default != nil {
-		if err := t.Default.Parser(Rule(t.Ident), cache{}).Parse(scope, input, &v); err != nil {
+	} else if p.def != nil {
+		if err := p.def.Parse(scope, input, &v); err != nil {
 			return err
 		}
 	} else {
@@ -661,8 +896,17 @@ func (t *REF) Parse(scope Scope, input *Scanner, output *TreeElement) (out error
 	return nil
 }
 
+func (p *refParser) AsTerm() Term { return p.t }
+
 func (t REF) Parser(rule Rule, c cache) Parser {
-	return &t
+	p := &refParser{t: t}
+	if t.Default != nil {
+		// Like the text it stands in for, the default isn't wrapped by
+		// .wrapRE, so it is built without the grammar.
+		p.def = t.Default.Parser(Rule(t.Ident), cache{parsers: c.parsers, rulePtrses: c.rulePtrses})
+		c.registerRule(&p.def)
+	}
+	return p
 }
 func (t REF) AsTerm() Term { return t }
 
@@ -686,17 +930,163 @@ func (t ExtRef) AsTerm() Term { return t }
 
 //-----------------------------------------------------------------------------
 
-func (t ScopedGrammar) Parser(name Rule, c cache) Parser {
-	for _, term := range t.Grammar {
-		if _, ok := term.(Stack); ok {
-			t.Grammar = t.Grammar.clone()
-			t.Grammar.resolveStacks()
-			break
+// countFromScope returns the integer value of the term named ident that was
+// matched earlier in scope.
+func countFromScope(scope Scope, rule Rule, ident string) (int, error) {
+	_, v, ok := scope.GetVal(ident)
+	if !ok {
+		return 0, newParseError(rule, fmt.Sprintf("count %s not found", ident), invalidCutpoint,
+			scope.GetCallStack())
+	}
+	text := textFromRefVal(v)
+	n, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || n < 0 {
+		return 0, newParseError(rule, fmt.Sprintf("count %s is not a valid count: %q", ident, text),
+			scope.GetCutPoint(), scope.GetCallStack())
+	}
+	return n, nil
+}
+
+func textFromRefVal(from TreeElement) string {
+	switch n := from.(type) {
+	case Node:
+		var sb strings.Builder
+		for _, v := range n.Children {
+			sb.WriteString(textFromRefVal(v))
 		}
+		return sb.String()
+	case Scanner:
+		return n.String()
+	case Value:
+		return fmt.Sprint(n.V)
 	}
-	if wrap, has := c.grammar[WrapRE]; has {
-		if _, has := t.Grammar[WrapRE]; !has {
-			t.Grammar[WrapRE] = wrap
+	return ""
+}
+
+type bytesParser struct {
+	rule Rule
+	t    Bytes
+}
+
+func (p *bytesParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	if escaped, err := parseEscape(p, scope.PushCall(string(p.rule), p.t), input, output); escaped || err != nil {
+		return err
+	}
+	n, err := countFromScope(scope, p.rule, p.t.Ref)
+	if err != nil {
+		return err
+	}
+	if n > len(input.String()) {
+		return newParseError(p.rule, fmt.Sprintf("expected %d byte(s), have %d", n, len(input.String())),
+			scope.GetCutPoint(), scope.GetCallStack())
+	}
+	var eaten Scanner
+	input.Eat(n, &eaten)
+	*output = eaten
+	return nil
+}
+
+func (p *bytesParser) AsTerm() Term { return p.t }
+
+func (t Bytes) Parser(rule Rule, c cache) Parser {
+	return &bytesParser{rule: rule, t: t}
+}
+
+//-----------------------------------------------------------------------------
+
+type extPredParser struct {
+	rule Rule
+	t    ExtPred
+	term Parser
+}
+
+func (p *extPredParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	start := *input
+	var v TreeElement
+	if err := p.term.Parse(scope, input, &v); err != nil {
+		return err
+	}
+	pred := scope.GetPredicate(p.t.Ident)
+	if pred == nil {
+		return newParseError(p.rule, "Predicate handler not found", cutpointdata(1), scope.GetCallStack())
+	}
+	if !pred(scope, v, scope.GetContext()) {
+		*input = start
+		return newParseError(p.rule, fmt.Sprintf("match rejected by predicate %s", p.t.Ident),
+			scope.GetCutPoint(), scope.GetCallStack())
+	}
+	*output = v
+	return nil
+}
+
+func (p *extPredParser) AsTerm() Term { return p.t }
+
+func (t ExtPred) Parser(rule Rule, c cache) Parser {
+	p := &extPredParser{rule: rule, t: t, term: t.Term.Parser(rule, c)}
+	c.registerRule(&p.term)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+type parametricParser struct {
+	rule Rule
+	t    Parametric
+	body Parser
+}
+
+func (p *parametricParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
+	scope, call := scope.takeCallArgs()
+	if len(call.args) != len(p.t.Params) {
+		return newParseError(p.rule,
+			fmt.Sprintf("%s expects %d args, given %d", p.rule, len(p.t.Params), len(call.args)),
+			scope.GetCutPoint(), scope.GetCallStack())
+	}
+	for i, param := range p.t.Params {
+		scope = scope.WithParam(param, call.args[i], call.caller)
+	}
+	return p.body.Parse(scope, input, output)
+}
+
+func (p *parametricParser) AsTerm() Term { return p.t }
+
+func (t Parametric) Parser(rule Rule, c cache) Parser {
+	p := &parametricParser{rule: rule, t: t, body: t.Term.Parser(rule, c)}
+	c.registerRule(&p.body)
+	return p
+}
+
+type callParser struct {
+	rule   Rule
+	t      Call
+	callee Parser
+	args   []Parser
+}
+
+func (p *callParser) Parse(scope Scope, input *Scanner, output *TreeElement) error {
+	inner := scope.PushCall(string(p.t.Rule), p.t).withCallArgs(p.args, scope)
+	return p.callee.Parse(inner, input, output)
+}
+
+func (p *callParser) AsTerm() Term { return p.t }
+
+func (t Call) Parser(rule Rule, c cache) Parser {
+	p := &callParser{rule: rule, t: t, callee: t.Rule.Parser(rule, c), args: c.makeParsers(t.Args)}
+	c.registerRule(&p.callee)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+func (t ScopedGrammar) Parser(name Rule, c cache) Parser {
+	t.Grammar = t.Grammar.ResolveStacks()
+	for _, magic := range []Rule{WrapRE, Skip} {
+		if term, has := c.grammar[magic]; has {
+			if _, has := t.Grammar[magic]; !has {
+				t.Grammar[magic] = term
+			}
 		}
 	}
 
@@ -704,7 +1094,12 @@ func (t ScopedGrammar) Parser(name Rule, c cache) Parser {
 		parsers:    map[Rule]Parser{},
 		grammar:    t.Grammar,
 		rulePtrses: map[Rule][]*Parser{},
+		skip:       newSkipper(t.Grammar),
+		dfa:        c.dfa,
+		first:      newFirstSets(t.Grammar, c.first),
+		mode:       c.mode,
 	}
+	cc.tokens = newTokenizer(t.Grammar, cc.skip, cc.dfa)
 	for rule, term := range t.Grammar {
 		for {
 			switch r := term.(type) {
@@ -714,7 +1109,7 @@ func (t ScopedGrammar) Parser(name Rule, c cache) Parser {
 			}
 			break
 		}
-		cc.parsers[rule] = term.Parser(rule, cc)
+		cc.parsers[rule] = cc.ruleParser(rule, term)
 	}
 
 	// At this point we have the nested grammar cache populated with the grammar rules
@@ -736,6 +1131,9 @@ func (t ScopedGrammar) Parser(name Rule, c cache) Parser {
 			}
 		}
 	}
+	if cc.skip != nil {
+		cc.skip.p = cc.parsers[Skip]
+	}
 	return result
 }
 
@@ -749,5 +1147,273 @@ func (t *cutPointParser) Parse(scope Scope, input *Scanner, output *TreeElement)
 }
 func (t *cutPointParser) AsTerm() Term { return t.t }
 func (t CutPoint) Parser(rule Rule, c cache) Parser {
-	return &cutPointParser{t.Term.Parser(rule, c), t}
+	p := &cutPointParser{t.Term.Parser(rule, c), t}
+	c.registerRule(&p.p)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+type lookAheadParser struct {
+	rule Rule
+	t    LookAhead
+	term Parser
+}
+
+func (p *lookAheadParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	// Errors inside the predicate, fatal or not, only mean that the term
+	// didn't match. They must not escape, so the predicate's cutpoints
+	// are contained here.
+	start := *input
+	var v TreeElement
+	err := p.term.Parse(scope.PushCall(string(p.rule), p.t), &start, &v)
+	switch {
+	case err != nil && !p.t.Negative:
+		return newParseError(p.rule, "lookahead failed", scope.GetCutPoint(), err, scope.GetCallStack())
+	case err == nil && p.t.Negative:
+		return newParseError(p.rule, "negative lookahead matched", scope.GetCutPoint(),
+			fmt.Errorf("unexpected: %s", getErrorStrings(input)), scope.GetCallStack())
+	}
+	*output = Empty{}
+	return nil
+}
+func (p *lookAheadParser) AsTerm() Term { return p.t }
+
+func (t LookAhead) Parser(rule Rule, c cache) Parser {
+	p := &lookAheadParser{
+		rule: rule,
+		t:    t,
+		term: t.Term.Parser("", c),
+	}
+	c.registerRule(&p.term)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+type excludeParser struct {
+	rule   Rule
+	t      Exclude
+	term   Parser
+	except Parser
+	// excluded is Except as written, without the cutpoints put into it, for
+	// error messages.
+	excluded string
+}
+
+func (p *excludeParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	start := *input
+	if err := p.term.Parse(scope, input, output); err != nil {
+		return err
+	}
+	// The match is excluded only if Except matches exactly the same span.
+	// Like lookaheads, any error from Except just means it didn't match.
+	span := *start.Slice(0, input.Offset()-start.Offset())
+	rest := span
+	var v TreeElement
+	if err := p.except.Parse(scope.PushCall(string(p.rule), p.t), &rest, &v); err == nil && rest.String() == "" {
+		*input = start
+		return newParseError(p.rule,
+			fmt.Sprintf("%q is excluded (matches %s)", strings.TrimSpace(span.String()), p.excluded),
+			scope.GetCutPoint(), scope.GetCallStack())
+	}
+	return nil
+}
+func (p *excludeParser) AsTerm() Term { return p.t }
+
+func (t Exclude) Parser(rule Rule, c cache) Parser {
+	p := &excludeParser{
+		rule:     rule,
+		t:        t,
+		term:     t.Term.Parser(rule, c),
+		except:   t.Except.Parser("", c),
+		excluded: uncut(t.Except).String(),
+	}
+	c.registerRule(&p.term)
+	c.registerRule(&p.except)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+type permParser struct {
+	rule     Rule
+	t        Perm
+	parsers  []Parser
+	optional []bool
+	put      putter
+}
+
+func (p *permParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	if escaped, err := parseEscape(p, scope, input, output); escaped || err != nil {
+		return err
+	}
+	start := *input
+	matched := make([]TreeElement, len(p.parsers))
+	var order PermOrder
+
+	// Like a Oneof, a member failing after its cutpoint only rules that
+	// member out.
+	scope, prevcp, mycp := scope.ReplaceCutPoint(false)
+
+	// Each pass takes the first unmatched member, in grammar order, that
+	// matches at the current position.
+	for found := true; found; {
+		found = false
+		for i, item := range p.parsers {
+			if matched[i] != nil {
+				continue
+			}
+			var v TreeElement
+			next := *input
+			ident := identFromTerm(p.t[i])
+			if err := item.Parse(scope.PushCall(ident, item.AsTerm()), &next, &v); err != nil {
+				if isNotMyFatalError(err, mycp) {
+					return err
+				}
+				continue
+			}
+			scope = scope.WithVal(ident, item, v)
+			matched[i] = v
+			order = append(order, i)
+			*input = next
+			found = true
+			break
+		}
+	}
+
+	if len(order) < len(p.parsers) {
+		if j := p.repeated(scope, matched, *input); j >= 0 {
+			pos := *input
+			*input = start
+			return newParseError(p.rule, "permutation member appears more than once", prevcp,
+				fmt.Errorf("repeated: %v", p.t[j]), fmt.Errorf("actual: %s", getErrorStrings(&pos)),
+				scope.GetCallStack())
+		}
+	}
+
+	result := make([]TreeElement, 0, len(p.parsers))
+	for i, v := range matched {
+		if v == nil && !p.optional[i] {
+			pos := *input
+			*input = start
+			return newParseError(p.rule, "permutation member missing", prevcp,
+				fmt.Errorf("expect: %v", p.t[i]), fmt.Errorf("actual: %s", getErrorStrings(&pos)),
+				scope.GetCallStack())
+		}
+		if p.optional[i] {
+			// Optional members are reported the way a Quant{Max: 1} would be.
+			node := Node{Tag: quantTag}
+			if v != nil {
+				node.Children = []TreeElement{v}
+			}
+			v = node
+		}
+		result = append(result, v)
+	}
+	return p.put(output, order, result...)
+}
+func (p *permParser) AsTerm() Term { return p.t }
+
+// repeated returns the index of a member, matched already, that matches again
+// at input and is followed by a member not matched yet, or -1 if there is
+// none. A repeat followed by no more members may belong to whatever follows
+// the permutation.
+func (p *permParser) repeated(scope Scope, matched []TreeElement, input Scanner) int {
+	for j, item := range p.parsers {
+		var dup TreeElement
+		next := input
+		if matched[j] == nil || item.Parse(scope, &next, &dup) != nil || next.Offset() == input.Offset() {
+			continue
+		}
+		for k, other := range p.parsers {
+			var v TreeElement
+			after := next
+			if matched[k] == nil && other.Parse(scope, &after, &v) == nil && after.Offset() > next.Offset() {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func (t Perm) Parser(rule Rule, c cache) Parser {
+	p := &permParser{
+		rule:     rule,
+		t:        t,
+		parsers:  make([]Parser, 0, len(t)),
+		optional: make([]bool, 0, len(t)),
+		put:      tag(rule, permTag),
+	}
+	for _, term := range t {
+		optional := false
+		if q, ok := term.(Quant); ok && q.Min == 0 && q.Max == 1 {
+			term, optional = q.Term, true
+		}
+		p.parsers = append(p.parsers, term.Parser("", c))
+		p.optional = append(p.optional, optional)
+	}
+	c.registerRules(p.parsers)
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+type longestParser struct {
+	rule    Rule
+	t       Longest
+	parsers []Parser
+	put     putter
+}
+
+func (p *longestParser) Parse(scope Scope, input *Scanner, output *TreeElement) (out error) {
+	defer enterf("%s: %T %[2]v", p.rule, p.t).exitf("%v %v", &out, output)
+	if escaped, err := parseEscape(p, scope, input, output); escaped || err != nil {
+		return err
+	}
+	furthest := *input
+
+	scope = scope.PushCall(string(p.rule), p.AsTerm())
+	scope, prevcp, mycp := scope.ReplaceCutPoint(false)
+	var errors []error
+	var best TreeElement
+	var bestEnd Scanner
+	choice := -1
+	for i, par := range p.parsers {
+		var v TreeElement
+		start := *input
+		if err := par.Parse(scope, &start, &v); err != nil {
+			if isNotMyFatalError(err, mycp) {
+				return err
+			}
+			errors = append(errors, err)
+
+			if furthest.Offset() < start.Offset() {
+				furthest = start
+			}
+		} else if choice < 0 || start.Offset() > bestEnd.Offset() {
+			// Ties go to the earliest alternative, as they would in a Oneof.
+			best, bestEnd, choice = v, start, i
+		}
+	}
+	if choice >= 0 {
+		*input = bestEnd
+		return p.put(output, Choice(choice), best)
+	}
+	errors = append(errors, scope.GetCallStack())
+	*input = furthest
+	return newParseError(p.rule, "None of the available options could be satisfied", prevcp, errors...)
+}
+func (p *longestParser) AsTerm() Term { return p.t }
+
+func (t Longest) Parser(rule Rule, c cache) Parser {
+	return &longestParser{
+		rule:    rule,
+		t:       t,
+		parsers: c.makeParsers(t),
+		put:     tag(rule, oneofTag),
+	}
 }
@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // These test all verify the parser behaviour when the tested Term fails when inside a CutPoint scope
@@ -125,3 +128,136 @@ func TestParserEscaping2LevelGrammar(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected.(Node).String(), actual.(Node).String())
 }
+
+func TestScannerPosition(t *testing.T) {
+	s := NewScanner("αβ\nγδ x")
+	pos := s.Slice(len("αβ\nγδ "), len("αβ\nγδ x")).Position()
+	assert.Equal(t, Position{Offset: 10, RuneOffset: 6, Line: 2, Column: 6, RuneColumn: 4}, pos)
+	assert.Equal(t, "2:4 (byte 6)", pos.String())
+
+	line, col := s.Slice(2, 4).LineColumn()
+	assert.Equal(t, 1, line)
+	assert.Equal(t, 3, col)
+	assert.Equal(t, "1:1", s.Position().String())
+
+	_, err := Grammar{"a": S("α")}.Compile(nil).Parse("a", NewScanner("αβ"))
+	assert.EqualError(t, err, "unconsumed input at 1:2 (byte 3): β")
+}
+
+func TestParseWithActions(t *testing.T) {
+	p := Grammar{
+		"list": Delim{Term: Rule("n"), Sep: S(",")},
+		"n":    RE(`\d`),
+	}.Compile(nil)
+	actions := Actions{"n": func(match TreeElement, _ []interface{}) (interface{}, error) {
+		return int(match.(Scanner).String()[0] - '0'), nil
+	}}
+
+	// Parses without actions don't go through actionParsers.
+	assert.IsType(t, &delimParser{}, p.parsers["list"])
+
+	v, err := p.ParseWithOptions("list", NewScanner("1,2"), ParseOptions{Actions: actions})
+	require.NoError(t, err)
+	values := Values(v.(Node))
+	require.Len(t, values, 3)
+	assert.Equal(t, 1, values[0])
+	assert.Equal(t, ",", values[1].(Scanner).String())
+	assert.Equal(t, 2, values[2])
+
+	actions["list"] = func(_ TreeElement, values []interface{}) (interface{}, error) {
+		return len(values), nil
+	}
+	v, err = p.ParseWithOptions("list", NewScanner("1,2,3"), ParseOptions{Actions: actions})
+	require.NoError(t, err)
+	assert.Equal(t, Value{V: 5}, v)
+
+	actions["n"] = func(TreeElement, []interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("no")
+	}
+	_, err = p.ParseWithOptions("list", NewScanner("1"), ParseOptions{Actions: actions})
+	assert.IsType(t, FatalError{}, err)
+
+	// Actions combine with the other options.
+	delete(actions, "n")
+	v, err = p.ParseWithOptions("list", NewScanner("1,{:2:}"), ParseOptions{
+		Actions: actions,
+		Externals: ExternalRefs{"*{:():}": func(_ Scope, input *Scanner) (TreeElement, error) {
+			var eaten Scanner
+			input.Eat(1, &eaten)
+			return eaten, nil
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Value{V: 3}, v)
+}
+
+func TestActionsInBacktrackedAlternatives(t *testing.T) {
+	p := Grammar{
+		"s": Oneof{Seq{Rule("n"), S("!")}, Seq{Rule("n"), S("?")}},
+		"n": RE(`\d`),
+	}.Compile(nil)
+	var calls []string
+	actions := Actions{
+		"n": func(match TreeElement, _ []interface{}) (interface{}, error) {
+			calls = append(calls, match.(Scanner).String())
+			return int(match.(Scanner).String()[0] - '0'), nil
+		},
+		"s": func(_ TreeElement, values []interface{}) (interface{}, error) {
+			return fmt.Sprintf("%v%v", values[0], values[1]), nil
+		},
+	}
+
+	// The first alternative's action runs before its "!" fails to match. Only
+	// the second alternative's match makes it into the result.
+	v, err := p.ParseWithOptions("s", NewScanner("7?"), ParseOptions{Actions: actions})
+	require.NoError(t, err)
+	assert.Equal(t, Value{V: "7?"}, v)
+	assert.Equal(t, []string{"7", "7"}, calls)
+}
+
+func TestLexerModeCompiledOnDemand(t *testing.T) {
+	p := Grammar{
+		"list": Delim{Term: Rule("n"), Sep: S(",")},
+		"n":    RE(`\d`),
+	}.Compile(nil)
+	assert.Nil(t, p.parsers["n"].(*reParser).tokens)
+
+	expected, err := p.Parse("list", NewScanner("1,2"))
+	require.NoError(t, err)
+	assert.Empty(t, p.variants.compiled)
+
+	actual, err := p.ParseWithOptions("list", NewScanner("1,2"), ParseOptions{Lexer: true})
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	c := p.variants.compiled[mode{lexer: true}]
+	assert.NotNil(t, c.parsers["n"].(*reParser).tokens)
+	assert.Len(t, c.tokens.dfa.progs, 2)
+}
+
+func TestDFAMatch(t *testing.T) {
+	res := []*regexp.Regexp{
+		regexp.MustCompile(`(?m)\A(if)`),
+		regexp.MustCompile(`(?m)\A([a-z]+)`),
+		regexp.MustCompile(`(?m)\A(\d+\b)`),
+		regexp.MustCompile(`(?m)\A(a|ab)`),
+		regexp.MustCompile(`(?m)\A(x*$)`),
+		regexp.MustCompile(`(?m)\A([a-z]+?f*)`),
+		regexp.MustCompile(`(?m)\A((?:a|ab)(?:c|bcd)?)`),
+		regexp.MustCompile(`(?m)\A(.*?2|\w*)`),
+	}
+	d := newDFA()
+	for i, re := range res {
+		assert.Equal(t, i, d.add(re))
+	}
+	states := &dfaStates{}
+	for _, input := range []string{"iffy", "if", "12", "12a", "ab", "abcd", "xx\n", "x12", ""} {
+		l := &lexed{start: *NewScanner(input), kinds: states.match(d, input)}
+		for kind, re := range res {
+			expected := -1
+			if loc := re.FindStringIndex(input); loc != nil {
+				expected = loc[1]
+			}
+			assert.Equal(t, expected, l.length(kind), "%q %s", input, re)
+		}
+	}
+}
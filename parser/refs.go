@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The modifiers a REF may apply to the text it refers to.
+const (
+	// RefMirror reverses the text and swaps each bracket for its partner, so
+	// that "[==[" becomes "]==]".
+	RefMirror = "mirror"
+	// RefFold matches the text regardless of case.
+	RefFold = "fold"
+	// RefStrip removes Arg from the start of the text.
+	RefStrip = "strip"
+	// RefRE matches Arg as a regexp in which each $0 stands for the text.
+	RefRE = "re"
+)
+
+// RefMod modifies the text a REF refers to. Only RefStrip and RefRE take an
+// Arg, and RefFold and RefRE must come last, since they turn the text into the
+// term to match.
+type RefMod struct {
+	Name string
+	Arg  string
+}
+
+func (m RefMod) String() string {
+	if m.Arg != "" {
+		return fmt.Sprintf(".%s(%q)", m.Name, m.Arg)
+	}
+	return "." + m.Name
+}
+
+// refTerm returns the term that matches text once it has been transformed by
+// mods.
+func refTerm(text string, mods []RefMod) (Term, error) {
+	for _, mod := range mods {
+		switch mod.Name {
+		case RefMirror:
+			text = mirror(text)
+		case RefStrip:
+			text = strings.TrimPrefix(text, mod.Arg)
+		case RefFold:
+			return CaselessS(text), nil
+		case RefRE:
+			re := strings.ReplaceAll(mod.Arg, "$0", regexp.QuoteMeta(text))
+			if _, err := regexp.Compile(re); err != nil {
+				return nil, err
+			}
+			return RE(re), nil
+		default:
+			return nil, fmt.Errorf("unknown ref modifier %q", mod.Name)
+		}
+	}
+	return S(text), nil
+}
+
+var mirroredBrackets = map[rune]rune{
+	'(': ')', ')': '(',
+	'[': ']', ']': '[',
+	'{': '}', '}': '{',
+	'<': '>', '>': '<',
+}
+
+func mirror(text string) string {
+	runes := []rune(text)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	for i, r := range runes {
+		if m, has := mirroredBrackets[r]; has {
+			runes[i] = m
+		}
+	}
+	return string(runes)
+}
@@ -16,6 +16,10 @@ func (t S) Resolve(oldRule, newRule Rule) Term {
 func (t RE) Resolve(oldRule, newRule Rule) Term {
 	return t
 }
+
+func (t CaselessS) Resolve(oldRule, newRule Rule) Term {
+	return t
+}
 func (t REF) Resolve(oldRule, newRule Rule) Term {
 	return t
 }
@@ -36,6 +40,18 @@ func (t Oneof) Resolve(oldRule, newRule Rule) Term {
 	return result
 }
 
+func (t Longest) Resolve(oldRule, newRule Rule) Term {
+	return Longest(Oneof(t).Resolve(oldRule, newRule).(Oneof))
+}
+
+func (t Perm) Resolve(oldRule, newRule Rule) Term {
+	result := make(Perm, 0, len(t))
+	for _, term := range t {
+		result = append(result, term.Resolve(oldRule, newRule))
+	}
+	return result
+}
+
 func (t Stack) Resolve(oldRule, newRule Rule) Term {
 	panic(errors.Inconceivable)
 }
@@ -64,6 +80,102 @@ func (t CutPoint) Resolve(oldRule, newRule Rule) Term {
 	return t.Term.Resolve(oldRule, newRule)
 }
 
+func (t LookAhead) Resolve(oldRule, newRule Rule) Term {
+	t.Term = t.Term.Resolve(oldRule, newRule)
+	return t
+}
+
+func (t Exclude) Resolve(oldRule, newRule Rule) Term {
+	t.Term = t.Term.Resolve(oldRule, newRule)
+	t.Except = t.Except.Resolve(oldRule, newRule)
+	return t
+}
+
 func (t ExtRef) Resolve(oldRule, newRule Rule) Term {
 	return t
 }
+
+func (t Parametric) Resolve(oldRule, newRule Rule) Term {
+	t.Term = t.Term.Resolve(oldRule, newRule)
+	return t
+}
+
+func (t Call) Resolve(oldRule, newRule Rule) Term {
+	if t.Rule == oldRule {
+		t.Rule = newRule
+	}
+	args := make([]Term, 0, len(t.Args))
+	for _, term := range t.Args {
+		args = append(args, term.Resolve(oldRule, newRule))
+	}
+	t.Args = args
+	return t
+}
+
+func (t ExtPred) Resolve(oldRule, newRule Rule) Term {
+	t.Term = t.Term.Resolve(oldRule, newRule)
+	return t
+}
+
+func (t Bytes) Resolve(oldRule, newRule Rule) Term {
+	return t
+}
+
+func (t Offside) Resolve(oldRule, newRule Rule) Term {
+	return t
+}
+
+func (t Lexical) Resolve(oldRule, newRule Rule) Term {
+	t.Term = t.Term.Resolve(oldRule, newRule)
+	return t
+}
+
+// uncut returns term without the cutpoints in it.
+func uncut(term Term) Term {
+	all := func(terms []Term) []Term {
+		result := make([]Term, 0, len(terms))
+		for _, t := range terms {
+			result = append(result, uncut(t))
+		}
+		return result
+	}
+	switch t := term.(type) {
+	case CutPoint:
+		return uncut(t.Term)
+	case Seq:
+		return Seq(all(t))
+	case Oneof:
+		return Oneof(all(t))
+	case Longest:
+		return Longest(all(t))
+	case Perm:
+		return Perm(all(t))
+	case Stack:
+		return Stack(all(t))
+	case Delim:
+		t.Term, t.Sep = uncut(t.Term), uncut(t.Sep)
+		return t
+	case Quant:
+		t.Term = uncut(t.Term)
+		return t
+	case Named:
+		t.Term = uncut(t.Term)
+		return t
+	case LookAhead:
+		t.Term = uncut(t.Term)
+		return t
+	case Exclude:
+		t.Term, t.Except = uncut(t.Term), uncut(t.Except)
+		return t
+	case Lexical:
+		t.Term = uncut(t.Term)
+		return t
+	case ExtPred:
+		t.Term = uncut(t.Term)
+		return t
+	case Call:
+		t.Args = all(t.Args)
+		return t
+	}
+	return term
+}
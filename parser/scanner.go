@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 type Scanner struct {
 	src    string
 	slice  string
 	offset int
+	trivia *Trivia
 }
 
 func NewScanner(src string) *Scanner {
@@ -53,6 +55,47 @@ func (r Scanner) Offset() int {
 	return r.offset
 }
 
+// Position describes where a Scanner starts within its source. Offsets and
+// columns are given in bytes and in runes, which only differ once the source
+// contains non-ASCII text. Lines and columns are 1-based.
+type Position struct {
+	Offset, RuneOffset int
+	Line               int
+	Column, RuneColumn int
+}
+
+// String formats p as line:column, counting the column in runes. The byte
+// column is added when it differs.
+func (p Position) String() string {
+	if p.Column == p.RuneColumn {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d (byte %d)", p.Line, p.RuneColumn, p.Column)
+}
+
+// Position returns the position of the start of r within its source.
+func (r Scanner) Position() Position {
+	if r.offset > len(r.src) {
+		return Position{Offset: r.offset}
+	}
+	before := r.src[:r.offset]
+	lineStart := strings.LastIndex(before, "\n") + 1
+	return Position{
+		Offset:     r.offset,
+		RuneOffset: utf8.RuneCountInString(before),
+		Line:       strings.Count(before, "\n") + 1,
+		Column:     len(before) - lineStart + 1,
+		RuneColumn: utf8.RuneCountInString(before[lineStart:]) + 1,
+	}
+}
+
+// LineColumn returns the 1-based line and byte column of the start of r within
+// its source.
+func (r Scanner) LineColumn() (line, column int) {
+	p := r.Position()
+	return p.Line, p.Column
+}
+
 func (r Scanner) Slice(a, b int) *Scanner {
 	return &Scanner{
 		src:    r.src,
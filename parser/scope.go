@@ -50,12 +50,54 @@ func (s Scope) WithVal(ident string, p Parser, val TreeElement) Scope {
 
 func (s Scope) GetVal(ident string) (Parser, TreeElement, bool) {
 	if val, ok := s.m.Get(ident); ok {
-		sv := val.(*scopeVal)
-		return sv.p, sv.val, ok
+		if sv, ok := val.(*scopeVal); ok {
+			return sv.p, sv.val, ok
+		}
 	}
 	return nil, nil, false
 }
 
+// scopeParam binds a parameter of a Parametric rule to the parser of the
+// argument passed for it and the scope of the Call that passed it.
+type scopeParam struct {
+	p      Parser
+	caller Scope
+}
+
+func (s Scope) WithParam(ident string, p Parser, caller Scope) Scope {
+	s.m = s.m.With(ident, &scopeParam{p: p, caller: caller})
+	return s
+}
+
+func (s Scope) GetParam(ident string) (Parser, Scope, bool) {
+	if val, ok := s.m.Get(ident); ok {
+		if sp, ok := val.(*scopeParam); ok {
+			return sp.p, sp.caller, true
+		}
+	}
+	return nil, Scope{}, false
+}
+
+const callArgsKey = ".CallArgs-key."
+
+// callArgs holds the arguments of a Call until the Parametric rule it calls
+// binds them to its parameters.
+type callArgs struct {
+	args   []Parser
+	caller Scope
+}
+
+func (s Scope) withCallArgs(args []Parser, caller Scope) Scope {
+	return s.With(callArgsKey, callArgs{args: args, caller: caller})
+}
+
+// takeCallArgs returns the arguments of the Call being made, and s without
+// them, so they don't reach any rules called from the one they were for.
+func (s Scope) takeCallArgs() (Scope, callArgs) {
+	call, _ := s.m.GetElse(callArgsKey, callArgs{}).(callArgs)
+	return s.With(callArgsKey, callArgs{}), call
+}
+
 const cutpointkey = ".Cutpoint-key."
 
 type cutpointdata int32
@@ -114,6 +156,38 @@ func (s Scope) GetParserEscape() *escape {
 	return nil
 }
 
+const predicatesKey = ".Predicates-key."
+const contextKey = ".Context-key."
+
+func (s Scope) WithPredicates(preds Predicates, ctx interface{}) Scope {
+	return s.With(predicatesKey, preds).With(contextKey, ctx)
+}
+
+func (s Scope) GetPredicate(ident string) Predicate {
+	if p, has := s.m.GetElse(predicatesKey, Predicates{}).(Predicates)[ident]; has {
+		return p
+	}
+	return nil
+}
+
+// GetContext returns the context passed to Parsers.ParseWithOptions.
+func (s Scope) GetContext() interface{} {
+	return s.m.GetElse(contextKey, nil)
+}
+
+const actionsKey = ".Actions-key."
+
+func (s Scope) WithActions(actions Actions) Scope {
+	return s.With(actionsKey, actions)
+}
+
+func (s Scope) GetAction(rule Rule) Action {
+	if a, has := s.m.GetElse(actionsKey, Actions{}).(Actions)[rule]; has {
+		return a
+	}
+	return nil
+}
+
 type call struct {
 	ident string
 	term  Term
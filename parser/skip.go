@@ -0,0 +1,101 @@
+package parser
+
+// Skip is the magic rule matching the text, such as whitespace and comments,
+// that is skipped before and after each token.
+const Skip = Rule(".skip")
+
+// skipper skips the text matched by the Skip rule of a grammar. p is nil until
+// the grammar's parsers have been built.
+type skipper struct {
+	p Parser
+}
+
+func newSkipper(g Grammar) *skipper {
+	if _, has := g[Skip]; has {
+		return &skipper{}
+	}
+	return nil
+}
+
+const lexicalKey = ".Lexical-key."
+const memoKey = ".Memo-key."
+
+// memo records what a parse found at each offset, so that it is only found
+// once: what each skipper skipped, so the Skip rule is only tried once per
+// offset, and in lexer mode, the tokens lexed. The tokens are kept here rather
+// than under a key of their own, as each call copies the scope, at a cost that
+// grows with its keys.
+type memo struct {
+	skipped map[skipAt][]Scanner
+	// tokens is nil outside lexer mode, and within lexical rules.
+	tokens *tokenTable
+}
+
+type skipAt struct {
+	s      *skipper
+	offset int
+}
+
+// withMemo starts a memo for a parse, with tokens lexed into tokens in lexer
+// mode.
+func (s Scope) withMemo(tokens *tokenTable) Scope {
+	return s.With(memoKey, &memo{skipped: map[skipAt][]Scanner{}, tokens: tokens})
+}
+
+func (s Scope) memo() *memo {
+	m, _ := s.m.GetElse(memoKey, (*memo)(nil)).(*memo)
+	return m
+}
+
+// withLexical turns skipping and .wrapRE off, so that the tokens of the rule
+// being parsed must be adjacent.
+func (s Scope) withLexical() Scope {
+	s = s.With(lexicalKey, true)
+	if m := s.memo(); m != nil && m.tokens != nil {
+		// The terminals of lexical rules are matched one by one, so the one
+		// lookup of the memo in tokenMatcher.eat is all lexer mode costs.
+		s = s.With(memoKey, &memo{skipped: m.skipped})
+	}
+	return s
+}
+
+// skip advances input past as many matches of the Skip rule as it can, and
+// returns them. The Skip rule itself is parsed as a lexical rule.
+func (sk *skipper) skip(scope Scope, input *Scanner) ([]Scanner, error) {
+	if sk == nil || sk.p == nil || scope.Has(lexicalKey) {
+		return nil, nil
+	}
+	m := scope.memo()
+	at := skipAt{s: sk, offset: input.offset}
+	if m != nil {
+		if skipped, has := m.skipped[at]; has {
+			for _, s := range skipped {
+				input.Eat(len(s.String()), &Scanner{})
+			}
+			return skipped, nil
+		}
+	}
+	// Cuts within the Skip rule are its own, not those of the rule whose
+	// token is being skipped to.
+	inner := scope.withLexical().With(cutpointkey, invalidCutpoint)
+	var skipped []Scanner
+	for {
+		before := *input
+		var e TreeElement
+		if err := sk.p.Parse(inner, input, &e); err != nil {
+			*input = before
+			if isFatal(err) {
+				return nil, err
+			}
+			break
+		}
+		if input.offset == before.offset {
+			break
+		}
+		skipped = append(skipped, *before.Slice(0, input.offset-before.offset))
+	}
+	if m != nil {
+		m.skipped[at] = skipped
+	}
+	return skipped, nil
+}
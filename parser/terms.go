@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/arr-ai/wbnf/errors"
 )
@@ -25,9 +27,10 @@ func (g Grammar) Unparse(e TreeElement, w io.Writer) (n int, err error) {
 
 // Parsers holds Parsers generated by Grammar.Compile.
 type Parsers struct {
-	parsers map[Rule]Parser
-	grammar Grammar
-	node    interface{}
+	parsers  map[Rule]Parser
+	grammar  Grammar
+	node     interface{}
+	variants *variants
 }
 
 func (p Parsers) Grammar() Grammar {
@@ -49,17 +52,110 @@ func (p Parsers) Unparse(e TreeElement, w io.Writer) (n int, err error) {
 
 // Parse parses some source per a given rule.
 func (p Parsers) ParseWithExternals(rule Rule, input *Scanner, exts ExternalRefs) (TreeElement, error) {
-	scope := Scope{}.WithExternals(exts).PushCall(string(rule), rule)
+	return p.ParseWithOptions(rule, input, ParseOptions{Externals: exts})
+}
+
+// ParseOptions turns on the features of a parse that plain Parse leaves off.
+// Any of them may be combined.
+type ParseOptions struct {
+	// Externals parse the grammar's external references.
+	Externals ExternalRefs
+
+	// Predicates check the terms they are registered for. Context is passed
+	// to every predicate, which may update it.
+	Predicates Predicates
+	Context    interface{}
+
+	// Actions reduce the match of each rule they are given for. If the rule
+	// parsed has one, the result of the parse is the Value it returned.
+	Actions Actions
+
+	// Trivia keeps the text skipped around each token by .skip or .wrapRE as
+	// the token's trivia. Trivia up to the end of a token's line trails it,
+	// and the rest leads the next token, so that Unparse reproduces the
+	// source even after the tree has been modified.
+	Trivia bool
+
+	// Lexer parses in lexer mode. Rather than trying the regexps of terminals
+	// one at a time, a DFA built from all of them finds every terminal that
+	// matches at an offset in one pass, the first time the offset is reached.
+	// Terminals that don't match then fail without running their regexps,
+	// which pays off where much of a parse goes into its terminals.
+	Lexer bool
+}
+
+// mode distinguishes the parsers compiled for the options that need parsers
+// of their own, so that parses without them don't pay for them.
+type mode struct {
+	actions bool
+	lexer   bool
+}
+
+// compiled holds the parsers compiled for a mode, and the tokenizer of the
+// grammar in lexer mode.
+type compiled struct {
+	parsers map[Rule]Parser
+	tokens  *tokenizer
+}
+
+// variants holds the parsers compiled for each mode but the default, the
+// first time a parse calls for them.
+type variants struct {
+	mu       sync.Mutex
+	compiled map[mode]compiled
+}
+
+func (p Parsers) compiled(m mode) compiled {
+	if m == (mode{}) {
+		return compiled{parsers: p.parsers}
+	}
+	p.variants.mu.Lock()
+	defer p.variants.mu.Unlock()
+	c, has := p.variants.compiled[m]
+	if !has {
+		if p.variants.compiled == nil {
+			p.variants.compiled = map[mode]compiled{}
+		}
+		c = p.grammar.compile(m)
+		p.variants.compiled[m] = c
+	}
+	return c
+}
+
+// ParseWithOptions parses some source per a given rule, with the features opts
+// turns on.
+func (p Parsers) ParseWithOptions(rule Rule, input *Scanner, opts ParseOptions) (TreeElement, error) {
+	scope := Scope{}.WithExternals(opts.Externals).WithPredicates(opts.Predicates, opts.Context)
+	var m mode
+	if opts.Actions != nil {
+		m.actions = true
+		scope = scope.WithActions(opts.Actions)
+	}
+	if opts.Trivia {
+		scope = scope.withTrivia()
+	}
+	m.lexer = opts.Lexer
+	scope = scope.PushCall(string(rule), rule)
+	c := p.compiled(m)
+	if t := c.tokens; t != nil && t.dfa != nil {
+		table := t.dfa.newTable(*input)
+		defer t.dfa.release(table)
+		scope = scope.withMemo(table)
+		t.tokenize(scope, table, *input)
+	} else {
+		scope = scope.withMemo(nil)
+	}
 	var e TreeElement
-	if err := p.parsers[rule].Parse(scope, input, &e); err != nil {
+	if err := c.parsers[rule].Parse(scope, input, &e); err != nil {
 		return nil, err
 	}
-
-	if input.String() == "" {
-		return e, nil
+	if input.String() != "" {
+		return nil, UnconsumedInput(*input, e)
 	}
-
-	return nil, UnconsumedInput(*input, e)
+	if opts.Trivia {
+		attachTrivia(&e)
+	}
+	return e, nil
 }
 
 func (p Parsers) Parse(rule Rule, input *Scanner) (TreeElement, error) {
@@ -88,6 +184,12 @@ type Choice int
 
 func (Choice) IsExtra() {}
 
+// PermOrder records the order in which the members of a Perm appeared in the
+// input, by their index in the Perm.
+type PermOrder []int
+
+func (PermOrder) IsExtra() {}
+
 type Associativity int
 
 func NewAssociativity(s string) Associativity {
@@ -127,12 +229,17 @@ type (
 	REF  struct {
 		Ident   string
 		Default Term
+		// Mods, if any, transform the text matched earlier, in order, into
+		// what the REF matches in place of that exact text.
+		Mods []RefMod
 	}
-	ExtRef string
-	Seq    []Term
-	Oneof  []Term
-	Stack  []Term
-	Delim  struct {
+	ExtRef  string
+	Seq     []Term
+	Oneof   []Term
+	Longest []Term
+	Perm    []Term
+	Stack   []Term
+	Delim   struct {
 		Term            Term
 		Sep             Term
 		Assoc           Associativity
@@ -143,6 +250,10 @@ type (
 		Term Term
 		Min  int
 		Max  int // 0 = infinity
+		// MinRef and MaxRef, if set, name a term matched earlier in scope
+		// whose text is the integer to use as Min or Max instead.
+		MinRef string
+		MaxRef string
 	}
 	Named struct {
 		Name string
@@ -153,6 +264,51 @@ type (
 		Grammar Grammar
 	}
 	CutPoint struct{ Term }
+	// LookAhead matches if Term matches (or, if Negative, if it doesn't)
+	// without consuming any input.
+	LookAhead struct {
+		Term     Term
+		Negative bool
+	}
+	// Exclude matches Term unless the text it matched is also matched in
+	// full by Except.
+	Exclude struct {
+		Term   Term
+		Except Term
+	}
+	// CaselessS matches a string regardless of case.
+	CaselessS string
+	// Parametric is the definition of a rule that takes parameters. Within
+	// Term, each parameter is referred to as REF{Ident: param}.
+	Parametric struct {
+		Params []string
+		Term   Term
+	}
+	// Call matches the Parametric rule Rule with its parameters bound to Args.
+	Call struct {
+		Rule Rule
+		Args []Term
+	}
+	// ExtPred matches Term if the Predicate named Ident accepts the match.
+	ExtPred struct {
+		Term  Term
+		Ident string
+	}
+	// Bytes matches as many bytes as the integer text of the term named Ref
+	// matched earlier in scope.
+	Bytes struct {
+		Ref string
+	}
+	// Offside matches the line structure of an indentation-sensitive
+	// (offside rule) grammar. Lines holding nothing but whitespace and, if
+	// Comment is set, a comment are skipped as blank.
+	Offside struct {
+		Kind    OffsideKind
+		Comment RE
+	}
+	// Lexical matches Term as a single token. Nothing is skipped or wrapped
+	// by .wrapRE between its parts, and its match is one Scanner.
+	Lexical struct{ Term }
 )
 
 func NonAssoc(term, sep Term) Delim { return Delim{Term: term, Sep: sep, Assoc: NonAssociative} }
@@ -205,16 +361,49 @@ func (g Grammar) String() string {
 	return sb.String()
 }
 
-func (t Rule) String() string     { return string(t) }
-func (t S) String() string        { return fmt.Sprintf("%q", string(t)) }
-func (t RE) String() string       { return fmt.Sprintf("/%v/", string(t)) }
-func (t REF) String() string      { return fmt.Sprintf("%%%v=%v", t.Ident, t.Default) }
-func (t ExtRef) String() string   { return string(t) }
-func (t Seq) String() string      { return "(" + join(t, " ") + ")" }
-func (t Oneof) String() string    { return join(t, " | ") }
-func (t Stack) String() string    { return join(t, " > ") }
-func (t Named) String() string    { return fmt.Sprintf("%s=%v", t.Name, t.Term) }
-func (t CutPoint) String() string { return fmt.Sprintf("cutpoint {%s}", t.Term.String()) }
+func (t Rule) String() string      { return string(t) }
+func (t S) String() string         { return fmt.Sprintf("%q", string(t)) }
+func (t RE) String() string        { return fmt.Sprintf("/%v/", string(t)) }
+func (t CaselessS) String() string { return fmt.Sprintf("i%q", string(t)) }
+func (t ExtRef) String() string    { return string(t) }
+func (t Seq) String() string       { return "(" + join(t, " ") + ")" }
+func (t Oneof) String() string     { return join(t, " | ") }
+func (t Longest) String() string   { return join(t, " || ") }
+func (t Perm) String() string      { return join(t, " && ") }
+func (t Stack) String() string     { return join(t, " > ") }
+func (t Named) String() string     { return fmt.Sprintf("%s=%v", t.Name, t.Term) }
+func (t CutPoint) String() string  { return fmt.Sprintf("cutpoint {%s}", t.Term.String()) }
+
+func (t REF) String() string {
+	var sb strings.Builder
+	for _, mod := range t.Mods {
+		sb.WriteString(mod.String())
+	}
+	return fmt.Sprintf("%%%v%s=%v", t.Ident, sb.String(), t.Default)
+}
+
+func (t Exclude) String() string { return fmt.Sprintf("%v - %v", t.Term, t.Except) }
+
+func (t Parametric) String() string {
+	return fmt.Sprintf("(%s) => %v", strings.Join(t.Params, ", "), t.Term)
+}
+
+func (t Call) String() string { return fmt.Sprintf("%s(%s)", t.Rule, join(t.Args, ", ")) }
+
+func (t ExtPred) String() string { return fmt.Sprintf("%v &%%%%%s", t.Term, t.Ident) }
+
+func (t Bytes) String() string { return fmt.Sprintf(".{%%%s}", t.Ref) }
+
+func (t Offside) String() string { return "%" + t.Kind.String() }
+
+func (t Lexical) String() string { return fmt.Sprintf("lexical {%s}", t.Term.String()) }
+
+func (t LookAhead) String() string {
+	if t.Negative {
+		return fmt.Sprintf("!%v", t.Term)
+	}
+	return fmt.Sprintf("&%v", t.Term)
+}
 
 func (t Delim) String() string {
 	leading := ""
@@ -231,6 +420,14 @@ func (t Delim) String() string {
 func (t Quant) String() string {
 	var sb strings.Builder
 	fmt.Fprintf(&sb, "%v", t.Term)
+	if t.MinRef != "" || t.MaxRef != "" {
+		if t.MinRef != "" && t.MinRef == t.MaxRef {
+			fmt.Fprintf(&sb, "{%%%s}", t.MinRef)
+		} else {
+			fmt.Fprintf(&sb, "{%s,%s}", quantBound(t.Min, t.MinRef), quantBound(t.Max, t.MaxRef))
+		}
+		return sb.String()
+	}
 	switch [2]int{t.Min, t.Max} {
 	case [2]int{0, 0}:
 		sb.WriteString("*")
@@ -254,6 +451,16 @@ func (t Quant) String() string {
 	return sb.String()
 }
 
+func quantBound(n int, ref string) string {
+	switch {
+	case ref != "":
+		return "%" + ref
+	case n != 0:
+		return strconv.Itoa(n)
+	}
+	return ""
+}
+
 func (t ScopedGrammar) String() string {
 	return fmt.Sprintf("%v { %v }", t.Term, t.Grammar)
 }
@@ -37,6 +37,7 @@ func assertEqualNodes(t *testing.T, v, u Node, path []interface{}) bool {
 				ok(assertEqualNodes(t, vc, uc.(Node), subpath))
 			case Scanner:
 				ok(assert.Equal(t, vc, uc, "%v: %v != %v", subpath, vc, uc))
+			case Empty:
 			default:
 				ok(false)
 				t.Errorf("%v unexpected type %T: %[1]v %v", vc, uc)
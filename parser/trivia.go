@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Trivia is the text skipped before and after a token, such as whitespace and
+// comments. Each match of .skip, and the text .wrapRE matches either side of a
+// token, is a separate Scanner.
+type Trivia struct {
+	Leading, Trailing []Scanner
+}
+
+// Leading returns the trivia skipped before r, if r is a token parsed with
+// ParseOptions.Trivia.
+func (r Scanner) Leading() []Scanner {
+	if r.trivia == nil {
+		return nil
+	}
+	return r.trivia.Leading
+}
+
+// Trailing returns the trivia skipped after r, up to the end of its line, if r
+// is a token parsed with ParseOptions.Trivia.
+func (r Scanner) Trailing() []Scanner {
+	if r.trivia == nil {
+		return nil
+	}
+	return r.trivia.Trailing
+}
+
+// WithTrivia returns r with the given trivia, which Unparse writes around it.
+// It can be used to keep the comments of a token that is being replaced.
+func (r Scanner) WithTrivia(leading, trailing []Scanner) Scanner {
+	r.trivia = &Trivia{Leading: leading, Trailing: trailing}
+	return r
+}
+
+// Leading returns the trivia skipped before the first token of n.
+func (n Node) Leading() []Scanner {
+	if s, ok := n.token(0, 1); ok {
+		return s.Leading()
+	}
+	return nil
+}
+
+// Trailing returns the trivia skipped after the last token of n.
+func (n Node) Trailing() []Scanner {
+	if s, ok := n.token(len(n.Children)-1, -1); ok {
+		return s.Trailing()
+	}
+	return nil
+}
+
+// token returns the first token carrying trivia found searching n's children
+// from i in the given direction.
+func (n Node) token(i, dir int) (Scanner, bool) {
+	for ; 0 <= i && i < len(n.Children); i += dir {
+		switch c := n.Children[i].(type) {
+		case Scanner:
+			if c.trivia != nil {
+				return c, true
+			}
+		case Node:
+			start := 0
+			if dir < 0 {
+				start = len(c.Children) - 1
+			}
+			if s, ok := c.token(start, dir); ok {
+				return s, true
+			}
+		}
+	}
+	return Scanner{}, false
+}
+
+const triviaKey = ".Trivia-key."
+
+func (s Scope) withTrivia() Scope {
+	return s.With(triviaKey, true)
+}
+
+// tokenWithTrivia attaches the trivia around token to it, if trivia is being kept.
+// Text in match either side of the token, matched by .wrapRE, is trivia too.
+func tokenWithTrivia(scope Scope, token, match Scanner, leading, trailing []Scanner) Scanner {
+	if !scope.Has(triviaKey) {
+		return token
+	}
+	if pre := token.offset - match.offset; pre > 0 {
+		leading = append(leading[:len(leading):len(leading)], *match.Slice(0, pre))
+	}
+	if end := token.offset + len(token.String()); end < match.offset+len(match.String()) {
+		trailing = append([]Scanner{*match.Skip(end - match.offset)}, trailing...)
+	}
+	return token.WithTrivia(leading, trailing)
+}
+
+// writeToken writes a token with its trivia.
+func writeToken(e TreeElement, w io.Writer) (n int, err error) {
+	s := e.(Scanner)
+	for _, t := range s.Leading() {
+		if err = unparseText(t.String(), w, &n); err != nil {
+			return
+		}
+	}
+	if err = unparseText(s.String(), w, &n); err != nil {
+		return
+	}
+	for _, t := range s.Trailing() {
+		if err = unparseText(t.String(), w, &n); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func unparseText(text string, w io.Writer, N *int) error {
+	n, err := w.Write([]byte(text))
+	*N += n
+	return err
+}
+
+// attachTrivia moves the trivia after the end of each token's line to the
+// leading trivia of the token after it, so that comments on lines of their own
+// attach to the code that follows them.
+func attachTrivia(e *TreeElement) {
+	var tokens []*TreeElement
+	var collect func(e *TreeElement)
+	collect = func(e *TreeElement) {
+		switch c := (*e).(type) {
+		case Scanner:
+			if c.trivia != nil {
+				tokens = append(tokens, e)
+			}
+		case Node:
+			for i := range c.Children {
+				collect(&c.Children[i])
+			}
+		}
+	}
+	collect(e)
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return (*tokens[i]).(Scanner).offset < (*tokens[j]).(Scanner).offset
+	})
+
+	for i := 0; i+1 < len(tokens); i++ {
+		prev, next := (*tokens[i]).(Scanner), (*tokens[i+1]).(Scanner)
+		trailing, leading := splitAtLineEnd(prev.Trailing())
+		*tokens[i] = prev.WithTrivia(prev.Leading(), trailing)
+		*tokens[i+1] = next.WithTrivia(append(leading, next.Leading()...), next.Trailing())
+	}
+}
+
+// splitAtLineEnd splits trivia after its first line break.
+func splitAtLineEnd(trivia []Scanner) (line, rest []Scanner) {
+	for i, t := range trivia {
+		if j := strings.Index(t.String(), "\n"); j >= 0 {
+			line = append(trivia[:i:i], *t.Slice(0, j+1))
+			if j+1 < len(t.String()) {
+				rest = append(rest, *t.Skip(j + 1))
+			}
+			return line, append(rest, trivia[i+1:]...)
+		}
+	}
+	return trivia, nil
+}
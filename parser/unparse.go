@@ -10,14 +10,23 @@ import (
 // unsure.
 
 func (t S) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
-	return w.Write([]byte(e.(Scanner).String()))
+	return writeToken(e, w)
 }
 
 func (t RE) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
-	return w.Write([]byte(e.(Scanner).String()))
+	return writeToken(e, w)
 }
+
+// Unparse writes the string as it appeared in the input, not as it appears in
+// the grammar.
+func (t CaselessS) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return writeToken(e, w)
+}
+
+// Unparse writes the text the REF matched, whether that was the text it refers
+// to, as modified by any Mods, or its Default.
 func (t REF) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
-	return w.Write([]byte("\\" + e.(Scanner).String()))
+	return w.Write([]byte(textFromRefVal(e)))
 }
 
 func unparse(g Grammar, term Term, e TreeElement, w io.Writer, N *int) error {
@@ -38,6 +47,26 @@ func (t Seq) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
 	return n, nil
 }
 
+func (t Longest) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return Oneof(t).Unparse(g, e, w)
+}
+
+// Unparse writes the members in the order they appeared in the input, or in
+// grammar order if the order wasn't recorded.
+func (t Perm) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	node := e.(Node)
+	order, ok := node.Extra.(PermOrder)
+	if !ok {
+		return Seq(t).Unparse(g, e, w)
+	}
+	for _, i := range order {
+		if err = unparse(g, t[i], node.Children[i], w, &n); err != nil {
+			return
+		}
+	}
+	return n, nil
+}
+
 func (t Oneof) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
 	node := e.(Node)
 	return t[node.Extra.(Choice)].Unparse(g, node.Children[0], w)
@@ -92,6 +121,38 @@ func (t CutPoint) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err err
 	return t.Term.Unparse(g, e, w)
 }
 
+func (t LookAhead) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return 0, nil
+}
+
+func (t Exclude) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return t.Term.Unparse(g, e, w)
+}
+
+func (t Parametric) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return t.Term.Unparse(g, e, w)
+}
+
+func (t Call) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return t.Rule.Unparse(g, e, w)
+}
+
+func (t ExtPred) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return t.Term.Unparse(g, e, w)
+}
+
+func (t Bytes) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return w.Write([]byte(e.(Scanner).String()))
+}
+
+func (t Lexical) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return writeToken(e, w)
+}
+
+func (t Offside) Unparse(g Grammar, e TreeElement, w io.Writer) (n int, err error) {
+	return w.Write([]byte(e.(Scanner).String()))
+}
+
 func (t ExtRef) Unparse(g Grammar, te TreeElement, w io.Writer) (n int, err error) {
 	panic("implement me")
 }
@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/arr-ai/wbnf/ast"
 
@@ -19,74 +21,154 @@ func unfakeBackquote(s string) string {
 	return strings.ReplaceAll(s, "‵", "`")
 }
 
+// parseString returns the value of a STR token. It panics if the token
+// contains an invalid escape, which validation reports beforehand.
 func parseString(s string) string {
-	var sb strings.Builder
-	quote, s := s[0], s[1:len(s)-1]
+	value, err := unquote(s)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// escapeError describes an invalid escape within a STR token. Offset and size
+// locate the escape within the token, in bytes.
+type escapeError struct {
+	offset, size int
+	msg          string
+}
+
+func (e escapeError) Error() string { return e.msg }
+
+// unquote returns the value of a STR token. A leading i, marking the string as
+// case-insensitive, is ignored. Escapes are those of Go string literals plus
+// \u{...}, which takes from one to six hex digits.
+func unquote(s string) (string, error) {
+	prefix := 0
+	if strings.HasPrefix(s, "i") {
+		prefix = 1
+	}
+	quote, body := s[prefix], s[prefix+1:len(s)-1]
 	if quote == '`' {
-		return strings.ReplaceAll(s, "``", "`")
+		return strings.ReplaceAll(body, "``", "`"), nil
 	}
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		switch c {
-		case '\\':
+	var sb strings.Builder
+	for i := 0; i < len(body); {
+		if body[i] != '\\' {
+			sb.WriteByte(body[i])
 			i++
-			switch s[i] {
-			case 'x':
-				n, err := strconv.ParseInt(s[i:i+2], 16, 8)
-				if err != nil {
-					panic(err)
-				}
-				sb.WriteByte(uint8(n))
-				i++
-			case 'u':
-				n, err := strconv.ParseInt(s[i:i+4], 16, 16)
-				if err != nil {
-					panic(err)
-				}
-				sb.WriteByte(uint8(n))
-				i += 2
-			case 'U':
-				n, err := strconv.ParseInt(s[i:i+8], 16, 32)
-				if err != nil {
-					panic(err)
-				}
-				sb.WriteByte(uint8(n))
-				i += 4
-			case '0', '1', '2', '3', '4', '5', '6', '7':
-				n, err := strconv.ParseInt(s[i:i+3], 8, 8)
-				if err != nil {
-					panic(err)
-				}
-				sb.WriteByte(uint8(n))
-				i++
-			case 'a':
-				sb.WriteByte('\a')
-			case 'b':
-				sb.WriteByte('\b')
-			case 'f':
-				sb.WriteByte('\f')
-			case 'n':
-				sb.WriteByte('\n')
-			case 'r':
-				sb.WriteByte('\r')
-			case 't':
-				sb.WriteByte('\t')
-			case 'v':
-				sb.WriteByte('\v')
-			case '\\':
-				sb.WriteByte('\\')
-			case '\'':
-				sb.WriteByte('\'')
-			case quote:
-				sb.WriteByte(quote)
-			default:
-				panic(fmt.Errorf("unrecognized \\-escape: %q", s[i]))
-			}
-		default:
-			sb.WriteByte(c)
+			continue
+		}
+		size, err := unescape(body[i:], &sb)
+		if err != nil {
+			return "", escapeError{offset: prefix + 1 + i, size: size, msg: err.Error()}
 		}
+		i += size
 	}
-	return sb.String()
+	return sb.String(), nil
+}
+
+// unescape writes the value of the escape at the start of s to sb and returns
+// the escape's length in bytes.
+func unescape(s string, sb *strings.Builder) (int, error) {
+	if len(s) < 2 {
+		return len(s), fmt.Errorf("incomplete escape")
+	}
+	hex := func(digits int) (int, error) {
+		if len(s) < 2+digits {
+			return len(s), fmt.Errorf("\\%c takes %d hex digits", s[1], digits)
+		}
+		n, err := strconv.ParseUint(s[2:2+digits], 16, 32)
+		if err != nil {
+			return 2 + digits, fmt.Errorf("\\%c takes %d hex digits", s[1], digits)
+		}
+		if s[1] == 'x' {
+			sb.WriteByte(byte(n))
+		} else if err := writeCodePoint(sb, n); err != nil {
+			return 2 + digits, err
+		}
+		return 2 + digits, nil
+	}
+	switch c := s[1]; c {
+	case 'a':
+		sb.WriteByte('\a')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case 't':
+		sb.WriteByte('\t')
+	case 'v':
+		sb.WriteByte('\v')
+	case '\\', '\'', '"':
+		sb.WriteByte(c)
+	case 'x':
+		return hex(2)
+	case 'U':
+		return hex(8)
+	case 'u':
+		if !strings.HasPrefix(s[2:], "{") {
+			return hex(4)
+		}
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return len(s), fmt.Errorf("unterminated \\u{...} escape")
+		}
+		digits := s[3:end]
+		n, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 {
+			return end + 1, fmt.Errorf("\\u{...} takes from one to six hex digits")
+		}
+		return end + 1, writeCodePoint(sb, n)
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		if len(s) < 4 {
+			return len(s), fmt.Errorf("octal escapes take 3 digits")
+		}
+		n, err := strconv.ParseUint(s[1:4], 8, 8)
+		if err != nil {
+			return 4, fmt.Errorf("octal escapes take 3 digits up to \\377")
+		}
+		sb.WriteByte(byte(n))
+		return 4, nil
+	default:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return 1 + size, fmt.Errorf("unknown escape")
+	}
+	return 2, nil
+}
+
+func writeCodePoint(sb *strings.Builder, n uint64) error {
+	if n > unicode.MaxRune || 0xD800 <= n && n < 0xE000 {
+		return fmt.Errorf("U+%04X is not a valid code point", n)
+	}
+	sb.WriteRune(rune(n))
+	return nil
+}
+
+// parseRangeBound returns the code point at one end of a range, written either
+// as U+XXXX or as a string holding a single character. caseless is true for a
+// string with an i prefix.
+func parseRangeBound(str *StrNode, codepoint *CodepointNode) (r rune, caseless bool, err error) {
+	if codepoint != nil {
+		n, err := strconv.ParseUint(codepoint.String()[2:], 16, 32)
+		if err != nil || n > unicode.MaxRune || 0xD800 <= n && n < 0xE000 {
+			return 0, false, fmt.Errorf("it is not a valid code point")
+		}
+		return rune(n), false, nil
+	}
+	value, err := unquote(str.String())
+	if err != nil {
+		return 0, false, err
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == utf8.RuneError && size == 1 {
+		return 0, false, fmt.Errorf("it is not a single character")
+	}
+	return r, strings.HasPrefix(str.String(), "i"), nil
 }
 
 var whitespaceRE = regexp.MustCompile(`\s`)
@@ -94,12 +176,36 @@ var escapedSpaceRE = regexp.MustCompile(`((?:\A|[^\\])(?:\\\\)*)\\_`)
 
 type grammarBuilder struct {
 	macros map[string]PragmaMacrodefNode
+	// ignoreCase is set within grammars containing the .ignorecase pragma.
+	ignoreCase bool
+	// rule is the rule being built, named as in a RuleGraph, e.g.
+	// "pragma/import" for a rule nested in a ScopedGrammar.
+	rule string
+	// nocuts, if not nil, collects the rules named by .nocuts pragmas.
+	nocuts map[string]bool
+	// cuts, if not nil, collects the explicit cuts (~).
+	cuts *[]Cut
+	// params holds the parameters of the parametric rule being built.
+	params map[string]bool
+	// parametric holds the number of parameters of each rule that takes any.
+	parametric map[string]int
+	// offside is set within grammars containing the .offside pragma, where
+	// %newline, %indent and %dedent match the layout of lines.
+	offside *parser.Offside
+	// tokens holds the rules of the grammar being built that .token pragmas
+	// make lexical.
+	tokens map[string]bool
+	// upperTokens is set within grammars containing a .token pragma that
+	// names no rules, which makes every rule with an uppercase name lexical.
+	upperTokens bool
 }
 
 func (gb grammarBuilder) expandMacro(node MacrocallNode) parser.Term {
 	name := node.OneName().String()
 	macro := gb.macros[name]
-	g := parser.Grammar{parser.Rule(name): gb.buildTerm(*macro.OneTerm())}
+	body := gb
+	body.params = nil
+	g := parser.Grammar{parser.Rule(name): body.buildTerm(*macro.OneTerm())}
 
 	newg := rebuildGrammar(g, func(t parser.Term) parser.Term {
 		switch t := t.(type) {
@@ -115,39 +221,81 @@ func (gb grammarBuilder) expandMacro(node MacrocallNode) parser.Term {
 	return newg[parser.Rule(name)]
 }
 
+func buildRE(name string) parser.RE {
+	s := whitespaceRE.ReplaceAllString(name, "")
+	// Do this twice to cover adjacent escaped spaces `\_\_`.
+	s = escapedSpaceRE.ReplaceAllString(s, "$1 ")
+	s = escapedSpaceRE.ReplaceAllString(s, "$1 ")
+	if strings.HasPrefix(s, "/{") {
+		s = s[2 : len(s)-1]
+	}
+	return parser.RE(s)
+}
+
+// layoutRef returns the Offside term that a plain %newline, %indent or %dedent
+// stands for in a grammar with the .offside pragma.
+func (gb grammarBuilder) layoutRef(ref RefNode) (parser.Term, bool) {
+	if gb.offside == nil || len(ref.AllRefmod()) > 0 || ref.OneAtom() != nil {
+		return nil, false
+	}
+	layout := *gb.offside
+	switch ref.OneIdent().String() {
+	case "newline":
+		layout.Kind = parser.Newline
+	case "indent":
+		layout.Kind = parser.Indent
+	case "dedent":
+		layout.Kind = parser.Dedent
+	default:
+		return nil, false
+	}
+	return layout, true
+}
+
 func (gb grammarBuilder) buildAtom(atom AtomNode) parser.Term {
-	x, _ := ast.Which(atom.Node.(ast.Branch), "RE", "STR", "macrocall", "ExtRef", "IDENT", "REF", "term")
+	x, _ := ast.Which(atom.Node.(ast.Branch), "RE", "STR", "macrocall", "ExtRef", "IDENT", "REF", "range", "call", "term")
 	name := ""
 	switch x {
-	case "term", "REF", "ExtRef", "macrocall", "":
+	case "term", "REF", "ExtRef", "macrocall", "range", "call", "":
 	default:
 		name = atom.One(x).Scanner().String()
 	}
 
 	switch x {
 	case "IDENT":
+		if gb.params[name] {
+			return parser.REF{Ident: name}
+		}
 		return parser.Rule(name)
 	case "STR":
+		if gb.ignoreCase || strings.HasPrefix(name, "i") {
+			return parser.CaselessS(parseString(name))
+		}
 		return parser.S(parseString(name))
 	case "RE":
-		s := whitespaceRE.ReplaceAllString(name, "")
-		// Do this twice to cover adjacent escaped spaces `\_\_`.
-		s = escapedSpaceRE.ReplaceAllString(s, "$1 ")
-		s = escapedSpaceRE.ReplaceAllString(s, "$1 ")
-		if strings.HasPrefix(s, "/{") {
-			s = s[2 : len(s)-1]
-		}
-		return parser.RE(s)
+		return buildRE(name)
 	case "REF":
 		refNode := atom.OneRef()
+		if layout, isLayout := gb.layoutRef(*refNode); isLayout {
+			return layout
+		}
 		ref := parser.REF{
 			Ident:   refNode.OneIdent().String(),
 			Default: nil,
 		}
-		if defTerm := refNode.OneDefault().String(); defTerm != "" {
-			ref.Default = parser.S(parseString(defTerm))
+		for _, mod := range refNode.AllRefmod() {
+			m := parser.RefMod{Name: mod.OneName().String()}
+			if arg := mod.OneArg(); arg != nil {
+				m.Arg = parseString(arg.String())
+			}
+			ref.Mods = append(ref.Mods, m)
+		}
+		if def := refNode.OneAtom(); def != nil {
+			ref.Default = gb.buildAtom(*def)
 		}
 		return ref
+	case "range":
+		return gb.buildRange(*atom.OneRange())
 	case "ExtRef":
 		refNode := atom.OneExtRef()
 		return parser.ExtRef(refNode.OneIdent().String())
@@ -155,11 +303,36 @@ func (gb grammarBuilder) buildAtom(atom AtomNode) parser.Term {
 		return gb.buildTerm(*atom.OneTerm())
 	case "macrocall":
 		return gb.expandMacro(*atom.OneMacrocall())
+	case "call":
+		call := atom.OneCall()
+		args := make([]parser.Term, 0, len(call.AllTerm()))
+		for _, arg := range call.AllTerm() {
+			args = append(args, gb.buildTerm(arg))
+		}
+		return parser.Call{Rule: parser.Rule(call.OneName().String()), Args: args}
 	}
 	// Must be the empty term '()'
 	return parser.Seq{}
 }
 
+// buildRange returns a character class matching the code points from lo to hi
+// inclusive.
+func (gb grammarBuilder) buildRange(node RangeNode) parser.Term {
+	lo, loCaseless, err := parseRangeBound(node.OneLo().OneStr(), node.OneLo().OneCodepoint())
+	if err != nil {
+		panic(err)
+	}
+	hi, hiCaseless, err := parseRangeBound(node.OneHi().OneStr(), node.OneHi().OneCodepoint())
+	if err != nil {
+		panic(err)
+	}
+	class := fmt.Sprintf(`[\x{%x}-\x{%x}]`, lo, hi)
+	if gb.ignoreCase || loCaseless || hiCaseless {
+		class = "(?i:" + class + ")"
+	}
+	return parser.RE(class)
+}
+
 func (gb grammarBuilder) buildQuant(q QuantNode, term parser.Term) parser.Term {
 	switch q.Choice() {
 	case 0:
@@ -172,23 +345,9 @@ func (gb grammarBuilder) buildQuant(q QuantNode, term parser.Term) parser.Term {
 			return parser.Some(term)
 		}
 	case 1:
-		min := 0
-		max := 0
-		if x := q.OneMin().String(); x != "" {
-			val, err := strconv.Atoi(x)
-			if err != nil {
-				panic(err)
-			}
-			min = val
-		}
-		if x := q.OneMax().String(); x != "" {
-			val, err := strconv.Atoi(x)
-			if err != nil {
-				panic(err)
-			}
-			max = val
-		}
-		return parser.Quant{Term: term, Min: min, Max: max}
+		min, minRef := parseBound(q.OneMin().String())
+		max, maxRef := parseBound(q.OneMax().String())
+		return parser.Quant{Term: term, Min: min, Max: max, MinRef: minRef, MaxRef: maxRef}
 	case 2:
 		assoc := parser.NewAssociativity(q.OneOp())
 		sep := gb.buildNamed(*q.OneNamed())
@@ -200,10 +359,48 @@ func (gb grammarBuilder) buildQuant(q QuantNode, term parser.Term) parser.Term {
 			delim.CanEndWithSep = true
 		}
 		return delim
+	case 3:
+		return parser.ExtPred{Term: term, Ident: q.OnePred().String()}
+	case 4:
+		count, ref := parseBound(q.OneCount().String())
+		if ref == "" {
+			if count == 1 {
+				return term
+			}
+			return parser.Quant{Term: term, Min: count, Max: count}
+		}
+		// .{%n} matches n bytes rather than n characters.
+		switch t := term.(type) {
+		case parser.RE:
+			if t == "." {
+				return parser.Bytes{Ref: ref}
+			}
+		case parser.Named:
+			if t.Term == parser.RE(".") {
+				return parser.Named{Name: t.Name, Term: parser.Bytes{Ref: ref}}
+			}
+		}
+		return parser.Quant{Term: term, MinRef: ref, MaxRef: ref}
 	}
 	panic("bad input")
 }
 
+// parseBound parses a quant bound, which is either an integer or a reference
+// (%name) to a term matched earlier.
+func parseBound(x string) (int, string) {
+	if x == "" {
+		return 0, ""
+	}
+	if strings.HasPrefix(x, "%") {
+		return 0, x[1:]
+	}
+	val, err := strconv.Atoi(x)
+	if err != nil {
+		panic(err)
+	}
+	return val, ""
+}
+
 func (gb grammarBuilder) buildNamed(n NamedNode) parser.Term {
 	atom := gb.buildAtom(*n.OneAtom())
 	if ident := n.OneIdent().String(); ident != "" {
@@ -212,17 +409,116 @@ func (gb grammarBuilder) buildNamed(n NamedNode) parser.Term {
 	return atom
 }
 
+// buildSeq builds the terms of a sequence. A cut (~) commits the parse to
+// the sequence once the term before it has matched, so it wraps that term in
+// a CutPoint.
+func (gb grammarBuilder) buildSeq(children []TermNode) []parser.Term {
+	terms := make([]parser.Term, 0, len(children))
+	for _, child := range children {
+		if split, ok := gb.splitCall(child); ok {
+			terms = append(terms, split...)
+			continue
+		}
+		cut, isCut := cutToken(child)
+		if !isCut {
+			terms = append(terms, gb.buildTerm(child))
+			continue
+		}
+		if last := len(terms) - 1; last >= 0 {
+			if gb.cuts != nil {
+				*gb.cuts = append(*gb.cuts, Cut{
+					Rule: gb.rule, Term: terms[last], Kind: ExplicitCut, Position: cut.Position()})
+			}
+			terms[last] = parser.CutPoint{Term: terms[last]}
+		}
+	}
+	return terms
+}
+
+// splitCall returns the terms that term stands for if it calls a rule that
+// isn't parametric. Such a call reads as it did before rules took parameters,
+// as the rule followed by a group, so b("x")* is b ("x")*.
+func (gb grammarBuilder) splitCall(term TermNode) ([]parser.Term, bool) {
+	for len(term.AllTerm()) == 1 && term.OneOp() == "" && len(term.AllGrammar()) == 0 {
+		term = term.AllTerm()[0]
+	}
+	named := term.OneNamed()
+	if named == nil {
+		return nil, false
+	}
+	call := named.OneAtom().OneCall()
+	if call == nil {
+		return nil, false
+	}
+	name := call.OneName().String()
+	if _, has := gb.parametric[name]; has {
+		return nil, false
+	}
+
+	var rule parser.Term = parser.Rule(name)
+	if gb.params[name] {
+		rule = parser.REF{Ident: name}
+	}
+	if ident := named.OneIdent().String(); ident != "" {
+		rule = parser.Eq(ident, rule)
+	}
+	switch term.OneLookahead() {
+	case "&":
+		rule = parser.LookAhead{Term: rule}
+	case "!":
+		rule = parser.LookAhead{Term: rule, Negative: true}
+	}
+
+	var group parser.Term = parser.Seq{}
+	if args := call.AllTerm(); len(args) > 0 {
+		group = gb.buildTerm(args[0])
+	}
+	quants := term.AllQuant()
+	for i := range quants {
+		group = gb.buildQuant(quants[len(quants)-1-i], group)
+	}
+	return []parser.Term{rule, group}, true
+}
+
+// cutToken returns the ~ token if term is nothing but a cut.
+func cutToken(term TermNode) (parser.Scanner, bool) {
+	for len(term.AllTerm()) == 1 && term.OneOp() == "" && len(term.AllGrammar()) == 0 {
+		term = term.AllTerm()[0]
+	}
+	if named := term.OneNamed(); named != nil && named.OneIdent() == nil &&
+		len(term.AllQuant()) == 0 && term.OneLookahead() == "" {
+		if cut := ast.First(named.OneAtom().Node, "cut"); cut != nil {
+			return ast.First(cut, "").Scanner(), true
+		}
+	}
+	return parser.Scanner{}, false
+}
+
 func (gb grammarBuilder) buildTerm(t TermNode) parser.Term {
 	if len(t.AllTerm()) > 0 {
 		var terms []parser.Term
-		for _, t := range t.AllTerm() {
-			terms = append(terms, gb.buildTerm(t))
+		if t.OneOp() == "" {
+			terms = gb.buildSeq(t.AllTerm())
+		} else {
+			for _, t := range t.AllTerm() {
+				terms = append(terms, gb.buildTerm(t))
+			}
 		}
 		switch t.OneOp() {
 		case "|":
 			return append(parser.Oneof{}, terms...)
 		case ">":
 			return append(parser.Stack{}, terms...)
+		case "||":
+			return append(parser.Longest{}, terms...)
+		case "&&":
+			return append(parser.Perm{}, terms...)
+		case "-":
+			term := terms[0]
+			for _, except := range terms[1:] {
+				term = parser.Exclude{Term: term, Except: except}
+			}
+			return term
 		}
 		var sg *parser.ScopedGrammar
 		if g := t.AllGrammar(); len(g) == 1 {
@@ -244,6 +540,9 @@ func (gb grammarBuilder) buildTerm(t TermNode) parser.Term {
 		}
 		return append(parser.Seq{}, terms...)
 	}
+	if terms, ok := gb.splitCall(t); ok {
+		return parser.Seq(terms)
+	}
 	// named and quants need to be added backwards
 	// "a":","*     ->   Any(Delim(... S("a")))
 	next := gb.buildNamed(*t.OneNamed())
@@ -251,6 +550,12 @@ func (gb grammarBuilder) buildTerm(t TermNode) parser.Term {
 	for i := range quants {
 		next = gb.buildQuant(quants[len(quants)-1-i], next)
 	}
+	switch t.OneLookahead() {
+	case "&":
+		return parser.LookAhead{Term: next}
+	case "!":
+		return parser.LookAhead{Term: next, Negative: true}
+	}
 	return next
 }
 
@@ -259,9 +564,9 @@ func (gb grammarBuilder) buildProd(p ProdNode) parser.Term {
 	if len(children) == 1 {
 		return gb.buildTerm(children[0])
 	}
-	seq := make(parser.Seq, 0, len(children))
-	for _, child := range children {
-		seq = append(seq, gb.buildTerm(child))
+	seq := parser.Seq(gb.buildSeq(children))
+	if len(seq) == 1 {
+		return seq[0]
 	}
 	return seq
 }
@@ -269,17 +574,86 @@ func (gb grammarBuilder) buildProd(p ProdNode) parser.Term {
 func (gb grammarBuilder) buildGrammar(node ast.Node) parser.Grammar {
 	g := parser.Grammar{}
 	tree := NewGrammarNode(node)
+	gb.tokens = map[string]bool{}
+	prefix := ""
+	if gb.rule != "" {
+		prefix = gb.rule + ScopeDelim
+	}
+	for _, stmt := range tree.AllStmt() {
+		if pragma := stmt.OnePragma(); pragma != nil {
+			if pragma.OneIgnorecase() != nil {
+				gb.ignoreCase = true
+			}
+			if offside := pragma.OneOffside(); offside != nil {
+				gb.offside = &parser.Offside{}
+				if comment := offside.OneComment(); comment != nil {
+					gb.offside.Comment = buildRE(comment.String())
+				}
+			}
+			if token := pragma.OneToken(); token != nil {
+				if rules := token.AllRule(); len(rules) > 0 {
+					for _, rule := range rules {
+						gb.tokens[rule.String()] = true
+					}
+				} else {
+					gb.upperTokens = true
+				}
+			}
+			if nocuts := pragma.OneNocuts(); nocuts != nil && gb.nocuts != nil {
+				for _, rule := range nocuts.AllRule() {
+					gb.nocuts[prefix+rule.String()] = true
+				}
+			}
+		}
+	}
 	for _, stmt := range tree.AllStmt() {
 		if prod := stmt.OneProd(); prod != nil {
-			g[parser.Rule(prod.OneIdent().String())] = gb.buildProd(*prod)
+			name := prod.OneIdent().String()
+			inner := gb
+			inner.rule = prefix + name
+			if params := prod.OneParams(); params != nil {
+				inner.params = map[string]bool{}
+				var names []string
+				for _, param := range params.AllIdent() {
+					inner.params[param.String()] = true
+					names = append(names, param.String())
+				}
+				g[parser.Rule(name)] = parser.Parametric{Params: names, Term: gb.lexical(name, inner.buildProd(*prod))}
+				continue
+			}
+			g[parser.Rule(name)] = gb.lexical(name, inner.buildProd(*prod))
 		}
 	}
 	return g
 }
 
+// lexical returns the term of the rule name, made Lexical if a .token pragma
+// applies to it.
+func (gb grammarBuilder) lexical(name string, term parser.Term) parser.Term {
+	if gb.tokens[name] || gb.upperTokens && isUpper(name) {
+		return parser.Lexical{Term: term}
+	}
+	return term
+}
+
+func isUpper(name string) bool {
+	return strings.ToUpper(name) == name && strings.ToLower(name) != name
+}
+
 func NewFromAst(node ast.Node) parser.Grammar {
+	g, _ := buildWithCuts(node, nil)
+	return g
+}
+
+// buildWithCuts builds the grammar in node and inserts its cutpoints. If
+// explicit is not nil, the cuts written in the grammar are added to it. The
+// cuts that were inserted automatically are returned.
+func buildWithCuts(node ast.Node, explicit *[]Cut) (parser.Grammar, []Cut) {
 	gb := grammarBuilder{
-		macros: map[string]PragmaMacrodefNode{},
+		macros:     map[string]PragmaMacrodefNode{},
+		nocuts:     map[string]bool{},
+		cuts:       explicit,
+		parametric: findParametricRules(NewGrammarNode(node)),
 	}
 	WalkerOps{
 		EnterPragmaMacrodefNode: func(node PragmaMacrodefNode) Stopper {
@@ -289,7 +663,7 @@ func NewFromAst(node ast.Node) parser.Grammar {
 	}.Walk(NewGrammarNode(node))
 	g := gb.buildGrammar(node)
 
-	return insertCutPoints(g)
+	return insertCutPoints(g, gb.nocuts)
 }
 
 func mergeGrammarNodes(a, b ast.Branch) ast.Node {
@@ -353,18 +727,33 @@ func (c *compiler) loadGrammarFile(filename string) (GrammarNode, error) {
 }
 
 func Compile(grammar string, resolver ImportResolver) (parser.Parsers, error) {
+	p, _, err := compile(grammar, resolver, false)
+	return p, err
+}
+
+// CompileWithWarnings is like Compile, but also returns the problems found in
+// the grammar that don't stop it from compiling, as Warnings does.
+func CompileWithWarnings(grammar string, resolver ImportResolver) (parser.Parsers, []error, error) {
+	return compile(grammar, resolver, true)
+}
+
+func compile(grammar string, resolver ImportResolver, warn bool) (parser.Parsers, []error, error) {
 	c := compiler{
 		imports:  map[string]GrammarNode{},
 		resolver: resolver,
 	}
 	node, err := c.makeGrammar("", grammar)
 	if err != nil {
-		return parser.Parsers{}, err
+		return parser.Parsers{}, nil, err
 	}
 	if err := validate(node); err != nil {
-		return parser.Parsers{}, err
+		return parser.Parsers{}, nil, err
+	}
+	var warnings []error
+	if warn {
+		warnings = Warnings(node)
 	}
-	return NewFromAst(node).Compile(node), nil
+	return NewFromAst(node).Compile(node), warnings, nil
 }
 
 func MustCompile(grammar string, resolver ImportResolver) parser.Parsers {
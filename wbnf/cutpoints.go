@@ -1,6 +1,9 @@
 package wbnf
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/arr-ai/frozen"
 	"github.com/arr-ai/wbnf/parser"
 )
@@ -28,31 +31,255 @@ Where can cutpoints be added?
 
 What does this code attempt to add?
 	1) Any S() token which appears only once in the entire grammar can be safely considered a cutpoint
-	2) .... TBD
+	2) A reference to a rule in a sequence, if every string in the rule's FIRST set (the strings it can begin
+	   with) is unique by 1), the rule can begin with nothing else and it is referenced nowhere else. Any other
+	   parse of the same text would have to go through one of those strings, so the rest of the sequence is
+	   committed once the rule has matched.
 
 The intention of this file is to provide good-enough cutpoints that it is not necessary for grammar authors
-to add their own
+to add their own. Where they do, a ~ following a term in a sequence is an explicit cutpoint after that term.
+Automatic cutpoints can be turned off for individual rules with the .nocuts pragma.
 
 */
 
-func insertCutPoints(g parser.Grammar) parser.Grammar {
-	strings := findUniqueStrings(g)
-	s := strings.Elements()
-	_ = s
+// CutKind says why a cutpoint is where it is.
+type CutKind int
+
+const (
+	ExplicitCut     CutKind = iota // written as ~ in the grammar
+	UniqueStringCut                // a string that appears only once in the grammar
+	UniqueFirstCut                 // a rule that can only begin with unique strings
+)
+
+func (k CutKind) String() string {
+	switch k {
+	case ExplicitCut:
+		return "explicit"
+	case UniqueStringCut:
+		return "unique string"
+	case UniqueFirstCut:
+		return "unique first set"
+	}
+	return "unknown"
+}
+
+// Cut is a cutpoint in a compiled grammar. Once Term has matched, a failure
+// in the rest of its sequence fails the whole parse instead of backtracking.
+type Cut struct {
+	// Rule is named as in a RuleGraph, e.g. "pragma/import" for a rule
+	// nested in a ScopedGrammar.
+	Rule     string
+	Term     parser.Term
+	Kind     CutKind
+	Position parser.Position
+}
+
+// Cuts returns the cutpoints of the grammar in tree, explicit or inserted
+// automatically, in the order they appear in the grammar's source.
+func Cuts(tree GrammarNode) []Cut {
+	var cuts []Cut
+	_, auto := buildWithCuts(tree.Node, &cuts)
+	prods := ruleProds(tree)
+	for _, cut := range auto {
+		var source parser.Scanner
+		found := false
+		if prod, has := prods[cut.Rule]; has {
+			source, found = findCutSource(prod, cut)
+		}
+		if !found {
+			// The term came from elsewhere, such as the body of a macro.
+			source, _ = findCutSource(tree, cut)
+		}
+		cut.Position = source.Position()
+		cuts = append(cuts, cut)
+	}
+	sort.SliceStable(cuts, func(i, j int) bool {
+		if cuts[i].Position.Offset != cuts[j].Position.Offset {
+			return cuts[i].Position.Offset < cuts[j].Position.Offset
+		}
+		return cuts[i].Rule < cuts[j].Rule
+	})
+	return cuts
+}
+
+// findCutSource returns the token in node that an automatic cut was made
+// from. The rules of scoped grammars within node are skipped, since their cuts
+// are made under their own ids.
+func findCutSource(node IsWalkableType, cut Cut) (source parser.Scanner, found bool) {
+	WalkerOps{
+		EnterGrammarNode: func(GrammarNode) Stopper {
+			if _, isGrammar := node.(GrammarNode); isGrammar {
+				return nil
+			}
+			return NodeExiter
+		},
+		EnterAtomNode: func(atom AtomNode) Stopper {
+			if found {
+				// Aborter only exits the current node, as walkers check
+				// ExitNode first.
+				return Aborter
+			}
+			switch t := cut.Term.(type) {
+			case parser.S:
+				if str := atom.OneStr(); str != nil && !strings.HasPrefix(str.String(), "i") {
+					if value, err := unquote(str.String()); err == nil && value == string(t) {
+						source, found = str.Scanner(), true
+						return Aborter
+					}
+				}
+			case parser.Rule:
+				if ident := atom.OneIdent(); ident != nil && ident.String() == string(t) {
+					source, found = ident.Scanner(), true
+					return Aborter
+				}
+			}
+			return nil
+		},
+	}.Walk(node)
+	return source, found
+}
+
+type cutInserter struct {
+	unique frozen.Set
+	refs   map[parser.Rule]int
+	nocuts map[string]bool
+	cuts   []Cut
+}
+
+// insertCutPoints returns g with cutpoints inserted, except in the rules
+// named in nocuts, along with a list of them.
+func insertCutPoints(g parser.Grammar, nocuts map[string]bool) (parser.Grammar, []Cut) {
+	c := &cutInserter{unique: findUniqueStrings(g), refs: countRefs(g), nocuts: nocuts}
+	return c.grammar(g, ""), c.cuts
+}
+
+func (c *cutInserter) grammar(g parser.Grammar, prefix string) parser.Grammar {
+	out := parser.Grammar{}
+	for rule, term := range g {
+		id := prefix + string(rule)
+		if c.nocuts[id] {
+			out[rule] = term
+			continue
+		}
+		var callback func(t parser.Term) parser.Term
+		callback = func(t parser.Term) parser.Term {
+			switch t := t.(type) {
+			case parser.S:
+				if c.unique.Has(string(t)) {
+					c.cuts = append(c.cuts, Cut{Rule: id, Term: t, Kind: UniqueStringCut})
+					return parser.CutPoint{Term: t}
+				}
+			case parser.Seq:
+				// There is nothing to commit to after the last term.
+				for i := 0; i < len(t)-1; i++ {
+					if ref, ok := t[i].(parser.Rule); ok && c.uniqueFirst(ref, g) {
+						c.cuts = append(c.cuts, Cut{Rule: id, Term: ref, Kind: UniqueFirstCut})
+						t[i] = parser.CutPoint{Term: ref}
+					}
+				}
+			case parser.ScopedGrammar:
+				t.Grammar = c.grammar(t.Grammar, id+ScopeDelim)
+				return t
+			}
+			return t
+		}
+		out[rule] = fixTerm(term, callback)
+	}
+	return out
+}
+
+// uniqueFirst returns true if rule is referenced only once and can only
+// begin with unique strings.
+func (c *cutInserter) uniqueFirst(rule parser.Rule, g parser.Grammar) bool {
+	first, ok := c.firstStrings(rule, g, map[parser.Rule]bool{})
+	if !ok {
+		return false
+	}
+	for _, s := range first {
+		if !c.unique.Has(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// firstStrings returns the strings term can begin with. ok is false if term
+// can begin with anything else, match nothing, or goes through a rule that
+// is referenced more than once or isn't defined in g.
+func (c *cutInserter) firstStrings(
+	term parser.Term, g parser.Grammar, seen map[parser.Rule]bool,
+) (first []string, ok bool) {
+	switch t := term.(type) {
+	case parser.S:
+		return []string{string(t)}, t != ""
+	case parser.Rule:
+		inner, has := g[t]
+		if !has || seen[t] || c.refs[t] != 1 {
+			return nil, false
+		}
+		seen[t] = true
+		return c.firstStrings(inner, g, seen)
+	case parser.Seq:
+		if len(t) > 0 {
+			return c.firstStrings(t[0], g, seen)
+		}
+	case parser.Oneof:
+		return c.firstStringsOfAll(t, g, seen)
+	case parser.Longest:
+		return c.firstStringsOfAll(t, g, seen)
+	case parser.Quant:
+		if t.Min > 0 {
+			return c.firstStrings(t.Term, g, seen)
+		}
+	case parser.Delim:
+		if !t.CanStartWithSep {
+			return c.firstStrings(t.Term, g, seen)
+		}
+	case parser.Named:
+		return c.firstStrings(t.Term, g, seen)
+	case parser.CutPoint:
+		return c.firstStrings(t.Term, g, seen)
+	case parser.Lexical:
+		return c.firstStrings(t.Term, g, seen)
+	}
+	return nil, false
+}
+
+func (c *cutInserter) firstStringsOfAll(
+	terms []parser.Term, g parser.Grammar, seen map[parser.Rule]bool,
+) (first []string, ok bool) {
+	for _, t := range terms {
+		f, ok := c.firstStrings(t, g, seen)
+		if !ok {
+			return nil, false
+		}
+		first = append(first, f...)
+	}
+	return first, len(terms) > 0
+}
+
+// countRefs returns the number of references to each rule name anywhere in
+// g, including its ScopedGrammars.
+func countRefs(g parser.Grammar) map[parser.Rule]int {
+	refs := map[parser.Rule]int{}
 	var callback func(t parser.Term) parser.Term
 	callback = func(t parser.Term) parser.Term {
 		switch t := t.(type) {
-		case parser.S:
-			if strings.Has(string(t)) {
-				return parser.CutPoint{t}
+		case parser.Rule:
+			refs[t]++
+		case parser.Call:
+			refs[t.Rule]++
+		case parser.REF:
+			if t.Default != nil {
+				fixTerm(t.Default, callback)
 			}
 		case parser.ScopedGrammar:
-			t.Grammar = rebuildGrammar(t.Grammar, callback)
-			return t
+			rebuildGrammar(t.Grammar, callback)
 		}
 		return t
 	}
-	return rebuildGrammar(g, callback)
+	rebuildGrammar(g, callback)
+	return refs
 }
 
 func findUniqueStrings(g parser.Grammar) frozen.Set {
@@ -80,6 +307,14 @@ func findUniqueStrings(g parser.Grammar) frozen.Set {
 			for _, t := range t {
 				out = out.Merge(forTerm(t), mergeFn)
 			}
+		case parser.Longest:
+			for _, t := range t {
+				out = out.Merge(forTerm(t), mergeFn)
+			}
+		case parser.Perm:
+			for _, t := range t {
+				out = out.Merge(forTerm(t), mergeFn)
+			}
 		case parser.Delim:
 			out = out.Merge(forTerm(t.Term), mergeFn)
 			out = out.Merge(forTerm(t.Sep), mergeFn)
@@ -101,7 +336,22 @@ func findUniqueStrings(g parser.Grammar) frozen.Set {
 			out = out.Merge(forTerm(t.Default), mergeFn)
 		case parser.CutPoint:
 			out = out.Merge(forTerm(t.Term), mergeFn)
-		case parser.RE, parser.Rule, parser.ExtRef: // do nothing
+		case parser.Lexical:
+			out = out.Merge(forTerm(t.Term), mergeFn)
+		case parser.LookAhead:
+			out = out.Merge(forTerm(t.Term), mergeFn)
+		case parser.Exclude:
+			out = out.Merge(forTerm(t.Term), mergeFn)
+			out = out.Merge(forTerm(t.Except), mergeFn)
+		case parser.Parametric:
+			out = out.Merge(forTerm(t.Term), mergeFn)
+		case parser.ExtPred:
+			out = out.Merge(forTerm(t.Term), mergeFn)
+		case parser.Call:
+			for _, t := range t.Args {
+				out = out.Merge(forTerm(t), mergeFn)
+			}
+		case parser.RE, parser.CaselessS, parser.Rule, parser.ExtRef, parser.Bytes, parser.Offside: // do nothing
 		default:
 			panic("unexpected term")
 		}
@@ -132,7 +382,7 @@ func fixTerm(term parser.Term, callback func(t parser.Term) parser.Term) parser.
 		for _, t := range t {
 			out = append(out, fixTerm(t, callback))
 		}
-		return out
+		return callback(out)
 	case parser.Stack:
 		out := parser.Stack{}
 		for _, t := range t {
@@ -145,6 +395,18 @@ func fixTerm(term parser.Term, callback func(t parser.Term) parser.Term) parser.
 			out = append(out, fixTerm(t, callback))
 		}
 		return callback(out)
+	case parser.Longest:
+		out := parser.Longest{}
+		for _, t := range t {
+			out = append(out, fixTerm(t, callback))
+		}
+		return callback(out)
+	case parser.Perm:
+		out := parser.Perm{}
+		for _, t := range t {
+			out = append(out, fixTerm(t, callback))
+		}
+		return callback(out)
 	case parser.Delim:
 		t.Term = fixTerm(t.Term, callback)
 		t.Sep = fixTerm(t.Sep, callback)
@@ -161,7 +423,31 @@ func fixTerm(term parser.Term, callback func(t parser.Term) parser.Term) parser.
 	case parser.CutPoint:
 		t.Term = fixTerm(t.Term, callback)
 		return callback(t)
-	case parser.S, parser.REF, parser.RE, parser.Rule:
+	case parser.Lexical:
+		t.Term = fixTerm(t.Term, callback)
+		return callback(t)
+	case parser.LookAhead:
+		t.Term = fixTerm(t.Term, callback)
+		return callback(t)
+	case parser.Exclude:
+		t.Term = fixTerm(t.Term, callback)
+		t.Except = fixTerm(t.Except, callback)
+		return callback(t)
+	case parser.Parametric:
+		t.Term = fixTerm(t.Term, callback)
+		return callback(t)
+	case parser.ExtPred:
+		t.Term = fixTerm(t.Term, callback)
+		return callback(t)
+	case parser.Call:
+		args := make([]parser.Term, 0, len(t.Args))
+		for _, t := range t.Args {
+			args = append(args, fixTerm(t, callback))
+		}
+		t.Args = args
+		return callback(t)
+	case parser.S, parser.CaselessS, parser.REF, parser.RE, parser.Rule, parser.ExtRef, parser.Bytes,
+		parser.Offside:
 		return callback(term)
 	default:
 		panic("unexpected term")
@@ -1,6 +1,7 @@
 package wbnf
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/arr-ai/frozen"
@@ -29,3 +30,124 @@ func TestStringCutpointsInNestedGrammar(t *testing.T) {
 
 	assert.EqualValues(t, frozen.NewSetFromStrings("a").Elements(), idents.Elements())
 }
+
+func TestCuts(t *testing.T) {
+	p := MustCompile(`
+		stmt  -> ifs | whiles | x=IDENT "=" IDENT;
+		ifs   -> "if" IDENT ~ "then" stmt;
+		whiles -> kw body;
+		kw    -> "while" | "until";
+		body  -> "do" stmt "done";
+		IDENT -> /{[a-z]+};
+		.nocuts body;
+	`, nil)
+
+	var report []string
+	for _, cut := range Cuts(p.Node().(GrammarNode)) {
+		report = append(report, fmt.Sprintf("%s %v %v %v", cut.Rule, cut.Position, cut.Kind, cut.Term))
+	}
+	assert.Equal(t, []string{
+		`stmt 2:35 unique string "="`,
+		`ifs 3:12 unique string "if"`,
+		`ifs 3:23 explicit IDENT`,
+		`ifs 3:25 unique string "then"`,
+		`whiles 4:13 unique first set kw`,
+		`kw 5:12 unique string "while"`,
+		`kw 5:22 unique string "until"`,
+	}, report)
+}
+
+func TestCutsInScopes(t *testing.T) {
+	// The w that a/x is cut after is its own, not the one in the unused macro.
+	p := MustCompile(`
+		a -> x { x -> w "y"; w -> "(" | "["; };
+		.macro M(p) { w p };
+	`, nil)
+
+	var report []string
+	for _, cut := range Cuts(p.Node().(GrammarNode)) {
+		report = append(report, fmt.Sprintf("%s %v %v %v", cut.Rule, cut.Position, cut.Kind, cut.Term))
+	}
+	assert.Equal(t, []string{
+		`a/x 2:17 unique first set w`,
+		`a/x 2:19 unique string "y"`,
+		`a/w 2:29 unique string "("`,
+		`a/w 2:35 unique string "["`,
+	}, report)
+}
+
+func TestExplicitCut(t *testing.T) {
+	// Without the cut, y fails and "a" "c" is tried instead.
+	for _, test := range []struct {
+		grammar string
+		ok      bool
+	}{
+		{`x -> y | "a" "c"; y -> "a" "b";`, true},
+		{`x -> y | "a" "c"; y -> "a" ~ "b";`, false},
+	} {
+		p := MustCompile(test.grammar+`.nocuts x, y;`, nil)
+		_, err := p.Parse("x", parser.NewScanner("ac"))
+		assert.Equal(t, test.ok, err == nil, test.grammar)
+	}
+}
+
+func TestCutsAfterRules(t *testing.T) {
+	for _, test := range []struct {
+		name, grammar, input, expected string
+	}{
+		{
+			"explicit",
+			`stmt -> "a" IDENT ~ ";" | "b"; IDENT -> /{[a-z]+};`,
+			"a foo;",
+			`stmt║0[_[a, foo, ;]]`,
+		},
+		{
+			"unique first set",
+			`
+			stmt  -> ifs | whiles | x=IDENT "=" IDENT;
+			ifs   -> "if" IDENT ~ "then" stmt;
+			whiles -> kw body;
+			kw    -> "while" | "until";
+			body  -> "do" stmt "done";
+			IDENT -> /{[a-z]+};
+			.nocuts body;
+			`,
+			"while do a = b done",
+			`stmt║1[whiles[kw║0[while], body[do, stmt║2[_[a, =, b]], done]]]`,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := MustCompile(test.grammar+`.wrapRE -> /{\s*()\s*};`, nil)
+			v, err := p.Parse("stmt", parser.NewScanner(test.input))
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, fmt.Sprint(v))
+			}
+		})
+	}
+}
+
+func TestUniqueFirstCutpoints(t *testing.T) {
+	for _, test := range []struct {
+		name, grammar string
+		cut           bool
+	}{
+		{"unique", `a -> b "x"; b -> "(" | "[";`, true},
+		{"shared string", `a -> b "x" | "(" "y"; b -> "(" | "[";`, false},
+		{"shared rule", `a -> b "x" | b "y"; b -> "(";`, false},
+		{"regexp", `a -> b "x"; b -> "(" | /{\d+};`, false},
+		{"nullable", `a -> b "x"; b -> "("?;`, false},
+		{"last", `a -> "x" b; b -> "(";`, false},
+		{"nocuts", `a -> b "x"; b -> "("; .nocuts a;`, false},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p := MustCompile(test.grammar, nil)
+			cut := false
+			for _, c := range Cuts(p.Node().(GrammarNode)) {
+				cut = cut || c.Kind == UniqueFirstCut
+			}
+			assert.Equal(t, test.cut, cut)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package wbnf
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/arr-ai/wbnf/parser"
+)
+
+// Example_calculator evaluates arithmetic while parsing it, using the
+// precedence stack grammar from the README with its last two layers merged so
+// that numbers needn't be parenthesised.
+func Example_calculator() {
+	p := MustCompile(`
+		expr -> @:op=[-+]
+		      > @:op=[*/]
+		      > "(" expr ")" | \d+;
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+
+	// fold applies the operators between the values of a layer, from left to
+	// right.
+	fold := func(_ parser.TreeElement, values []interface{}) (interface{}, error) {
+		result := values[0].(float64)
+		for i := 1; i < len(values); i += 2 {
+			operand := values[i+1].(float64)
+			switch values[i].(parser.Scanner).String() {
+			case "+":
+				result += operand
+			case "-":
+				result -= operand
+			case "*":
+				result *= operand
+			case "/":
+				if operand == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				result /= operand
+			}
+		}
+		return result, nil
+	}
+	actions := parser.Actions{
+		"expr":   fold,
+		"expr@1": fold,
+		"expr@2": func(_ parser.TreeElement, values []interface{}) (interface{}, error) {
+			if len(values) == 3 {
+				return values[1], nil // "(" expr ")"
+			}
+			return strconv.ParseFloat(values[0].(parser.Scanner).String(), 64)
+		},
+	}
+
+	for _, input := range []string{"1 + 2 * 3", "(1 + 2) * 3", "8 / (3 - 3)"} {
+		te, err := p.ParseWithOptions("expr", parser.NewScanner(input), parser.ParseOptions{Actions: actions})
+		var v interface{}
+		if err == nil {
+			v = te.(parser.Value).V
+		}
+		fmt.Println(v, err != nil)
+	}
+	// Output:
+	// 7 false
+	// 9 false
+	// <nil> true
+}
@@ -2,9 +2,12 @@ package wbnf
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/arr-ai/wbnf/ast"
@@ -102,7 +105,8 @@ func stack(name string, extras ...parser.Extra) *stackBuilder {
 func TestParseNamedTerm(t *testing.T) {
 	r := parser.NewScanner(`opt=""`)
 	x := stack(`term`, parser.NonAssociative).z(
-		stack(`_`).z(stack(`term@1`, parser.NonAssociative).a(`term@2`).a(`term@3`).z(
+		stack(`_`).z(stack(`term@1`, parser.NonAssociative).a(`term@2`, parser.NonAssociative).a(`term@3`, parser.NonAssociative).a(`term@4`).a(`term@5`, parser.NonAssociative).a(`term@6`).z(
+			stack(`?`).z(),
 			stack(`named`).z(
 				stack(`?`).a(`_`).z(*r.Slice(0, 3), *r.Slice(3, 4)),
 				stack(`atom`, parser.Choice(1)).z(*r.Slice(4, 6)),
@@ -115,7 +119,8 @@ func TestParseNamedTerm(t *testing.T) {
 func TestParseNamedTermInDelim(t *testing.T) {
 	r := parser.NewScanner(`"1":op=","`)
 	x := stack(`term`, parser.NonAssociative).z(
-		stack(`_`).z(stack(`term@1`, parser.NonAssociative).a(`term@2`).a(`term@3`).z(
+		stack(`_`).z(stack(`term@1`, parser.NonAssociative).a(`term@2`, parser.NonAssociative).a(`term@3`, parser.NonAssociative).a(`term@4`).a(`term@5`, parser.NonAssociative).a(`term@6`).z(
+			stack(`?`).z(),
 			stack(`named`).z(
 				stack(`?`).z(),
 				stack(`atom`, parser.Choice(1)).z(*r.Slice(0, 3)),
@@ -198,7 +203,7 @@ func TestGrammarSnippet(t *testing.T) {
 	v, err := parsers.Parse("term", r)
 	require.NoError(t, err)
 	assert.Equal(t,
-		`term║:[_[term@1║:[term@2[term@3[named[?[], atom║0[prod]], ?[quant║0[+]]]]], ?[]]]`,
+		`term║:[_[term@1║:[term@2║:[term@3║:[term@4[term@5║:[term@6[?[], named[?[], atom║3[prod]], ?[quant║0[+]]]]]]]], ?[]]]`,
 		fmt.Sprintf("%v", v),
 	)
 	assertUnparse(t, "prod+", parsers, v)
@@ -313,3 +318,669 @@ func TestScopeGrammarwithWrapping(t *testing.T) {
 
 	parser.AssertEqualNodes(t, te.(parser.Node), te2.(parser.Node))
 }
+
+func TestLookAhead(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		stmts -> stmt+;
+		stmt  -> call | var;
+		call  -> name=IDENT &"(" "(" ")";
+		var   -> !kw name=IDENT;
+		kw    -> "if" !/{\w};
+		IDENT -> /{[a-z]+};
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+	assert.Equal(t,
+		parser.LookAhead{Term: parser.RE(`\w`), Negative: true},
+		p.Grammar()["kw"].(parser.Seq)[1])
+
+	for _, input := range []string{"f()", "x", "iffy", "x f() y"} {
+		te, err := p.Parse("stmts", parser.NewScanner(input))
+		require.NoError(t, err, input)
+		tree := ast.FromParserNode(p.Grammar(), te)
+		parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+	}
+	for _, input := range []string{"if", "f(", "x if"} {
+		_, err := p.Parse("stmts", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		stmts -> (name=IDENT - ("if" | "else") | kw=("if" | "else"))+;
+		IDENT -> /{[a-z]+};
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+
+	te, err := p.Parse("stmts", parser.NewScanner("iffy if x else elsewhere"))
+	require.NoError(t, err)
+	tree := ast.FromParserNode(p.Grammar(), te)
+	assert.Len(t, tree.Many("name"), 3)
+	assert.Len(t, tree.Many("kw"), 2)
+	parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+
+	// The excluded strings are unique, so they get cutpoints, which the error
+	// doesn't show.
+	q := MustCompile(`ident -> IDENT - ("if" | "else"); IDENT -> /{[a-z]+};`, nil)
+	require.Contains(t, q.Grammar().String(), `cutpoint {"if"}`)
+	_, err = q.Parse("ident", parser.NewScanner("if"))
+	require.Error(t, err)
+	assert.Equal(t, `rule(ident) - "if" is excluded (matches "if" | "else")`,
+		strings.TrimPrefix(strings.Split(err.Error(), "\n")[2], "└── "))
+}
+
+func TestPerm(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		attrs -> "<" ((id="id" val) && (class="class" val)? && (style="style" val)?) ">";
+		val -> "=" /{[a-z]+};
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+
+	for _, src := range []string{
+		`<id=a class=b style=c>`,
+		`<class=b id=a style=c>`,
+		`<style=c class=b id=a>`,
+	} {
+		te, err := p.Parse("attrs", parser.NewScanner(src))
+		require.NoError(t, err, src)
+		tree := ast.FromParserNode(p.Grammar(), te)
+		assert.Equal(t, "id", tree.One("id").Scanner().String(), src)
+		assert.Equal(t, "class", tree.One("class").Scanner().String(), src)
+		assert.Equal(t, "style", tree.One("style").Scanner().String(), src)
+		assert.Len(t, tree.Many("val"), 3)
+		parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+		assertUnparse(t, strings.ReplaceAll(src, " ", ""), p, te)
+	}
+
+	te, err := p.Parse("attrs", parser.NewScanner(`<style=c id=a>`))
+	require.NoError(t, err)
+	tree := ast.FromParserNode(p.Grammar(), te)
+	assert.Nil(t, tree.One("class"))
+	parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+
+	_, err = p.Parse("attrs", parser.NewScanner(`<class=b style=c>`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permutation member missing")
+
+	_, err = p.Parse("attrs", parser.NewScanner(`<id=a class=b id=c style=d>`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permutation member appears more than once")
+
+	// A member repeated after the permutation belongs to what follows it.
+	q := MustCompile(`r -> ("x" && "y"?) "x"; .wrapRE -> /{\s*()\s*};`, nil)
+	_, err = q.Parse("r", parser.NewScanner(`x x`))
+	assert.NoError(t, err)
+}
+
+func TestLongest(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		ops -> (op=("=" || "==" || "=>" || "===") | x=/{[a-z]+})+;
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+
+	te, err := p.Parse("ops", parser.NewScanner("a == b = c === d =>"))
+	require.NoError(t, err)
+	tree := ast.FromParserNode(p.Grammar(), te)
+	var ops []string
+	for _, op := range tree.Many("op") {
+		ops = append(ops, op.One("").Scanner().String())
+	}
+	assert.Equal(t, []string{"==", "=", "===", "=>"}, ops)
+	parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+
+	assertUnparse(t, "a==b=c===d=>", p, te)
+
+	// Ties go to the first alternative.
+	q := MustCompile(`x -> a=/{[a-z]+} || b=/{[a-z]+};`, nil)
+	te, err = q.Parse("x", parser.NewScanner("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, parser.Choice(0), te.(parser.Node).Extra)
+}
+
+func TestCaselessS(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		query -> i"select" col=/{[a-z]+} "from" table=/{[a-z]+};
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+
+	te, err := p.Parse("query", parser.NewScanner("SeLeCt x from y"))
+	require.NoError(t, err)
+	tree := ast.FromParserNode(p.Grammar(), te)
+	parser.AssertEqualNodes(t, te.(parser.Node), ast.ToParserNode(p.Grammar(), tree).(parser.Node))
+	assertUnparse(t, "SeLeCtxfromy", p, te)
+
+	_, err = p.Parse("query", parser.NewScanner("select x FROM y"))
+	assert.Error(t, err)
+
+	q := MustCompile(`
+		query -> "select" from { .ignorecase; from -> "from" table=/{[a-z]+}; };
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+	_, err = q.Parse("query", parser.NewScanner("select FrOm y"))
+	assert.NoError(t, err)
+	_, err = q.Parse("query", parser.NewScanner("SELECT from y"))
+	assert.Error(t, err)
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		greek -> U+0391..U+03A9 ('α'..'ω' | '\u{1F600}'..'\U0001F64F')*;
+		hex   -> ('0'..'9' | i'a'..'f')+;
+	`, nil)
+
+	for _, input := range []string{"Ω", "Σαβω", "Δ😀🙏"} {
+		_, err := p.Parse("greek", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, input := range []string{"α", "Ωz", "Δ🚀"} {
+		_, err := p.Parse("greek", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+
+	_, err := p.Parse("hex", parser.NewScanner("09afAF"))
+	assert.NoError(t, err)
+	_, err = p.Parse("hex", parser.NewScanner("0g"))
+	assert.Error(t, err)
+}
+
+func TestPredicates(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		stmts   -> stmt+;
+		stmt    -> typedef | decl | expr;
+		typedef -> "typedef" IDENT &%%define ";";
+		decl    -> IDENT &%%isType "*"? IDENT ";";
+		expr    -> IDENT "*" IDENT ";";
+		IDENT   -> /{[a-z]+};
+		.wrapRE -> /{\s*()\s*};
+	`, nil)
+	assert.Equal(t,
+		parser.ExtPred{Term: parser.Rule("IDENT"), Ident: "isType"},
+		p.Grammar()["decl"].(parser.Seq)[0])
+
+	preds := parser.Predicates{
+		"define": func(_ parser.Scope, match parser.TreeElement, ctx interface{}) bool {
+			ctx.(map[string]bool)[match.(parser.Scanner).String()] = true
+			return true
+		},
+		"isType": func(_ parser.Scope, match parser.TreeElement, ctx interface{}) bool {
+			return ctx.(map[string]bool)[match.(parser.Scanner).String()]
+		},
+	}
+	for _, test := range []struct {
+		input string
+		rules []string
+	}{
+		{"a * b;", []string{"expr"}},
+		{"typedef a; a * b;", []string{"typedef", "decl"}},
+		{"typedef a; a b; c * d;", []string{"typedef", "decl", "expr"}},
+	} {
+		te, err := p.ParseWithOptions("stmts", parser.NewScanner(test.input), parser.ParseOptions{
+			Predicates: preds,
+			Context:    map[string]bool{},
+		})
+		require.NoError(t, err, test.input)
+		var rules []string
+		for _, stmt := range ast.FromParserNode(p.Grammar(), te).Many("stmt") {
+			for rule := range stmt.(ast.Branch) {
+				if !strings.HasPrefix(rule, "@") {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		assert.Equal(t, test.rules, rules, test.input)
+	}
+
+	_, err := p.ParseWithOptions("stmts", parser.NewScanner("a b;"), parser.ParseOptions{
+		Predicates: preds,
+		Context:    map[string]bool{},
+	})
+	assert.Error(t, err)
+	_, err = p.Parse("stmts", parser.NewScanner("a b;"))
+	assert.Error(t, err)
+}
+
+func TestCountedRepetition(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		netstring -> len=\d+ ":" data=.{%len} ",";
+		list      -> n=\d+ ":" item{%n};
+		item      -> [a-z];
+	`, nil)
+	assert.Equal(t,
+		parser.Named{Name: "data", Term: parser.Bytes{Ref: "len"}},
+		p.Grammar()["netstring"].(parser.Seq)[2])
+
+	for _, test := range []struct {
+		input, data string
+	}{
+		{"5:hello,", "hello"},
+		{"0:,", ""},
+		{"14:hello,\nworld!\n,", "hello,\nworld!\n"},
+	} {
+		te, err := p.Parse("netstring", parser.NewScanner(test.input))
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.data, ast.FromParserNode(p.Grammar(), te).One("data").Scanner().String(), test.input)
+	}
+	for _, input := range []string{"6:hello,", "4:hello,", "x:hello,"} {
+		_, err := p.Parse("netstring", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+
+	for _, input := range []string{"3:abc", "0:"} {
+		_, err := p.Parse("list", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, input := range []string{"3:ab", "3:abcd"} {
+		_, err := p.Parse("list", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestRefModifiers(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		raw     -> "r" hashes=/{#*} "\"" (!("\"" %hashes) /{(?s:.)})* "\"" %hashes;
+		long    -> open=/{\[=*\[} (!%open.mirror /{(?s:.)})* %open.mirror;
+		heredoc -> "<<" tag=/{-?\w+} "\n" lines=(!%tag.strip("-").re("\t*$0\n") /{.*\n})*
+		           %tag.strip("-").re("\t*$0\n");
+		element -> "<" name=/{\w+} ">" /{[^<]*} "</" %name.fold ">";
+		item    -> %sep=("," | ";") "x";
+	`, nil)
+
+	for _, test := range []struct {
+		rule, input string
+	}{
+		{"raw", `r"a"`},
+		{"raw", `r##"a"#b"##`},
+		{"long", "[[a]]"},
+		{"long", "[==[a]]b]=]c]==]"},
+		{"heredoc", "<<EOF\na\nEOF\n"},
+		{"heredoc", "<<-EOF\n\ta\n\tEOF\n"},
+		{"element", "<b>x</B>"},
+		{"item", ",x"},
+		{"item", ";x"},
+	} {
+		te, err := p.Parse(parser.Rule(test.rule), parser.NewScanner(test.input))
+		if assert.NoError(t, err, test.input) {
+			assertUnparse(t, test.input, p, te)
+		}
+	}
+	for _, test := range []struct {
+		rule, input string
+	}{
+		{"raw", `r#"a"`},
+		{"long", "[==[a]=]"},
+		{"heredoc", "<<EOF\na\nEND\n"},
+		{"element", "<b>x</i>"},
+		{"item", "x"},
+	} {
+		_, err := p.Parse(parser.Rule(test.rule), parser.NewScanner(test.input))
+		assert.Error(t, err, test.input)
+	}
+}
+
+func TestOffside(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		file -> %newline? stmt*;
+		stmt -> "if" NAME ":" %indent stmt+ %dedent | NAME %newline;
+		NAME -> /{[a-z]+};
+		.wrapRE -> /{[\_\t]*()[\_\t]*};
+		.offside /{#.*};
+	`, nil)
+
+	for _, input := range []string{
+		"a\nb\n",
+		"if x:\n  a\n  b\nc\n",
+		"if x:  # hi\n  a\n\n  # c\n  if y:\n    b\n  c\nd",
+		"if x:\n  if y:\n    a\nb\n",
+		"if x:\n  if y:\n    a\n",
+	} {
+		_, err := p.Parse("file", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, test := range []struct {
+		input, msg string
+	}{
+		{"a\n  b\n", ""},
+		{"if x:\na\n", ""},
+		{"if x:\n    a\n  b\n", "unindent does not match any outer indentation level"},
+		{"if x:\n  a\n\tb\n", "inconsistent indentation"},
+	} {
+		_, err := p.Parse("file", parser.NewScanner(test.input))
+		if assert.Error(t, err, test.input) && test.msg != "" {
+			assert.Contains(t, err.Error(), test.msg, test.input)
+		}
+	}
+
+	// The level an %indent matches only applies to the rest of its sequence,
+	// so one in a sub-rule would be lost.
+	_, err := Compile(`
+		stmt  -> "if" NAME ":" block stmt+ %dedent | NAME %newline;
+		block -> %indent;
+		NAME  -> /{[a-z]+};
+		.offside;
+	`, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rule block: %indent must be followed by the rest of its block")
+	}
+}
+
+func TestSkip(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		list    -> "[" item:"," "]";
+		item    -> \d+ | list | block;
+		block   -> "{" s:";" "}" { s -> /{[a-z]+}; .skip -> " "; };
+		.skip   -> WS | COMMENT;
+		WS      -> /{\s+};
+		COMMENT -> "/*" /{(?s:.*?)\*/} | "//" /{.*};
+	`, nil)
+
+	for _, input := range []string{
+		"[1,2]",
+		" [ 1 , 2 ] ",
+		"[1, /* two */ 2 // three\n, 3]\n",
+		"[{a; b}, { c }]",
+	} {
+		_, err := p.Parse("list", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, input := range []string{
+		"[1 /* 2 ]",
+		"[/ / 1]",
+		"[{a;\nb}]",
+	} {
+		_, err := p.Parse("list", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+
+	te, err := p.Parse("list", parser.NewScanner("[ 1 /* one */ ]"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", te.(parser.Node).Children[1].(parser.Node).Children[0].(parser.Node).Children[0].(parser.Scanner).String())
+}
+
+func TestTrivia(t *testing.T) {
+	t.Parallel()
+
+	te, err := Core().ParseWithOptions("grammar", parser.NewScanner(exprGrammarSrc), parser.ParseOptions{Trivia: true})
+	require.NoError(t, err)
+	assertUnparse(t, exprGrammarSrc, Core(), te)
+
+	p := MustCompile(`
+		stmts -> stmt+;
+		stmt  -> /{[a-z]+} "=" \d+ ";";
+		.skip -> /{\s+} | /{//.*};
+	`, nil)
+	src := "  a = 1; // one\n\n// two\nb = 2;\n"
+	te, err = p.ParseWithOptions("stmts", parser.NewScanner(src), parser.ParseOptions{Trivia: true})
+	require.NoError(t, err)
+	assertUnparse(t, src, p, te)
+
+	stmts := te.(parser.Node)
+	a, b := stmts.GetNode(0), stmts.GetNode(1)
+	assert.Equal(t, []string{"  "}, triviaStrings(a.Leading()))
+	assert.Equal(t, []string{" ", "// one", "\n"}, triviaStrings(a.Trailing()))
+	assert.Equal(t, []string{"\n", "// two", "\n"}, triviaStrings(b.Leading()))
+	assert.Equal(t, []string{"\n"}, triviaStrings(b.Trailing()))
+
+	tree := ast.FromParserNode(p.Grammar(), te)
+	stmt := ast.All(tree, "stmt")[1]
+	assert.Equal(t, []string{"\n", "// two", "\n"}, triviaStrings(stmt.Leading()))
+
+	stmts.Children[0], stmts.Children[1] = b, a
+	assertUnparse(t, "\n// two\nb = 2;\n  a = 1; // one\n", p, te)
+}
+
+func triviaStrings(trivia []parser.Scanner) []string {
+	var strs []string
+	for _, s := range trivia {
+		strs = append(strs, s.String())
+	}
+	return strs
+}
+
+func TestLexicalRules(t *testing.T) {
+	t.Parallel()
+
+	for _, grammar := range []string{
+		`.wrapRE -> /{\s*()\s*}; .token FLOAT;`,
+		`.skip -> /{\s+}; .token;`,
+	} {
+		p := MustCompile(`
+			sum   -> FLOAT:"+";
+			FLOAT -> INT "." INT;
+			INT   -> \d+;
+		`+grammar, nil)
+
+		te, err := p.Parse("sum", parser.NewScanner(" 1.5 + 20.25 "))
+		if assert.NoError(t, err, grammar) {
+			sum := te.(parser.Node)
+			assert.Equal(t, *parser.NewScanner(" 1.5 + 20.25 ").Slice(1, 4), sum.Children[0], grammar)
+			assert.Equal(t, "20.25", sum.GetString(2), grammar)
+		}
+		for _, input := range []string{"1 .5", "1. 5", "1.5+2 .0"} {
+			_, err := p.Parse("sum", parser.NewScanner(input))
+			assert.Error(t, err, input)
+		}
+
+		te, err = p.ParseWithOptions("sum", parser.NewScanner("1.5 +\n 2.0\n"), parser.ParseOptions{Trivia: true})
+		if assert.NoError(t, err, grammar) {
+			assertUnparse(t, "1.5 +\n 2.0\n", p, te)
+		}
+	}
+}
+
+func TestParametricRules(t *testing.T) {
+	t.Parallel()
+
+	p := MustCompile(`
+		file          -> block("");
+		block(indent) -> (%indent stmt)+;
+		stmt          -> /{[a-z]+\n} | ":\n" block(%indent "  ");
+
+		str           -> quoted("'") | quoted('"');
+		quoted(q)     -> q (!q /{.})* q;
+	`, nil)
+
+	for _, input := range []string{"a\n", "a\n:\n  b\n  :\n    c\n  d\ne\n"} {
+		_, err := p.Parse("file", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, input := range []string{"  a\n", "a\n:\nb\n", "a\n:\n  b\n   c\n"} {
+		_, err := p.Parse("file", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+
+	for _, input := range []string{`'a"b'`, `"a'b"`, `''`} {
+		_, err := p.Parse("str", parser.NewScanner(input))
+		assert.NoError(t, err, input)
+	}
+	for _, input := range []string{`'a"`, `"a'b'`} {
+		_, err := p.Parse("str", parser.NewScanner(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCallingPlainRules(t *testing.T) {
+	t.Parallel()
+
+	// Calling a rule without parameters reads as the rule followed by a group.
+	for _, test := range []struct{ call, spaced string }{
+		{`a -> b("x")*;`, `a -> b ("x")*;`},
+		{`a -> y=b("x"):"," "z";`, `a -> y=b ("x"):"," "z";`},
+		{`a -> !b("x") | "c";`, `a -> !b ("x") | "c";`},
+		{`a -> "z" b() "z";`, `a -> "z" b () "z";`},
+		{`a -> p("x"); p(q) -> q("y");`, `a -> p("x"); p(q) -> q ("y");`},
+	} {
+		call := MustCompile(test.call+` b -> "b";`, nil)
+		spaced := MustCompile(test.spaced+` b -> "b";`, nil)
+		assert.Equal(t, spaced.Grammar(), call.Grammar(), test.call)
+	}
+
+	p := MustCompile(`a -> b("x")*; b -> "b";`, nil)
+	v, err := p.Parse("a", parser.NewScanner("bxx"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, `a[b, ?[x, x]]`, fmt.Sprint(v))
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	for _, test := range []struct{ str, value string }{
+		{`"a\tb"`, "a\tb"},
+		{`'\''`, "'"},
+		{`i"\x41"`, "A"},
+		{`"\101\u00e9"`, "Aé"},
+		{`"\u{1F600}\u{41}"`, "😀A"},
+		{`"\U0001F600"`, "😀"},
+		{"`a``b`", "a`b"},
+	} {
+		value, err := unquote(test.str)
+		require.NoError(t, err, test.str)
+		assert.Equal(t, test.value, value, test.str)
+	}
+
+	// The error is located in the token, so validation can report it.
+	_, err := unquote(`"é\q"`)
+	require.Error(t, err)
+	assert.Equal(t, escapeError{offset: 3, size: 2, msg: "unknown escape"}, err)
+}
+
+// dirResolver resolves imports relative to a directory.
+type dirResolver string
+
+func (d dirResolver) Resolve(from, path string) string {
+	return filepath.Join(string(d), path)
+}
+
+func compileSysl(t testing.TB) (parser.Parsers, string) {
+	grammar, err := ioutil.ReadFile("../examples/sysl/sysl.wbnf")
+	require.NoError(t, err)
+	input, err := ioutil.ReadFile("../examples/sysl/shop.sysl")
+	require.NoError(t, err)
+	return MustCompile(string(grammar), dirResolver("../examples/sysl")), string(input)
+}
+
+func TestSyslGrammar(t *testing.T) {
+	t.Parallel()
+
+	p, input := compileSysl(t)
+	_, err := p.Parse("sysl_file", parser.NewScanner(input))
+	assert.NoError(t, err)
+}
+
+func TestLexerMode(t *testing.T) {
+	t.Parallel()
+
+	p, input := compileSysl(t)
+	expected, err := p.Parse("sysl_file", parser.NewScanner(input))
+	require.NoError(t, err)
+	actual, err := p.ParseWithOptions("sysl_file", parser.NewScanner(input), lexerMode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, actual)
+	}
+
+	p = MustCompile(jsonGrammarSrc, nil)
+	input = jsonInput(10)
+	expected, err = p.Parse("json", parser.NewScanner(input))
+	require.NoError(t, err)
+	actual, err = p.ParseWithOptions("json", parser.NewScanner(input), lexerMode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, actual)
+	}
+
+	// Trivia is kept in lexer mode too.
+	actual, err = p.ParseWithOptions("json", parser.NewScanner(input), parser.ParseOptions{Lexer: true, Trivia: true})
+	if assert.NoError(t, err) {
+		assertUnparse(t, input, p, actual)
+	}
+
+	_, err = p.ParseWithOptions("json", parser.NewScanner(`{"a": [1, 2,]}`), lexerMode)
+	assert.Error(t, err)
+
+	// Parses in lexer mode can run at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual, err := p.ParseWithOptions("json", parser.NewScanner(input), lexerMode)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, actual)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+var lexerMode = parser.ParseOptions{Lexer: true}
+
+var jsonGrammarSrc = `
+json   -> value;
+value  -> object | array | string | number | "true" | "false" | "null";
+object -> "{" (pair:",")? "}";
+pair   -> string ":" value;
+array  -> "[" (value:",")? "]";
+string -> /{"(?:\\.|[^\\"])*"};
+number -> /{-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][-+]?\d+)?};
+.wrapRE -> /{\s*()\s*};
+`
+
+// jsonInput returns a JSON array of n objects.
+func jsonInput(n int) string {
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		fmt.Fprintf(&sb, `  {"id": %d, "name": "item \"%[1]d\"", "price": %[1]d.25e-1, `+
+			`"tags": ["a", "b"], "stock": {"count": %[1]d, "ok": true, "next": null}}`, i)
+	}
+	sb.WriteString("\n]\n")
+	return sb.String()
+}
+
+func benchmarkParse(b *testing.B, p parser.Parsers, rule parser.Rule, input string) {
+	b.Run("Parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := p.Parse(rule, parser.NewScanner(input)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("LexerMode", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := p.ParseWithOptions(rule, parser.NewScanner(input), lexerMode); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParseSysl(b *testing.B) {
+	p, input := compileSysl(b)
+	benchmarkParse(b, p, "sysl_file", input+strings.Repeat(input[strings.Index(input, "Shop"):], 20))
+}
+
+func BenchmarkParseJSON(b *testing.B) {
+	benchmarkParse(b, MustCompile(jsonGrammarSrc, nil), "json", jsonInput(1000))
+}
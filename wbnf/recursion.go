@@ -5,7 +5,7 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/arr-ai/frozen"
+	"github.com/arr-ai/wbnf/parser"
 )
 
 /*
@@ -16,123 +16,259 @@ Basic definition: Any Seq{} which could make a graph from itself back to itself
 Obvious ones:
 	a -> a;
 	a -> "("? a;
+
+Each rule of the built grammar is reduced to the set of rules it can call before consuming any input (its "left
+edge"). A rule's left edge continues past a term only if that term can match nothing, as parser.Nullability says.
+Any cycle in the resulting graph is a possible infinite recursion. Cycles are found via strongly connected
+components, so the check is linear in the size of the grammar.
 */
 func checkForRecursion(tree GrammarNode) error {
-	dangers := map[string]frozen.Set{}
-
-	// First get a map with every rules directly connected rules
-	WalkerOps{EnterProdNode: func(node ProdNode) Stopper {
-		td := frozen.NewSet()
-		for _, t := range node.AllTerm() {
-			td = td.Union(getSequenceDangerTerms(t))
-		}
-		dangers[node.OneIdent().String()] = td
-		return NodeExiter
-	}}.Walk(tree)
-
-	// walk every path
-	gn := &gnode{map[string]*gnode{}}
-	for k := range dangers {
-		gn.walkRule(k, &dangers)
-	}
-
-	// now determine the cycles
-
+	c := newRecursionChecker(tree)
 	var badRoutes []string
-	paths := findPaths("", gn, frozen.NewSet(), nil)
-	for _, p := range paths {
-		if len(p) != frozen.NewSetFromStrings(p...).Count() {
-			badRoutes = append(badRoutes, strings.Join(p, " > "))
+	for _, cycle := range c.cycles() {
+		var where []string
+		for _, id := range cycle[:len(cycle)-1] {
+			where = append(where, fmt.Sprintf("%s at %s", id, c.rules[id].ident.Position()))
 		}
+		badRoutes = append(badRoutes, fmt.Sprintf("%s (%s)", strings.Join(cycle, " > "), strings.Join(where, ", ")))
 	}
 
 	if len(badRoutes) > 0 {
 		return validationError{
-			msg:  fmt.Sprintf("Possible cycle(s) detected: \n\t%s", strings.Join(badRoutes, "\n\t")),
+			msg:  fmt.Sprintf("Possible cycle(s) detected:\n\t%s", strings.Join(badRoutes, "\n\t")),
 			kind: PossibleCycleDetected,
 		}
 	}
 	return nil
 }
 
-func findPaths(name string, node *gnode, seen frozen.Set, current []string) [][]string {
-	if name != "" {
-		current = append(current, name)
-	}
-	var possibles [][]string
-	for k, next := range node.next {
-		if seen.Has(k) {
-			possibles = append(possibles, append(current[:], k))
-		} else {
-			possibles = append(possibles, findPaths(k, next, seen.With(k), current)...)
-		}
-	}
+type recursionRule struct {
+	ident parser.Scanner
+	first []string
+}
 
-	return possibles
+// recursionEnv is the context a term is analysed in.
+type recursionEnv struct {
+	scope    *ruleScope
+	nullable *parser.Nullability
+	// owner is the rule the term belongs to. Scoped grammars inside it are
+	// registered as owner/rule.
+	owner string
 }
 
-func sortedSet(s frozen.Set) []string {
-	out := make([]string, 0, s.Count())
-	for _, x := range s.Elements() {
-		out = append(out, x.(string))
-	}
-	sort.Strings(out)
-	return out
+type recursionChecker struct {
+	prods map[string]ProdNode
+	rules map[string]*recursionRule
 }
 
-type gnode struct {
-	next map[string]*gnode
+func newRecursionChecker(tree GrammarNode) *recursionChecker {
+	macros := map[string]PragmaMacrodefNode{}
+	WalkerOps{EnterPragmaMacrodefNode: func(node PragmaMacrodefNode) Stopper {
+		macros[node.OneName().String()] = node
+		return NodeExiter
+	}}.Walk(tree)
+	c := &recursionChecker{prods: ruleProds(tree), rules: map[string]*recursionRule{}}
+	c.addGrammar(grammarBuilder{macros: macros}.buildGrammar(tree.Node), recursionEnv{})
+	return c
 }
 
-func (g *gnode) walkRule(start string, dangers *map[string]frozen.Set) *gnode {
-	if f, has := g.next[start]; has {
-		return f
+// addGrammar registers the rules of g, which is nested in the rule env.owner,
+// if any. It returns the env that the terms of g are analysed in.
+func (c *recursionChecker) addGrammar(g parser.Grammar, outer recursionEnv) recursionEnv {
+	g = g.ResolveStacks()
+	prefix := ""
+	if outer.owner != "" {
+		prefix = stackBase(outer.owner) + ScopeDelim
+	}
+	env := recursionEnv{
+		scope:    &ruleScope{rules: map[parser.Rule]string{}, parent: outer.scope},
+		nullable: parser.NewNullability(g, outer.nullable),
 	}
-	node := &gnode{next: map[string]*gnode{}}
-	g.next[start] = node
-	for _, target := range sortedSet((*dangers)[start]) {
-		if f, has := g.next[target]; has {
-			node.next[target] = f
-		} else {
-			node.next[target] = g.walkRule(target, dangers)
+	for rule := range g {
+		if !strings.HasPrefix(string(rule), ".") {
+			env.scope.rules[rule] = prefix + string(rule)
 		}
 	}
-	return node
+	for rule, term := range g {
+		if id, has := env.scope.rules[rule]; has {
+			env.owner = id
+			first := map[string]bool{}
+			c.calls(term, env, first)
+			c.rules[id] = &recursionRule{ident: c.prods[stackBase(id)].OneIdent().Scanner(), first: sortedKeys(first)}
+		}
+	}
+	env.owner = outer.owner
+	return env
 }
 
-func getSequenceDangerTerms(tree TermNode) frozen.Set {
-	result := frozen.NewSet()
+// stackBase returns the id of the rule that the stack layer id belongs to.
+func stackBase(id string) string {
+	if i := strings.LastIndex(id, parser.StackDelim); i > strings.LastIndex(id, ScopeDelim) {
+		return id[:i]
+	}
+	return id
+}
 
-	if tree.OneOp() == "|" {
-		// Any of the options could be dangerous, need to | them all
-		for _, term := range tree.AllTerm() {
-			result = result.Union(getSequenceDangerTerms(term))
+// calls adds to first the rules that term can call before consuming any input.
+// A sequence only gets past a term that can match nothing.
+func (c *recursionChecker) calls(term parser.Term, env recursionEnv, first map[string]bool) {
+	switch t := term.(type) {
+	case parser.Rule:
+		if id, has := env.scope.lookup(t); has {
+			first[id] = true
 		}
-	} else if childTerms := tree.AllTerm(); len(childTerms) > 0 {
-		// As soon as any term is required we can consider the whole tree safe
-		for _, term := range childTerms {
-			dangers := getSequenceDangerTerms(term)
-			if dangers.IsEmpty() {
-				return result
+	case parser.Seq:
+		for _, t := range t {
+			c.calls(t, env, first)
+			if !env.nullable.Term(t) {
+				return
 			}
-			result = result.Union(dangers.Without(""))
 		}
-	} else {
-		for _, q := range tree.AllQuant() {
-			if q.OneOp() == "+" || (q.OneMin() != nil && q.OneMin().String() != "0") || q.OneNamed() != nil {
-				return result // Any of these mean at least one of this term is required
+	case parser.Oneof:
+		for _, t := range t {
+			c.calls(t, env, first)
+		}
+	case parser.Longest:
+		for _, t := range t {
+			c.calls(t, env, first)
+		}
+	case parser.Perm:
+		// Any member of a permutation may come first.
+		for _, t := range t {
+			c.calls(t, env, first)
+		}
+	case parser.Delim:
+		c.calls(t.Term, env, first)
+		if t.CanStartWithSep || env.nullable.Term(t.Term) {
+			c.calls(t.Sep, env, first)
+		}
+	case parser.Quant:
+		c.calls(t.Term, env, first)
+	case parser.Named:
+		c.calls(t.Term, env, first)
+	case parser.CutPoint:
+		c.calls(t.Term, env, first)
+	case parser.Lexical:
+		c.calls(t.Term, env, first)
+	case parser.LookAhead:
+		// A lookahead never consumes input, but still calls its term.
+		c.calls(t.Term, env, first)
+	case parser.Exclude:
+		// Exclusions parse both terms from the same position, but only the
+		// first decides what is consumed.
+		c.calls(t.Term, env, first)
+		c.calls(t.Except, env, first)
+	case parser.REF:
+		if t.Default != nil {
+			c.calls(t.Default, env, first)
+		}
+	case parser.Parametric:
+		c.calls(t.Term, env, first)
+	case parser.Call:
+		c.calls(t.Rule, env, first)
+	case parser.ExtPred:
+		c.calls(t.Term, env, first)
+	case parser.ScopedGrammar:
+		c.calls(t.Term, c.addGrammar(t.Grammar, env), first)
+	}
+}
+
+// ruleProds returns the prods of tree by rule id, which is the rule's name,
+// prefixed with owner/ for the rules of a scoped grammar within owner.
+func ruleProds(tree GrammarNode) map[string]ProdNode {
+	prods := map[string]ProdNode{}
+	var add func(tree GrammarNode, prefix string)
+	add = func(tree GrammarNode, prefix string) {
+		for _, stmt := range tree.AllStmt() {
+			if prod := stmt.OneProd(); prod != nil {
+				id := prefix + prod.OneIdent().String()
+				prods[id] = *prod
+				for _, term := range prod.AllTerm() {
+					WalkerOps{EnterGrammarNode: func(g GrammarNode) Stopper {
+						add(g, id+ScopeDelim)
+						return NodeExiter
+					}}.Walk(term)
+				}
 			}
 		}
-		atom := tree.OneNamed().OneAtom()
-		if term := atom.OneTerm(); term != nil {
-			result = result.Union(getSequenceDangerTerms(*term))
-		} else if ident := atom.OneIdent(); ident != nil {
-			result = result.With(ident.String())
-		} else if len(tree.AllQuant()) == 0 { // no quant means its some form of required string
-			return result
-		} else {
-			result = result.With("")
+	}
+	add(tree, "")
+	return prods
+}
+
+// cycles returns the shortest cycle through each rule that is part of a
+// recursive strongly connected component. Each cycle is reported once, starting
+// and ending with its lexically smallest rule.
+func (c *recursionChecker) cycles() [][]string {
+	ids := make([]string, 0, len(c.rules))
+	for id := range c.rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	edges := func(id string) []string { return c.rules[id].first }
+
+	var result [][]string
+	seen := map[string]bool{}
+	for _, component := range stronglyConnected(ids, edges) {
+		if !isCyclic(component, edges) {
+			continue
+		}
+		members := map[string]bool{}
+		for _, id := range component {
+			members[id] = true
+		}
+		for _, id := range component {
+			cycle := shortestCycle(id, edges, members)
+			key := strings.Join(cycle, " ")
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, append(cycle, cycle[0]))
+			}
 		}
 	}
 	return result
 }
+
+// shortestCycle finds the shortest cycle through start that stays within
+// members, rotated so that it begins with its smallest element.
+func shortestCycle(start string, edges func(string) []string, members map[string]bool) []string {
+	prev := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range edges(v) {
+			if !members[w] {
+				continue
+			}
+			if w == start {
+				cycle := []string{v}
+				for v != start {
+					v = prev[v]
+					cycle = append([]string{v}, cycle...)
+				}
+				smallest := 0
+				for i, id := range cycle {
+					if id < cycle[smallest] {
+						smallest = i
+					}
+				}
+				return append(cycle[smallest:], cycle[:smallest]...)
+			}
+			if _, has := prev[w]; !has {
+				prev[w] = v
+				queue = append(queue, w)
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -1,10 +1,12 @@
 package wbnf
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
-	"github.com/arr-ai/frozen"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type rtd struct {
@@ -12,6 +14,8 @@ type rtd struct {
 	dangers             []string
 }
 
+const rtdRules = "b -> 'b'; d -> 'd'; e -> 'e'; f -> 'f'; n -> 'n'?;"
+
 func TestRecursionTermDangerNodes(t *testing.T) {
 	for _, test := range []rtd{
 		{name: "trivial", rule: "a", grammar: "a -> a;", dangers: []string{"a"}},
@@ -19,53 +23,55 @@ func TestRecursionTermDangerNodes(t *testing.T) {
 		{name: "opt preceding", rule: "a", grammar: "a -> '@'? a;", dangers: []string{"a"}},
 		{name: "trivial unsafe opt", rule: "a", grammar: "a -> '@' | a;", dangers: []string{"a"}},
 		{name: "unsafe opt", rule: "a", grammar: "a -> '@'+ | a? | d | e:':'? | f{0,1};",
-			dangers: []string{"a", "d", "f"}},
+			dangers: []string{"a", "d", "e", "f"}},
+		{name: "required rule", rule: "a", grammar: "a -> b a;", dangers: []string{"b"}},
+		{name: "nullable rule", rule: "a", grammar: "a -> n a;", dangers: []string{"a", "n"}},
+		{name: "min quant", rule: "a", grammar: "a -> b{2,} a | d{,3} a;", dangers: []string{"a", "b", "d"}},
+		{name: "empty term", rule: "a", grammar: "a -> () a;", dangers: []string{"a"}},
+		{name: "leading sep", rule: "a", grammar: "a -> b:,d | e:d;", dangers: []string{"b", "d", "e"}},
+		{name: "macro", rule: "a", grammar: "a -> %!M(b) a; .macro M(x) { x? };", dangers: []string{"a", "b"}},
+		{name: "stack", rule: "a@1", grammar: "a -> @ '+' > '(' a ')' | d;", dangers: []string{"d"}},
+		{name: "scope", rule: "a/x", grammar: "a -> x { x -> y? a; y -> 'y'; };", dangers: []string{"a", "a/y"}},
 	} {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
-			node, err := ParseString(test.grammar)
-			assert.NoError(t, err)
-			assert.NotNil(t, node.Node)
-			WalkerOps{EnterProdNode: func(node ProdNode) Stopper {
-				if node.OneIdent().String() == test.rule {
-					dangers := frozen.NewSet()
-					for _, t := range node.AllTerm() {
-						dangers = dangers.Union(getSequenceDangerTerms(t))
-					}
-					expected := frozen.NewSetFromStrings(test.dangers...)
-
-					assert.True(t, dangers.EqualSet(expected),
-						"expect:%s actual:%s", expected.Elements(), dangers.Elements())
-					return Aborter
-				}
-				return nil
-			}}.Walk(node)
+			node, err := ParseString(test.grammar + rtdRules)
+			require.NoError(t, err)
+			require.NotNil(t, node.Node)
+			rule, has := newRecursionChecker(node).rules[test.rule]
+			require.True(t, has)
+			assert.Equal(t, test.dangers, rule.first)
 		})
 	}
 }
 
-func TestGnodeWalkRule(t *testing.T) {
-	rules := map[string]frozen.Set{
-		"a": frozen.NewSetFromStrings("b", "c"),
-		"b": frozen.NewSetFromStrings("c"),
-		"c": frozen.NewSetFromStrings("a", "d"),
-	}
-
-	gn := &gnode{next: map[string]*gnode{}}
-	for k := range rules {
-		gn.walkRule(k, &rules)
-	}
-
-	err := findPaths("", gn, frozen.NewSet(), nil)
-	assert.NotNil(t, err)
-}
-
 func TestCheckForRecursion(t *testing.T) {
 
 	for _, test := range []testData{
 		{"simple", "a -> 'a';", NoError},
 		{"simple", "a -> a;", PossibleCycleDetected},
 		{"harder", "a -> ('a'? | b); b -> c; c-> a;", PossibleCycleDetected},
+		{"required prefix", "a -> b a; b -> 'b';", NoError},
+		{"nullable prefix", "a -> b a; b -> 'b'*;", PossibleCycleDetected},
+		{"stack", "a -> @ '+' @ > '(' @ ')' | 'x';", NoError},
+		{"stack cycle", "a -> @ '+' > '('? @;", PossibleCycleDetected},
+		{"scoped", "a -> x { x -> '(' a ')'; };", NoError},
+		{"scoped cycle", "a -> x { x -> 'y'? a; };", PossibleCycleDetected},
+		{"macro", "a -> %!M('(') a; .macro M(x) { x };", NoError},
+		{"macro cycle", "a -> %!M('(') a; .macro M(x) { x? };", PossibleCycleDetected},
+		{"lookahead", "a -> !'(' a | '(';", PossibleCycleDetected},
+		{"lookahead cycle", "a -> &a 'x';", PossibleCycleDetected},
+		{"lookahead after input", "a -> 'x' &a | 'y';", NoError},
+		{"exclude", "a -> b - a; b -> 'b';", PossibleCycleDetected},
+		{"exclude after input", "a -> 'x' (b - a); b -> 'b';", NoError},
+		{"permutation", "a -> 'x' && a;", PossibleCycleDetected},
+		{"longest", "a -> 'x' || a;", PossibleCycleDetected},
+		{"permutation after input", "a -> 'x' ('y' && a) | 'z';", NoError},
+		{"nullable regexp", "a -> /{x*} a | 'x';", PossibleCycleDetected},
+		{"regexp", "a -> /{x+} a | 'x';", NoError},
+		{"nullable ref default", "a -> %x=() a | 'x';", PossibleCycleDetected},
+		{"ref default", "a -> %x=a 'x' | 'y';", PossibleCycleDetected},
+		{"parametric", "a -> b('x'); b(p) -> p? a;", PossibleCycleDetected},
 	} {
 		test := test
 		t.Run("TestValidationErrors-"+test.name, func(t *testing.T) {
@@ -82,3 +88,41 @@ func TestCheckForRecursion(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckForRecursionMinimalCycles(t *testing.T) {
+	node, err := ParseString("a -> b | c;\nb -> a | c;\nc -> a;\nd -> d;")
+	require.NoError(t, err)
+
+	err = checkForRecursion(node)
+	require.Error(t, err)
+	assert.Equal(t, `Possible cycle(s) detected:
+	a > b > a (a at 1:1, b at 2:1)
+	a > c > a (a at 1:1, c at 3:1)
+	d > d (d at 4:1)`, err.Error())
+}
+
+func syntheticGrammar(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "r%d -> r%d? r%d? 'x' | r%d* 'y';\n", i, i+1, i+2, i+3)
+	}
+	for i := n; i < n+3; i++ {
+		fmt.Fprintf(&sb, "r%d -> 'z';\n", i)
+	}
+	return sb.String()
+}
+
+func TestCheckForRecursionSynthetic(t *testing.T) {
+	node, err := ParseString(syntheticGrammar(200))
+	require.NoError(t, err)
+	assert.NoError(t, checkForRecursion(node))
+}
+
+func BenchmarkCheckForRecursion(b *testing.B) {
+	node, err := ParseString(syntheticGrammar(500))
+	require.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = checkForRecursion(node)
+	}
+}
@@ -0,0 +1,274 @@
+package wbnf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arr-ai/wbnf/dot"
+	"github.com/arr-ai/wbnf/parser"
+)
+
+// ScopeDelim separates the name of a rule nested inside a ScopedGrammar from
+// the name of the rule that introduced the scope, e.g. "pragma/import".
+const ScopeDelim = "/"
+
+// RuleGraph describes which rules of a grammar refer to which other rules.
+type RuleGraph struct {
+	// Start is the rule reachability is computed from, if any.
+	Start string `json:"start,omitempty"`
+	// Rules lists every rule, sorted by name. Magic rules such as .wrapRE are
+	// omitted.
+	Rules []*RuleNode `json:"rules"`
+	// SCCs lists the strongly connected components that contain a cycle,
+	// i.e. the sets of mutually recursive rules.
+	SCCs [][]string `json:"sccs"`
+	// Unreachable lists the rules that cannot be reached from Start.
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
+// RuleNode is a single rule in a RuleGraph.
+type RuleNode struct {
+	Name string   `json:"name"`
+	Refs []string `json:"refs"`
+	// SCC is the index into RuleGraph.SCCs of the cycle this rule is part of,
+	// or -1.
+	SCC int `json:"scc"`
+	// Leaf is true if the rule refers to no other rules.
+	Leaf bool `json:"leaf,omitempty"`
+	// Token is true if the rule is a leaf consisting of a single string or
+	// regexp.
+	Token       bool `json:"token,omitempty"`
+	Unreachable bool `json:"unreachable,omitempty"`
+}
+
+type ruleScope struct {
+	rules  map[parser.Rule]string
+	parent *ruleScope
+}
+
+func (s *ruleScope) lookup(rule parser.Rule) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if id, has := s.rules[rule]; has {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// NewRuleGraph builds the rule reference graph of g. Stacks are resolved
+// first, so each layer appears as its own rule (expr, expr@1, ...), and rules
+// nested in a ScopedGrammar are named parent/rule. If start is not empty, rules
+// that cannot be reached from it are marked as unreachable.
+func NewRuleGraph(g parser.Grammar, start parser.Rule) (*RuleGraph, error) {
+	rg := &RuleGraph{Start: string(start)}
+	nodes := map[string]*RuleNode{}
+	scope := rg.addGrammar(g, nil, "", nodes)
+
+	if start != "" {
+		if _, has := nodes[string(start)]; !has {
+			return nil, fmt.Errorf("start rule %q is not defined", start)
+		}
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rg.Rules = append(rg.Rules, nodes[id])
+	}
+
+	edges := func(id string) []string { return nodes[id].Refs }
+	for _, component := range stronglyConnected(ids, edges) {
+		if isCyclic(component, edges) {
+			for _, id := range component {
+				nodes[id].SCC = len(rg.SCCs)
+			}
+			rg.SCCs = append(rg.SCCs, component)
+		}
+	}
+
+	if start != "" {
+		reached := map[string]bool{}
+		var reach func(id string)
+		reach = func(id string) {
+			if !reached[id] {
+				reached[id] = true
+				for _, ref := range nodes[id].Refs {
+					reach(ref)
+				}
+			}
+		}
+		reach(string(start))
+		// The rules of .skip are used between the tokens of every rule.
+		if skip, has := g[parser.Skip]; has {
+			refs := map[string]bool{}
+			rg.collectRefs(skip, scope, "", refs, nodes)
+			for ref := range refs {
+				reach(ref)
+			}
+		}
+		for _, id := range ids {
+			if !reached[id] {
+				nodes[id].Unreachable = true
+				rg.Unreachable = append(rg.Unreachable, id)
+			}
+		}
+	}
+	return rg, nil
+}
+
+func (rg *RuleGraph) addGrammar(
+	g parser.Grammar, parent *ruleScope, prefix string, nodes map[string]*RuleNode,
+) *ruleScope {
+	g = g.ResolveStacks()
+	scope := &ruleScope{rules: map[parser.Rule]string{}, parent: parent}
+	for rule := range g {
+		if !strings.HasPrefix(string(rule), ".") {
+			scope.rules[rule] = prefix + string(rule)
+		}
+	}
+	for rule, term := range g {
+		id, has := scope.rules[rule]
+		if !has {
+			continue
+		}
+		node := &RuleNode{Name: id, Refs: []string{}, SCC: -1}
+		nodes[id] = node
+		refs := map[string]bool{}
+		rg.collectRefs(term, scope, id, refs, nodes)
+		for ref := range refs {
+			node.Refs = append(node.Refs, ref)
+		}
+		sort.Strings(node.Refs)
+		node.Leaf = len(node.Refs) == 0
+		_, lexical := term.(parser.Lexical)
+		node.Token = lexical || node.Leaf && isTokenTerm(term)
+	}
+	return scope
+}
+
+func (rg *RuleGraph) collectRefs(
+	term parser.Term, scope *ruleScope, owner string, refs map[string]bool, nodes map[string]*RuleNode,
+) {
+	switch t := term.(type) {
+	case parser.Rule:
+		if id, has := scope.lookup(t); has {
+			refs[id] = true
+		}
+	case parser.Seq:
+		for _, t := range t {
+			rg.collectRefs(t, scope, owner, refs, nodes)
+		}
+	case parser.Oneof:
+		for _, t := range t {
+			rg.collectRefs(t, scope, owner, refs, nodes)
+		}
+	case parser.Longest:
+		for _, t := range t {
+			rg.collectRefs(t, scope, owner, refs, nodes)
+		}
+	case parser.Perm:
+		for _, t := range t {
+			rg.collectRefs(t, scope, owner, refs, nodes)
+		}
+	case parser.Delim:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+		rg.collectRefs(t.Sep, scope, owner, refs, nodes)
+	case parser.Quant:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.Named:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.CutPoint:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.Lexical:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.LookAhead:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.Exclude:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+		rg.collectRefs(t.Except, scope, owner, refs, nodes)
+	case parser.REF:
+		if t.Default != nil {
+			rg.collectRefs(t.Default, scope, owner, refs, nodes)
+		}
+	case parser.Parametric:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.ExtPred:
+		rg.collectRefs(t.Term, scope, owner, refs, nodes)
+	case parser.Call:
+		rg.collectRefs(t.Rule, scope, owner, refs, nodes)
+		for _, t := range t.Args {
+			rg.collectRefs(t, scope, owner, refs, nodes)
+		}
+	case parser.ScopedGrammar:
+		inner := rg.addGrammar(t.Grammar, scope, owner+ScopeDelim, nodes)
+		rg.collectRefs(t.Term, inner, owner, refs, nodes)
+	}
+}
+
+func isTokenTerm(term parser.Term) bool {
+	switch t := term.(type) {
+	case parser.S, parser.CaselessS, parser.RE, parser.Bytes:
+		return true
+	case parser.Named:
+		return isTokenTerm(t.Term)
+	case parser.CutPoint:
+		return isTokenTerm(t.Term)
+	}
+	return false
+}
+
+// Dot renders the graph in the Graphviz DOT language. Mutually recursive rules
+// are grouped into clusters, tokens are shaded green, other leaves are drawn as
+// boxes and unreachable rules are dashed and grey.
+func (rg *RuleGraph) Dot() string {
+	g := dot.New("rules", "rankdir=LR", "node [shape=ellipse]")
+	for _, node := range rg.Rules {
+		attrs := map[string]string{}
+		switch {
+		case node.Token:
+			attrs["shape"] = "box"
+			attrs["style"] = "filled"
+			attrs["fillcolor"] = "palegreen"
+		case node.Leaf:
+			attrs["shape"] = "box"
+		}
+		if node.Unreachable {
+			attrs["style"] = "dashed"
+			attrs["color"] = "grey"
+			attrs["fontcolor"] = "grey"
+		}
+		if node.Name == rg.Start {
+			attrs["peripheries"] = "2"
+		}
+		g.NamedNode(node.Name, node.Name, attrs)
+	}
+	for i, component := range rg.SCCs {
+		g.Subgraph(fmt.Sprintf("cluster_scc%d", i), component, map[string]string{
+			"label": fmt.Sprintf("scc %d", i),
+			"style": "filled",
+			"color": "lightgrey",
+		})
+	}
+	for _, node := range rg.Rules {
+		for _, ref := range node.Refs {
+			var attrs map[string]string
+			if node.SCC >= 0 && node.SCC == rg.nodeSCC(ref) {
+				attrs = map[string]string{"color": "red"}
+			}
+			g.Edge(node.Name, ref, attrs)
+		}
+	}
+	return g.String()
+}
+
+func (rg *RuleGraph) nodeSCC(id string) int {
+	i := sort.Search(len(rg.Rules), func(i int) bool { return rg.Rules[i].Name >= id })
+	if i < len(rg.Rules) && rg.Rules[i].Name == id {
+		return rg.Rules[i].SCC
+	}
+	return -1
+}
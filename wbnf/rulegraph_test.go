@@ -0,0 +1,87 @@
+package wbnf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arr-ai/wbnf/parser"
+)
+
+func ruleGraph(t *testing.T, grammar, start string) *RuleGraph {
+	p, err := Compile(grammar, nil)
+	require.NoError(t, err)
+	rg, err := NewRuleGraph(p.Grammar(), parser.Rule(start))
+	require.NoError(t, err)
+	return rg
+}
+
+func TestRuleGraph(t *testing.T) {
+	rg := ruleGraph(t, `
+		a -> b c;
+		b -> "(" a ")" | c;
+		c -> /{\d+};
+		d -> c;
+		e -> "!" e | c;
+	`, "a")
+
+	names := []string{}
+	for _, node := range rg.Rules {
+		names = append(names, node.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, names)
+	assert.Equal(t, [][]string{{"a", "b"}, {"e"}}, rg.SCCs)
+	assert.Equal(t, []string{"d", "e"}, rg.Unreachable)
+
+	a, c, d := rg.Rules[0], rg.Rules[2], rg.Rules[3]
+	assert.Equal(t, []string{"b", "c"}, a.Refs)
+	assert.Equal(t, 0, a.SCC)
+	assert.True(t, c.Leaf)
+	assert.True(t, c.Token)
+	assert.Equal(t, -1, d.SCC)
+	assert.False(t, d.Leaf)
+	assert.True(t, d.Unreachable)
+}
+
+func TestRuleGraphStackAndScope(t *testing.T) {
+	rg := ruleGraph(t, `
+		expr -> @:"+" > "(" @ ")" | num;
+		num -> \d+;
+		top -> x {
+			x -> num y;
+			y -> "y";
+		};
+	`, "")
+
+	names := map[string][]string{}
+	for _, node := range rg.Rules {
+		names[node.Name] = node.Refs
+	}
+	assert.Equal(t, []string{"expr@1"}, names["expr"])
+	assert.Equal(t, []string{"expr", "num"}, names["expr@1"])
+	assert.Equal(t, []string{"top/x"}, names["top"])
+	assert.Equal(t, []string{"num", "top/y"}, names["top/x"])
+	assert.Equal(t, [][]string{{"expr", "expr@1"}}, rg.SCCs)
+	assert.Empty(t, rg.Unreachable)
+	assert.Contains(t, rg.Dot(), `subgraph "cluster_scc0"`)
+}
+
+func TestRuleGraphSkip(t *testing.T) {
+	rg := ruleGraph(t, `
+		a -> "a"+;
+		.skip -> ws | comment;
+		ws -> /{\s+};
+		comment -> "#" /{.*};
+		b -> "b";
+	`, "a")
+
+	assert.Equal(t, []string{"b"}, rg.Unreachable)
+}
+
+func TestRuleGraphUnknownStart(t *testing.T) {
+	p, err := Compile(`a -> "x";`, nil)
+	require.NoError(t, err)
+	_, err = NewRuleGraph(p.Grammar(), "b")
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package wbnf
+
+import "sort"
+
+// stronglyConnected returns the strongly connected components of a directed
+// graph using Tarjan's algorithm. Nodes and the members of each component are
+// visited in sorted order so the result is deterministic. Components are
+// returned in reverse topological order (a component appears before any
+// component that can reach it).
+func stronglyConnected(nodes []string, edges func(string) []string) [][]string {
+	sorted := append([]string{}, nodes...)
+	sort.Strings(sorted)
+
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var result [][]string
+
+	var visit func(v string)
+	visit = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+
+		next := append([]string{}, edges(v)...)
+		sort.Strings(next)
+		for _, w := range next {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			var component []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Strings(component)
+			result = append(result, component)
+		}
+	}
+
+	for _, v := range sorted {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	return result
+}
+
+// isCyclic reports whether a strongly connected component contains a cycle,
+// i.e. it has more than one member or its only member refers to itself.
+func isCyclic(component []string, edges func(string) []string) bool {
+	if len(component) > 1 {
+		return true
+	}
+	for _, w := range edges(component[0]) {
+		if w == component[0] {
+			return true
+		}
+	}
+	return false
+}
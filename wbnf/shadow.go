@@ -0,0 +1,324 @@
+package wbnf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arr-ai/wbnf/ast"
+	"github.com/arr-ai/wbnf/parser"
+)
+
+/*
+A Oneof commits to the first alternative that matches, so an alternative can be unreachable if an earlier one
+matches everything it would. For example:
+
+	a -> "x" | "xy";    // "xy" is never tried successfully, "x" always wins
+	a -> b? | "z";      // b? matches every input, even if only as nothing
+
+An earlier alternative i shadows a later alternative j when:
+ 1. i always succeeds, or
+ 2. i and j are the same term, or
+ 3. every input j matches begins with one of j's literal prefixes, and each of those prefixes begins with a
+    string that i is known to match.
+
+The analysis is deliberately conservative: anything it can't reason about (regexps that must match something,
+references, lookaheads, ...) is assumed not to shadow anything. Findings are warnings, since a grammar with unreachable alternatives
+still parses.
+*/
+func findShadowedAlternatives(tree GrammarNode) []error {
+	c := shadowChecker{gb: grammarBuilder{macros: map[string]PragmaMacrodefNode{}}}
+	WalkerOps{EnterPragmaMacrodefNode: func(node PragmaMacrodefNode) Stopper {
+		c.gb.macros[node.OneName().String()] = node
+		return NodeExiter
+	}}.Walk(tree)
+	c.grammar(tree, nil)
+	return c.warnings
+}
+
+type shadowChecker struct {
+	gb       grammarBuilder
+	warnings []error
+}
+
+type shadowScope struct {
+	g        parser.Grammar
+	nullable *parser.Nullability
+	parent   *shadowScope
+}
+
+func (s *shadowScope) lookup(rule parser.Rule) (parser.Term, bool) {
+	for ; s != nil; s = s.parent {
+		if term, has := s.g[rule]; has {
+			return term, true
+		}
+	}
+	return nil, false
+}
+
+func (c *shadowChecker) grammar(tree GrammarNode, parent *shadowScope) *shadowScope {
+	scope := &shadowScope{g: c.gb.buildGrammar(tree.Node).ResolveStacks(), parent: parent}
+	var outer *parser.Nullability
+	if parent != nil {
+		outer = parent.nullable
+	}
+	scope.nullable = parser.NewNullability(scope.g, outer)
+	for _, stmt := range tree.AllStmt() {
+		if prod := stmt.OneProd(); prod != nil {
+			for _, term := range prod.AllTerm() {
+				c.term(term, scope)
+			}
+		}
+	}
+	return scope
+}
+
+func (c *shadowChecker) term(term TermNode, scope *shadowScope) {
+	for _, g := range term.AllGrammar() {
+		scope = c.grammar(g, scope)
+	}
+	if term.OneOp() == "|" {
+		c.oneof(term.AllTerm(), scope)
+	}
+	for _, child := range term.AllTerm() {
+		c.term(child, scope)
+	}
+	if named := term.OneNamed(); named != nil {
+		if inner := named.OneAtom().OneTerm(); inner != nil {
+			c.term(*inner, scope)
+		}
+	}
+	for _, q := range term.AllQuant() {
+		if named := q.OneNamed(); named != nil {
+			if inner := named.OneAtom().OneTerm(); inner != nil {
+				c.term(*inner, scope)
+			}
+		}
+	}
+}
+
+func (c *shadowChecker) oneof(alts []TermNode, scope *shadowScope) {
+	terms := make([]parser.Term, 0, len(alts))
+	for _, alt := range alts {
+		terms = append(terms, c.gb.buildTerm(alt))
+	}
+	for j := 1; j < len(terms); j++ {
+		for i := 0; i < j; i++ {
+			if shadows(terms[i], terms[j], scope) {
+				c.warnings = append(c.warnings, validationError{
+					msg: strings.ReplaceAll(fmt.Sprintf("alternative %v at %s can never match, it is shadowed by %v at %s",
+						terms[j], position(alts[j].Node), terms[i], position(alts[i].Node)), "%", "%%"),
+					kind: ShadowedAlternative,
+				})
+				break
+			}
+		}
+	}
+}
+
+func shadows(earlier, later parser.Term, scope *shadowScope) bool {
+	if alwaysMatches(earlier, scope, map[parser.Rule]bool{}) || earlier.String() == later.String() {
+		return true
+	}
+	literals := matchedLiterals(earlier, scope, map[parser.Rule]bool{})
+	prefixes := literalPrefixes(later, scope, map[parser.Rule]bool{})
+	if len(literals) == 0 || len(prefixes) == 0 {
+		return false
+	}
+	for _, prefix := range prefixes {
+		covered := false
+		for _, literal := range literals {
+			if strings.HasPrefix(prefix, literal) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// alwaysMatches returns true if term succeeds on every input.
+func alwaysMatches(term parser.Term, scope *shadowScope, seen map[parser.Rule]bool) bool {
+	switch t := term.(type) {
+	case parser.S, parser.CaselessS, parser.RE:
+		// A token that can match nothing succeeds everywhere, if only by
+		// doing so.
+		return scope.nullable.Term(t)
+	case parser.Rule:
+		if inner, has := scope.lookup(t); has && !seen[t] {
+			seen[t] = true
+			defer delete(seen, t)
+			return alwaysMatches(inner, scope, seen)
+		}
+	case parser.Seq:
+		for _, t := range t {
+			if !alwaysMatches(t, scope, seen) {
+				return false
+			}
+		}
+		return true
+	case parser.Perm:
+		for _, t := range t {
+			if !alwaysMatches(t, scope, seen) {
+				return false
+			}
+		}
+		return true
+	case parser.Oneof:
+		for _, t := range t {
+			if alwaysMatches(t, scope, seen) {
+				return true
+			}
+		}
+	case parser.Longest:
+		for _, t := range t {
+			if alwaysMatches(t, scope, seen) {
+				return true
+			}
+		}
+	case parser.Quant:
+		return t.Min == 0 && t.MinRef == "" || alwaysMatches(t.Term, scope, seen)
+	case parser.Named:
+		return alwaysMatches(t.Term, scope, seen)
+	case parser.CutPoint:
+		return alwaysMatches(t.Term, scope, seen)
+	case parser.Lexical:
+		return alwaysMatches(t.Term, scope, seen)
+	}
+	return false
+}
+
+// matchedLiterals returns strings that term is sure to match if the input
+// begins with them.
+func matchedLiterals(term parser.Term, scope *shadowScope, seen map[parser.Rule]bool) []string {
+	switch t := term.(type) {
+	case parser.S:
+		return []string{string(t)}
+	case parser.Rule:
+		if inner, has := scope.lookup(t); has && !seen[t] {
+			seen[t] = true
+			defer delete(seen, t)
+			return matchedLiterals(inner, scope, seen)
+		}
+	case parser.Seq:
+		if len(t) == 1 {
+			return matchedLiterals(t[0], scope, seen)
+		}
+	case parser.Oneof:
+		var out []string
+		for _, t := range t {
+			out = append(out, matchedLiterals(t, scope, seen)...)
+		}
+		return out
+	case parser.Longest:
+		var out []string
+		for _, t := range t {
+			out = append(out, matchedLiterals(t, scope, seen)...)
+		}
+		return out
+	case parser.Quant:
+		if t.Min <= 1 && t.MinRef == "" {
+			return matchedLiterals(t.Term, scope, seen)
+		}
+	case parser.Named:
+		return matchedLiterals(t.Term, scope, seen)
+	case parser.CutPoint:
+		return matchedLiterals(t.Term, scope, seen)
+	case parser.Lexical:
+		return matchedLiterals(t.Term, scope, seen)
+	}
+	return nil
+}
+
+// literalPrefixes returns strings of which every input that term matches
+// begins with at least one, or nil if there are no such strings.
+func literalPrefixes(term parser.Term, scope *shadowScope, seen map[parser.Rule]bool) []string {
+	switch t := term.(type) {
+	case parser.S:
+		if t != "" {
+			return []string{string(t)}
+		}
+	case parser.Rule:
+		if inner, has := scope.lookup(t); has && !seen[t] {
+			seen[t] = true
+			defer delete(seen, t)
+			return literalPrefixes(inner, scope, seen)
+		}
+	case parser.Seq:
+		if len(t) > 0 {
+			return literalPrefixes(t[0], scope, seen)
+		}
+	case parser.Oneof:
+		return unionPrefixes(t, scope, seen)
+	case parser.Longest:
+		return unionPrefixes(t, scope, seen)
+	case parser.Quant:
+		if t.Min > 0 {
+			return literalPrefixes(t.Term, scope, seen)
+		}
+	case parser.Delim:
+		if !t.CanStartWithSep {
+			return literalPrefixes(t.Term, scope, seen)
+		}
+	case parser.Named:
+		return literalPrefixes(t.Term, scope, seen)
+	case parser.CutPoint:
+		return literalPrefixes(t.Term, scope, seen)
+	case parser.Lexical:
+		return literalPrefixes(t.Term, scope, seen)
+	case parser.Exclude:
+		return literalPrefixes(t.Term, scope, seen)
+	case parser.ExtPred:
+		return literalPrefixes(t.Term, scope, seen)
+	}
+	return nil
+}
+
+func unionPrefixes(terms []parser.Term, scope *shadowScope, seen map[parser.Rule]bool) []string {
+	var out []string
+	for _, t := range terms {
+		prefixes := literalPrefixes(t, scope, seen)
+		if prefixes == nil {
+			return nil
+		}
+		out = append(out, prefixes...)
+	}
+	return out
+}
+
+// position returns the line and column of the start of node in its source.
+func position(node ast.Node) string {
+	first, found := firstLeaf(node)
+	if !found {
+		return "?"
+	}
+	return first.Position().String()
+}
+
+func firstLeaf(node ast.Node) (parser.Scanner, bool) {
+	var first parser.Scanner
+	found := false
+	consider := func(node ast.Node) {
+		if s, ok := firstLeaf(node); ok && (!found || s.Offset() < first.Offset()) {
+			first, found = s, true
+		}
+	}
+	switch n := node.(type) {
+	case ast.Leaf:
+		return parser.Scanner(n), true
+	case ast.Branch:
+		for _, children := range n {
+			switch c := children.(type) {
+			case ast.One:
+				consider(c.Node)
+			case ast.Many:
+				for _, child := range c {
+					consider(child)
+				}
+			}
+		}
+	}
+	return first, found
+}
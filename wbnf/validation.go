@@ -3,10 +3,12 @@ package wbnf
 import (
 	"fmt"
 	"regexp"
-	"strconv"
+	"sort"
+	"strings"
 
 	"github.com/arr-ai/frozen"
 
+	"github.com/arr-ai/wbnf/ast"
 	"github.com/arr-ai/wbnf/parser"
 )
 
@@ -49,11 +51,20 @@ func validate(tree GrammarNode) error {
 	v := validator{
 		knownRules: rules,
 		macros:     macros,
+		params:     findParametricRules(tree),
 	}
 	v.walk(tree)
+	v.validateCuts(tree)
+	v.validateCounts(tree)
 
-	if cycles := checkForRecursion(tree); cycles != nil {
-		v.err = append(v.err, cycles)
+	if len(v.err) == 0 {
+		// Only a valid tree can be built into a grammar.
+		if cycles := checkForRecursion(tree); cycles != nil {
+			v.err = append(v.err, cycles)
+		}
+		g := grammarBuilder{macros: macros}.buildGrammar(tree.Node)
+		v.validateLoops(g)
+		v.validateIndents(g)
 	}
 
 	if len(v.err) == 0 {
@@ -62,6 +73,44 @@ func validate(tree GrammarNode) error {
 	return &v
 }
 
+// Warnings returns the problems found in tree that don't stop it from
+// compiling, such as alternatives that can never match.
+func Warnings(tree GrammarNode) []error {
+	return append(findShadowedAlternatives(tree), findCaselessStringsAfterI(tree)...)
+}
+
+// findCaselessStringsAfterI warns of each case-insensitive string in a grammar
+// that defines a rule named i, as i"x" was read as the rule i followed by "x"
+// before strings could be case-insensitive.
+func findCaselessStringsAfterI(tree GrammarNode) []error {
+	definesI := false
+	var caseless []StrNode
+	WalkerOps{
+		EnterProdNode: func(node ProdNode) Stopper {
+			if node.OneIdent().String() == "i" {
+				definesI = true
+			}
+			return nil
+		},
+		EnterStrNode: func(node StrNode) Stopper {
+			if strings.HasPrefix(node.String(), "i") {
+				caseless = append(caseless, node)
+			}
+			return nil
+		},
+	}.Walk(tree)
+	if !definesI {
+		return nil
+	}
+	warnings := make([]error, 0, len(caseless))
+	for _, str := range caseless {
+		warnings = append(warnings, validationError{s: str.Scanner(),
+			msg:  "string %s is case-insensitive, not rule i followed by %s", kind: CaselessStringAfterI,
+			args: []interface{}{str.String()[1:]}})
+	}
+	return warnings
+}
+
 type validationErrorKind int
 
 const (
@@ -75,6 +124,18 @@ const (
 	PossibleCycleDetected
 	NotAMacro
 	IncorrectMacroArgCount
+	RepeatedPermutationMember // something like `a -> x* && y;`, members may only be optional
+	ShadowedAlternative       // something like `a -> "x" | "xy";`, reported as a warning
+	NullableRepetition        // something like `a -> ("x"?)*;`, the repeated term can match nothing
+	InvalidEscape             // something like `a -> "\q";`
+	InvalidRange              // something like `a -> 'z'..'a';` or `a -> "ab"..'z';`
+	MisplacedCut              // something like `a -> ~ "x";`, a cut must follow a term in a sequence
+	NotAParametricRule        // something like `a -> 'a'; x -> a('b', 'c');`
+	IncorrectRuleArgCount     // something like `a(x, y) -> x y; z -> a('b');`
+	UnboundCount              // something like `a -> .{%n} n=\d+;`, the count must be matched first
+	InvalidRefModifier        // something like `a -> x=\w+ %x.upper;`
+	MisplacedIndent           // something like `a -> ":" %indent?;`, %indent must come before the rest of its block
+	CaselessStringAfterI      // something like `a -> i"x"; i -> "i";`, reported as a warning
 )
 
 type validationError struct {
@@ -91,16 +152,30 @@ func (v validationError) Error() string {
 		if len(v.args) > 0 {
 			args = append(args, v.args...)
 		}
-		args = append(args, v.s.Offset())
+		args = append(args, v.s.Position())
 
-		return fmt.Sprintf(v.msg+"@ %d", args...)
+		return fmt.Sprintf(v.msg+"@ %v", args...)
 	}
 	return fmt.Sprintf(v.msg, args...)
 }
 
+// findParametricRules returns the number of parameters of each rule that
+// takes any.
+func findParametricRules(tree GrammarNode) map[string]int {
+	params := map[string]int{}
+	WalkerOps{EnterProdNode: func(node ProdNode) Stopper {
+		if p := node.OneParams(); p != nil {
+			params[node.OneIdent().String()] = len(p.AllIdent())
+		}
+		return nil
+	}}.Walk(tree)
+	return params
+}
+
 type validator struct {
 	knownRules frozen.Set
 	macros     map[string]PragmaMacrodefNode
+	params     map[string]int
 	err        []error
 }
 
@@ -110,8 +185,13 @@ func (v *validator) walk(node IsWalkableType) {
 		EnterQuantNode:          v.validateQuant,
 		EnterNamedNode:          v.validateNamed,
 		EnterTermNode:           v.validateTerm,
+		EnterProdNode:           v.validateProd,
+		EnterCallNode:           v.validateCall,
 		EnterPragmaMacrodefNode: v.validateMacro,
 		EnterMacrocallNode:      v.validateMacroCall,
+		EnterPragmaNocutsNode:   v.validateNocuts,
+		EnterPragmaTokenNode:    v.validateToken,
+		EnterPragmaOffsideNode:  v.validateOffside,
 	}
 	ops.Walk(node)
 }
@@ -125,9 +205,17 @@ func (v *validator) validateTerm(tree TermNode) Stopper {
 		//fixme: This doesnt work for scoped grammars yet, abort!
 		return NodeExiter
 	}
+	if tree.OneOp() == "&&" {
+		v.validatePermutation(tree)
+	}
 	if tree.OneOp() == "" {
 		names := map[string]bool{}
 		for _, child := range tree.AllTerm() {
+			// Skip the intermediate levels of the term stack that only hold a
+			// single term.
+			for len(child.AllTerm()) == 1 && child.OneOp() == "" {
+				child = child.AllTerm()[0]
+			}
 			if name := child.OneNamed(); name != nil {
 				if x := name.OneIdent().String(); x != "" {
 					if _, has := names[x]; has {
@@ -142,6 +230,130 @@ func (v *validator) validateTerm(tree TermNode) Stopper {
 	return nil
 }
 
+func (v *validator) validatePermutation(tree TermNode) {
+	for _, child := range tree.AllTerm() {
+		for len(child.AllTerm()) == 1 && child.OneOp() == "" {
+			child = child.AllTerm()[0]
+		}
+		var quants []QuantNode
+		for _, q := range child.AllQuant() {
+			// Predicates only check what the member matched.
+			if q.OnePred() == nil {
+				quants = append(quants, q)
+			}
+		}
+		for _, q := range quants {
+			if q.Choice() != 0 || q.OneOp() != "?" || len(quants) > 1 {
+				v.err = append(v.err, validationError{
+					msg:  "permutation members may only be optional (?), not repeated",
+					kind: RepeatedPermutationMember})
+				return
+			}
+		}
+	}
+}
+
+// validateCuts checks that every cut (~) follows a term in a sequence, which is
+// the term the parse commits to.
+func (v *validator) validateCuts(tree GrammarNode) {
+	placed := map[int]bool{}
+	mark := func(seq []TermNode) {
+		for i := 1; i < len(seq); i++ {
+			if cut, isCut := cutToken(seq[i]); isCut {
+				if _, prevIsCut := cutToken(seq[i-1]); !prevIsCut {
+					placed[cut.Offset()] = true
+				}
+			}
+		}
+	}
+	WalkerOps{
+		EnterProdNode: func(node ProdNode) Stopper {
+			mark(node.AllTerm())
+			return nil
+		},
+		EnterTermNode: func(node TermNode) Stopper {
+			if node.OneOp() == "" {
+				mark(node.AllTerm())
+			}
+			return nil
+		},
+		EnterAtomNode: func(node AtomNode) Stopper {
+			if cut := ast.First(node.Node, "cut"); cut != nil {
+				if s := ast.First(cut, "").Scanner(); !placed[s.Offset()] {
+					v.err = append(v.err, validationError{s: s,
+						msg: "cut '%s' must follow a term in a sequence", kind: MisplacedCut})
+				}
+			}
+			return nil
+		},
+	}.Walk(tree)
+}
+
+func (v *validator) validateOffside(node PragmaOffsideNode) Stopper {
+	if comment := node.OneComment(); comment != nil {
+		if _, err := regexp.Compile(string(buildRE(comment.String()))); err != nil {
+			v.err = append(v.err, validationError{s: comment.Scanner(),
+				msg: "regex '%s' is not valid, %s", kind: InvalidRegex, args: []interface{}{err}})
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateNocuts(node PragmaNocutsNode) Stopper {
+	v.validateRuleNames(node.AllRule())
+	return nil
+}
+
+func (v *validator) validateToken(node PragmaTokenNode) Stopper {
+	v.validateRuleNames(node.AllRule())
+	return nil
+}
+
+func (v *validator) validateRuleNames(rules []IdentNode) {
+	for _, rule := range rules {
+		if !v.knownRules.Has(rule.String()) {
+			v.err = append(v.err, validationError{s: rule.Scanner(),
+				msg: "identifier '%s' is not a defined rule", kind: UnknownRule})
+		}
+	}
+}
+
+func (v *validator) validateLoops(g parser.Grammar) {
+	loops := g.NullableLoops()
+	rules := make([]string, 0, len(loops))
+	for rule := range loops {
+		rules = append(rules, string(rule))
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		for _, loop := range loops[parser.Rule(rule)] {
+			v.err = append(v.err, validationError{
+				msg: strings.ReplaceAll(fmt.Sprintf("rule %s: %v repeats a term that can match nothing",
+					rule, loop), "%", "%%"),
+				kind: NullableRepetition})
+		}
+	}
+}
+
+// validateIndents checks that every %indent is followed by more of the
+// sequence it appears in, which is the block it sets the level for.
+func (v *validator) validateIndents(g parser.Grammar) {
+	indents := g.MisplacedIndents()
+	rules := make([]string, 0, len(indents))
+	for rule := range indents {
+		rules = append(rules, string(rule))
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		for _, indent := range indents[parser.Rule(rule)] {
+			v.err = append(v.err, validationError{
+				msg: strings.ReplaceAll(fmt.Sprintf("rule %s: %v must be followed by the rest of its block in the same sequence",
+					rule, indent), "%", "%%"),
+				kind: MisplacedIndent})
+		}
+	}
+}
+
 func (v *validator) validateNamed(tree NamedNode) Stopper {
 	if x := tree.OneIdent(); x != nil {
 		if v.knownRules.Has(x.String()) {
@@ -158,8 +370,17 @@ func (v *validator) validateAtom(tree AtomNode) Stopper {
 			if !v.knownRules.Has(ident.String()) {
 				v.err = append(v.err, validationError{s: tree.OneIdent().Scanner(),
 					msg: "identifier '%s' is not a defined rule", kind: UnknownRule})
+			} else if n, has := v.params[ident.String()]; has {
+				v.err = append(v.err, validationError{s: tree.OneIdent().Scanner(),
+					msg: "rule %s expects %d args, given 0", kind: IncorrectRuleArgCount, args: []interface{}{n}})
 			}
 		}
+	} else if x := tree.OneStr(); x != nil {
+		v.validateString(x)
+	} else if x := tree.OneRef(); x != nil {
+		v.validateRefMods(x.AllRefmod())
+	} else if x := tree.OneRange(); x != nil {
+		v.validateRange(*x)
 	} else if x := tree.OneRe(); x != nil {
 		if _, err := regexp.Compile(x.String()); err != nil {
 			v.err = append(v.err, validationError{s: tree.OneRe().Scanner(),
@@ -169,37 +390,180 @@ func (v *validator) validateAtom(tree AtomNode) Stopper {
 	return nil
 }
 
-func (v *validator) validateQuant(tree QuantNode) Stopper {
-	switch tree.Choice() {
-	case 0:
-	case 1:
-		min := 0
-		max := 0
-		if x := tree.OneMin().String(); x != "" {
-			val, err := strconv.Atoi(x)
-			if err != nil {
-				panic("should not get here")
+func (v *validator) validateRefMods(mods []RefmodNode) {
+	for i, mod := range mods {
+		name := mod.OneName()
+		arg := mod.OneArg()
+		switch name.String() {
+		case parser.RefMirror, parser.RefFold:
+			if arg != nil {
+				v.err = append(v.err, validationError{s: arg.Scanner(),
+					msg: "ref modifier argument %s is not expected", kind: InvalidRefModifier})
 			}
-			min = val
+		case parser.RefStrip, parser.RefRE:
+			if arg == nil {
+				v.err = append(v.err, validationError{s: name.Scanner(),
+					msg: "ref modifier '%s' expects an argument", kind: InvalidRefModifier})
+			} else if v.validateString(arg) && name.String() == parser.RefRE {
+				template := strings.ReplaceAll(parseString(arg.String()), "$0", "")
+				if _, err := regexp.Compile(template); err != nil {
+					v.err = append(v.err, validationError{s: arg.Scanner(),
+						msg: "regex template %s is not valid, %s", kind: InvalidRegex, args: []interface{}{err}})
+				}
+			}
+		default:
+			v.err = append(v.err, validationError{s: name.Scanner(),
+				msg: "'%s' is not a ref modifier", kind: InvalidRefModifier})
+			continue
 		}
-		if x := tree.OneMax().String(); x != "" {
-			val, err := strconv.Atoi(x)
-			if err != nil {
-				panic("should not get here")
+		if i < len(mods)-1 && (name.String() == parser.RefFold || name.String() == parser.RefRE) {
+			v.err = append(v.err, validationError{s: name.Scanner(),
+				msg: "ref modifier '%s' must come last", kind: InvalidRefModifier})
+		}
+	}
+}
+
+func (v *validator) validateString(str *StrNode) bool {
+	if _, err := unquote(str.String()); err != nil {
+		e := err.(escapeError)
+		v.err = append(v.err, validationError{s: *str.Scanner().Slice(e.offset, e.offset+e.size),
+			msg: "string escape '%s' is not valid, %s", kind: InvalidEscape, args: []interface{}{e.msg}})
+		return false
+	}
+	return true
+}
+
+func (v *validator) validateRange(node RangeNode) {
+	lo, hi := node.OneLo(), node.OneHi()
+	var bounds [2]rune
+	for i, bound := range []struct {
+		str       *StrNode
+		codepoint *CodepointNode
+	}{{lo.OneStr(), lo.OneCodepoint()}, {hi.OneStr(), hi.OneCodepoint()}} {
+		var token ast.Node
+		if bound.str != nil {
+			if !v.validateString(bound.str) {
+				return
 			}
-			max = val
+			token = bound.str.Node
+		} else {
+			token = bound.codepoint.Node
+		}
+		r, _, err := parseRangeBound(bound.str, bound.codepoint)
+		if err != nil {
+			v.err = append(v.err, validationError{s: token.Scanner(),
+				msg: "range bound %s is not valid, %s", kind: InvalidRange, args: []interface{}{err}})
+			return
 		}
-		if min != 0 && max != 0 {
+		if i == 1 && r < bounds[0] {
+			v.err = append(v.err, validationError{s: token.Scanner(),
+				msg: "range bound %s is not valid, it comes before U+%04X", kind: InvalidRange,
+				args: []interface{}{bounds[0]}})
+			return
+		}
+		bounds[i] = r
+	}
+}
+
+func (v *validator) validateQuant(tree QuantNode) Stopper {
+	switch tree.Choice() {
+	case 0:
+	case 1:
+		min, minRef := parseBound(tree.OneMin().String())
+		max, maxRef := parseBound(tree.OneMax().String())
+		if minRef == "" && maxRef == "" && min != 0 && max != 0 {
 			if max < min {
 				v.err = append(v.err, validationError{
 					msg: fmt.Sprintf("quant: min (%d) > max (%d)", min, max), kind: MinMaxQuantError})
 			}
 		}
 	case 2:
+	case 4:
+		if count, ref := parseBound(tree.OneCount().String()); ref == "" && count == 0 {
+			v.err = append(v.err, validationError{s: tree.OneCount().Scanner(),
+				msg: "quant: count %s must be at least 1", kind: MinMaxQuantError})
+		}
 	}
 	return nil
 }
 
+// validateCounts checks that every count (%name) in a quant refers to a term
+// that was matched earlier in the same sequence, or in a sequence enclosing it.
+func (v *validator) validateCounts(tree GrammarNode) {
+	WalkerOps{EnterProdNode: func(node ProdNode) Stopper {
+		v.validateSeqCounts(node.AllTerm(), map[string]bool{})
+		return NodeExiter
+	}}.Walk(tree)
+}
+
+func (v *validator) validateSeqCounts(seq []TermNode, bound map[string]bool) {
+	inner := make(map[string]bool, len(bound))
+	for name := range bound {
+		inner[name] = true
+	}
+	for _, term := range seq {
+		v.validateTermCounts(term, inner)
+		if name := boundName(term); name != "" {
+			inner[name] = true
+		}
+	}
+}
+
+func (v *validator) validateTermCounts(term TermNode, bound map[string]bool) {
+	if len(term.AllGrammar()) != 0 {
+		return
+	}
+	if children := term.AllTerm(); len(children) > 0 {
+		if term.OneOp() == "" {
+			v.validateSeqCounts(children, bound)
+		} else {
+			for _, child := range children {
+				v.validateTermCounts(child, bound)
+			}
+		}
+		return
+	}
+	if inner := term.OneNamed().OneAtom().OneTerm(); inner != nil {
+		v.validateTermCounts(*inner, bound)
+	}
+	for _, q := range term.AllQuant() {
+		for _, b := range []*BoundNode{q.OneMin(), q.OneMax(), q.OneCount()} {
+			if _, ref := parseBound(b.String()); ref != "" && !bound[ref] {
+				v.err = append(v.err, validationError{s: b.Scanner(),
+					msg: "count '%s' does not refer to a term matched before it", kind: UnboundCount})
+			}
+		}
+	}
+}
+
+// boundName returns the name under which the match of term is visible to the
+// terms that follow it in a sequence, if any.
+func boundName(term TermNode) string {
+	for len(term.AllTerm()) == 1 && term.OneOp() == "" {
+		term = term.AllTerm()[0]
+	}
+	named := term.OneNamed()
+	if named == nil || term.OneLookahead() != "" {
+		return ""
+	}
+	for _, q := range term.AllQuant() {
+		if q.Choice() == 2 || q.Choice() == 3 {
+			return ""
+		}
+	}
+	if x := named.OneIdent().String(); x != "" {
+		return x
+	}
+	atom := named.OneAtom()
+	if atom.Choice() == 3 {
+		return atom.OneIdent().String()
+	}
+	if inner := atom.OneTerm(); inner != nil {
+		return boundName(*inner)
+	}
+	return ""
+}
+
 func (v *validator) validateMacro(node PragmaMacrodefNode) Stopper {
 	prevRules := v.knownRules
 	defer func() { v.knownRules = prevRules }()
@@ -216,6 +580,46 @@ func (v *validator) validateMacro(node PragmaMacrodefNode) Stopper {
 	return NodeExiter
 }
 
+func (v *validator) validateProd(node ProdNode) Stopper {
+	params := node.OneParams()
+	if params == nil {
+		return nil
+	}
+	prevRules := v.knownRules
+	defer func() { v.knownRules = prevRules }()
+
+	for _, param := range params.AllIdent() {
+		if v.knownRules.Has(param.String()) {
+			v.err = append(v.err, validationError{s: param.Scanner(),
+				msg: "rule parameter '%s' clashes with a defined rule", kind: NameClashesWithRule})
+		} else {
+			v.knownRules = v.knownRules.With(param.String())
+		}
+	}
+	for _, term := range node.AllTerm() {
+		v.walk(term)
+	}
+	return NodeExiter
+}
+
+func (v *validator) validateCall(node CallNode) Stopper {
+	name := node.OneName()
+	switch n, has := v.params[name.String()]; {
+	case !v.knownRules.Has(name.String()):
+		v.err = append(v.err, validationError{s: name.Scanner(),
+			msg: "identifier '%s' is not a defined rule", kind: UnknownRule})
+	case !has && len(node.AllTerm()) > 1:
+		// With one argument or none, it is the rule followed by a group.
+		v.err = append(v.err, validationError{s: name.Scanner(),
+			msg: "Attempting to call %s which is not a parametric rule", kind: NotAParametricRule})
+	case has && n != len(node.AllTerm()):
+		v.err = append(v.err, validationError{s: name.Scanner(),
+			msg: "rule %s expects %d args, given %d", kind: IncorrectRuleArgCount,
+			args: []interface{}{n, len(node.AllTerm())}})
+	}
+	return nil
+}
+
 func (v *validator) validateMacroCall(node MacrocallNode) Stopper {
 	macro, has := v.macros[node.OneName().String()]
 	if !has {
@@ -31,6 +31,71 @@ func TestValidationErrors(t *testing.T) {
 		{"calling a rule", "a -> 'a'; x -> %!a('a');", NotAMacro},
 		{"macro arg count", "a -> %!Foo('a', 'b'); .macro Foo(b) { b };", IncorrectMacroArgCount},
 		{"macro arg count", "a -> %!Foo(); .macro Foo(b) { b };", IncorrectMacroArgCount},
+		{"permutation", "a -> 'x' && 'y'? && 'z';", NoError},
+		{"repeated permutation member", "a -> 'x'* && 'y';", RepeatedPermutationMember},
+		{"delimited permutation member", "a -> 'x' && 'y':',';", RepeatedPermutationMember},
+		{"checked permutation member", "a -> 'x'? &%%p && 'y';", NoError},
+		{"checked repeated permutation member", "a -> 'x'* &%%p && 'y';", RepeatedPermutationMember},
+
+		{"nullable repetition", "a -> ('x'?)*;", NullableRepetition},
+		{"nullable rule repetition", "a -> b+; b -> 'x'*;", NullableRepetition},
+		{"nullable delim", "a -> ('x'?):(','?);", NullableRepetition},
+		{"bounded nullable repetition", "a -> ('x'?){,3};", NoError},
+		{"nullable delim term", "a -> ('x'?):',';", NoError},
+
+		{"escapes", `a -> "\u{1F600}\u00e9\U0001F600\x41\101\n";`, NoError},
+		{"unknown escape", `a -> "\q";`, InvalidEscape},
+		{"short unicode escape", `a -> "\u12";`, InvalidEscape},
+		{"surrogate escape", `a -> "\uD800";`, InvalidEscape},
+		{"long braced escape", `a -> "\u{1234567}";`, InvalidEscape},
+		{"bad default escape", `a -> %x="\q";`, InvalidEscape},
+		{"range", "a -> 'a'..'z' | U+0391..U+03A9;", NoError},
+		{"backwards range", "a -> 'z'..'a';", InvalidRange},
+		{"multi-character range", "a -> 'ab'..'z';", InvalidRange},
+		{"out of range code point", "a -> U+0..U+110000;", InvalidRange},
+
+		{"cut", "a -> 'x' ~ 'y' ('z' ~)?;", NoError},
+		{"leading cut", "a -> ~ 'x';", MisplacedCut},
+		{"double cut", "a -> 'x' ~ ~;", MisplacedCut},
+		{"cut alternative", "a -> 'x' | ~;", MisplacedCut},
+		{"quantified cut", "a -> 'x' ~*;", MisplacedCut},
+		{"nocuts", "a -> 'x'; .nocuts a;", NoError},
+		{"nocuts unknown rule", "a -> 'x'; .nocuts b;", UnknownRule},
+		{"token", "A -> B '.' B; B -> \\d+; .token A;", NoError},
+		{"token unknown rule", "a -> 'x'; .token b;", UnknownRule},
+
+		{"parametric rule", "a -> b('x', %y='y'); b(p, q) -> p q+;", NoError},
+		{"rule param clashes with rule", "a -> b('x'); b(c) -> c; c -> 'c';", NameClashesWithRule},
+		{"param outside its rule", "a -> b('x') p; b(p) -> p;", UnknownRule},
+		{"calling an undefined rule", "a -> b('x');", UnknownRule},
+		{"calling a plain rule", "a -> b('x', 'y'); b -> 'b';", NotAParametricRule},
+		{"rule arg count", "a -> b('x'); b(p, q) -> p q;", IncorrectRuleArgCount},
+		{"parametric rule without args", "a -> b; b(p) -> p;", IncorrectRuleArgCount},
+
+		{"count", "a -> n=\\d+ ':' .{%n} (b{%n} | 'x'{%n,}) 'y'{1,%n}; b -> 'b';", NoError},
+		{"rule count", "a -> n ':' .{%n}; n -> \\d+;", NoError},
+		{"grouped count", "a -> (n=\\d+)? ':' .{%n};", NoError},
+		{"count before its term", "a -> .{%n} n=\\d+;", UnboundCount},
+		{"count of an inner term", "a -> (n=\\d+ ':') .{%n};", UnboundCount},
+		{"count of a delimited term", "a -> n=\\d+:',' 'x'{%n};", UnboundCount},
+		{"zero count", "a -> 'x'{0};", MinMaxQuantError},
+
+		{"ref modifiers", "a -> x=\\w+ %x.mirror.strip('-').fold %x.re(`\\s*$0`) %y=b; b -> 'b';", NoError},
+		{"unknown ref modifier", "a -> x=\\w+ %x.upper;", InvalidRefModifier},
+		{"ref modifier without arg", "a -> x=\\w+ %x.strip;", InvalidRefModifier},
+		{"ref modifier with arg", "a -> x=\\w+ %x.mirror('x');", InvalidRefModifier},
+		{"ref modifier after fold", "a -> x=\\w+ %x.fold.mirror;", InvalidRefModifier},
+		{"bad ref regex template", "a -> x=\\w+ %x.re('[$0');", InvalidRegex},
+		{"unknown rule in ref default", "a -> %x=b;", UnknownRule},
+		{"offside", "a -> 'a' %indent a %dedent | 'b' %newline; .offside /{#.*};", NoError},
+		{"offside indent in sub-seq", "a -> 'a' (%indent a)+ %dedent | 'b' %newline; .offside /{#.*};", NoError},
+		{"offside indent in sub-rule", "a -> 'a' i a %dedent | 'b' %newline; i -> %indent; .offside /{#.*};", MisplacedIndent},
+		{"offside indent in quant", "a -> 'a' %indent? a %dedent | 'b' %newline; .offside /{#.*};", MisplacedIndent},
+		{"offside indent ends alternative", "a -> ('a' %indent | 'c') a %dedent | 'b' %newline; .offside /{#.*};",
+			MisplacedIndent},
+		{"indent ref without offside", "a -> indent=' '* %indent;", NoError},
+		{"bad offside comment", "a -> 'a' %newline; .offside /{[};", InvalidRegex},
+
 		// Wish-list validity checks:
 
 		// Should fail because op would return different types
@@ -61,3 +126,84 @@ func TestValidationErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestShadowedAlternatives(t *testing.T) {
+	for _, test := range []struct {
+		name, grammar string
+		warnings      []string
+	}{
+		{"distinct", "a -> 'x' | 'y';", nil},
+		{"longer first", "a -> 'xy' | 'x';", nil},
+		{"prefix", "a -> 'x' | 'xy';",
+			[]string{`alternative "xy" at 1:12 can never match, it is shadowed by "x" at 1:6`}},
+		{"duplicate", "a -> b | b; b -> 'b';",
+			[]string{`alternative b at 1:10 can never match, it is shadowed by b at 1:6`}},
+		{"optional", "a -> 'x'? | 'y';",
+			[]string{`alternative "y" at 1:13 can never match, it is shadowed by "x"? at 1:6`}},
+		{"sequence", "a -> 'x' | 'x' b; b -> 'b';",
+			[]string{`alternative ("x" b) at 1:12 can never match, it is shadowed by "x" at 1:6`}},
+		{"via rule", "a -> b | 'yz'; b -> 'x' | 'y';",
+			[]string{`alternative "yz" at 1:10 can never match, it is shadowed by b at 1:6`}},
+		{"regexp", "a -> /{x} | 'x';", nil},
+		{"nullable regexp", "a -> /{x*} | 'x';",
+			[]string{`alternative "x" at 1:14 can never match, it is shadowed by /x*/ at 1:6`}},
+		{"stack", "a -> @ '+' @ > 'x' | 'xx';",
+			[]string{`alternative "xx" at 1:22 can never match, it is shadowed by "x" at 1:16`}},
+		{"scoped", "a -> (x | 'k') { x -> 'k'; };",
+			[]string{`alternative "k" at 1:11 can never match, it is shadowed by x at 1:7`}},
+		{"longest", "a -> 'x' || 'xy';", nil},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			node, err := ParseString(test.grammar)
+			require.NoError(t, err)
+			require.NoError(t, validate(node))
+			var warnings []string
+			for _, w := range Warnings(node) {
+				assert.Equal(t, ShadowedAlternative, w.(validationError).kind)
+				warnings = append(warnings, w.Error())
+			}
+			assert.Equal(t, test.warnings, warnings)
+		})
+	}
+}
+
+func TestCaselessStringsAfterI(t *testing.T) {
+	for _, test := range []struct {
+		name, grammar string
+		warnings      []string
+	}{
+		{"no rule i", `a -> i"x";`, nil},
+		{"no caseless string", `a -> i "x"; i -> "i";`, nil},
+		{"caseless string", `a -> i"x" i 'y'; i -> "i";`,
+			[]string{`string i"x" is case-insensitive, not rule i followed by "x"@ 1:6`}},
+		{"scoped", `a -> b { b -> i'x'; i -> "i"; };`,
+			[]string{`string i'x' is case-insensitive, not rule i followed by 'x'@ 1:15`}},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			node, err := ParseString(test.grammar)
+			require.NoError(t, err)
+			require.NoError(t, validate(node))
+			var warnings []string
+			for _, w := range Warnings(node) {
+				assert.Equal(t, CaselessStringAfterI, w.(validationError).kind)
+				warnings = append(warnings, w.Error())
+			}
+			assert.Equal(t, test.warnings, warnings)
+		})
+	}
+}
+
+func TestCompileWithWarnings(t *testing.T) {
+	p, warnings, err := CompileWithWarnings(`a -> "x" | "xy";`, nil)
+	require.NoError(t, err)
+	assert.True(t, p.HasRule("a"))
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, ShadowedAlternative, warnings[0].(validationError).kind)
+	}
+
+	_, warnings, err = CompileWithWarnings(`a -> b;`, nil)
+	assert.Error(t, err)
+	assert.Empty(t, warnings)
+}
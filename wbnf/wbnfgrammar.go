@@ -9,18 +9,22 @@ import (
 
 func Grammar() parser.Parsers {
 	return parser.Grammar{".wrapRE": parser.RE(`\s*()\s*`),
-		"COMMENT": parser.RE(`//.*$|(?s:/\*(?:[^*]|\*+[^*/])\*/)`),
-		"IDENT":   parser.RE(`@|[A-Za-z_\.]\w*`),
-		"INT":     parser.RE(`\d+`),
-		"RE":      parser.RE(`/{(?:\\.|{(?:(?:\d+(?:,\d*)?|,\d+)\})?|\[(?:\\.|\[:^?[a-z]+:\]|[^\]])+]|[^\\{\}])*\}|(?:(?:\[(?:\\.|\[:^?[a-z]+:\]|[^\]])+]|\\[pP](?:[a-z]|\{[a-zA-Z_]+\})|\\[a-zA-Z]|[.^$])(?:(?:[+*?]|\{\d+,?\d?\})\??)?)+`),
+		"BOUND":     parser.RE(`\d+|%[A-Za-z_]\w*`),
+		"CALLEE":    parser.RE(`([A-Za-z_]\w*)\(`),
+		"CODEPOINT": parser.RE(`U\+[[:xdigit:]]+`),
+		"COMMENT":   parser.RE(`//.*$|(?s:/\*(?:[^*]|\*+[^*/])\*/)`),
+		"IDENT":     parser.RE(`@|[A-Za-z_]\w*|\.\w+`),
+		"RE":        parser.RE(`/{(?:\\.|{(?:(?:\d+(?:,\d*)?|,\d+)\})?|\[(?:\\.|\[:^?[a-z]+:\]|[^\]])+]|[^\\{\}])*\}|(?:(?:\[(?:\\.|\[:^?[a-z]+:\]|[^\]])+]|\\[pP](?:[a-z]|\{[a-zA-Z_]+\})|\\[a-zA-Z]|[.^$])(?:(?:[+*?]|\{\d+,?\d?\})\??)?)+`),
 		"REF": parser.Seq{parser.CutPoint{parser.S(`%`)},
 			parser.Rule(`IDENT`),
+			parser.Any(parser.Rule(`refmod`)),
 			parser.Opt(parser.Seq{parser.S(`=`),
-				parser.Eq(`default`,
-					parser.Rule(`STR`))})},
-		"STR": parser.RE(`"(?:\\.|[^\\"])*"|'(?:\\.|[^\\'])*'|` + "`" + `(?:` + "`" + `` + "`" + `|[^` + "`" + `])*` + "`" + ``),
-		"atom": parser.Oneof{parser.Rule(`IDENT`),
+				parser.Rule(`atom`)})},
+		"STR": parser.RE(`i?(?:"(?:\\.|[^\\"])*"|'(?:\\.|[^\\'])*'|` + "`" + `(?:` + "`" + `` + "`" + `|[^` + "`" + `])*` + "`" + `)`),
+		"atom": parser.Oneof{parser.Rule(`range`),
 			parser.Rule(`STR`),
+			parser.Rule(`call`),
+			parser.Rule(`IDENT`),
 			parser.Rule(`RE`),
 			parser.Rule(`macrocall`),
 			parser.Eq(`ExtRef`,
@@ -31,7 +35,14 @@ func Grammar() parser.Parsers {
 				parser.Rule(`term`),
 				parser.S(`)`)},
 			parser.Seq{parser.S(`(`),
-				parser.S(`)`)}},
+				parser.S(`)`)},
+			parser.Eq(`cut`,
+				parser.CutPoint{parser.S(`~`)})},
+		"call": parser.Seq{parser.Eq(`name`,
+			parser.Rule(`CALLEE`)),
+			parser.Delim{Term: parser.Opt(parser.Rule(`term`)),
+				Sep: parser.S(`,`)},
+			parser.S(`)`)},
 		"grammar": parser.Some(parser.Rule(`stmt`)),
 		"macrocall": parser.Seq{parser.CutPoint{parser.S(`%!`)},
 			parser.Eq(`name`,
@@ -45,12 +56,18 @@ func Grammar() parser.Parsers {
 				parser.S(`=`))}),
 			parser.Rule(`atom`)},
 		"pragma": parser.ScopedGrammar{Term: parser.Oneof{parser.Rule(`import`),
-			parser.Rule(`macrodef`)},
+			parser.Rule(`macrodef`),
+			parser.Rule(`ignorecase`),
+			parser.Rule(`nocuts`),
+			parser.Rule(`offside`),
+			parser.Rule(`token`)},
 			Grammar: parser.Grammar{".wrapRE": parser.RE(`\s*()\s*`),
+				"ignorecase": parser.Seq{parser.CutPoint{parser.S(`.ignorecase`)},
+					parser.Opt(parser.CutPoint{parser.S(`;`)})},
 				"import": parser.Seq{parser.CutPoint{parser.S(`.import`)},
 					parser.Eq(`path`,
-						parser.Delim{Term: parser.Oneof{parser.CutPoint{parser.S(`..`)},
-							parser.CutPoint{parser.S(`.`)},
+						parser.Delim{Term: parser.Oneof{parser.S(`..`),
+							parser.S(`.`),
 							parser.RE(`[a-zA-Z0-9.:]+`)},
 							Sep:             parser.S(`/`),
 							CanStartWithSep: true}),
@@ -66,8 +83,27 @@ func Grammar() parser.Parsers {
 					parser.S(`{`),
 					parser.Rule(`term`),
 					parser.S(`}`),
+					parser.Opt(parser.CutPoint{parser.S(`;`)})},
+				"nocuts": parser.Seq{parser.CutPoint{parser.S(`.nocuts`)},
+					parser.Delim{Term: parser.Eq(`rule`,
+						parser.Rule(`IDENT`)),
+						Sep: parser.S(`,`)},
+					parser.Opt(parser.CutPoint{parser.S(`;`)})},
+				"offside": parser.Seq{parser.CutPoint{parser.S(`.offside`)},
+					parser.Opt(parser.Eq(`comment`,
+						parser.Rule(`RE`))),
+					parser.Opt(parser.CutPoint{parser.S(`;`)})},
+				"token": parser.Seq{parser.CutPoint{parser.S(`.token`)},
+					parser.Opt(parser.Delim{Term: parser.Eq(`rule`,
+						parser.Rule(`IDENT`)),
+						Sep: parser.S(`,`)}),
 					parser.Opt(parser.CutPoint{parser.S(`;`)})}}},
 		"prod": parser.Seq{parser.Rule(`IDENT`),
+			parser.Opt(parser.Eq(`params`,
+				parser.Seq{parser.S(`(`),
+					parser.Delim{Term: parser.Rule(`IDENT`),
+						Sep: parser.S(`,`)},
+					parser.S(`)`)})),
 			parser.CutPoint{parser.S(`->`)},
 			parser.Some(parser.Rule(`term`)),
 			parser.CutPoint{parser.S(`;`)}},
@@ -75,10 +111,10 @@ func Grammar() parser.Parsers {
 			parser.RE(`[?*+]`)),
 			parser.Seq{parser.S(`{`),
 				parser.Opt(parser.Eq(`min`,
-					parser.Rule(`INT`))),
+					parser.Rule(`BOUND`))),
 				parser.S(`,`),
 				parser.Opt(parser.Eq(`max`,
-					parser.Rule(`INT`))),
+					parser.Rule(`BOUND`))),
 				parser.S(`}`)},
 			parser.Seq{parser.Eq(`op`,
 				parser.RE(`<:|:>?`)),
@@ -86,7 +122,28 @@ func Grammar() parser.Parsers {
 					parser.S(`,`))),
 				parser.Rule(`named`),
 				parser.Opt(parser.Eq(`opt_trailing`,
-					parser.S(`,`)))}},
+					parser.S(`,`)))},
+			parser.Seq{parser.CutPoint{parser.S(`&%%`)},
+				parser.Eq(`pred`,
+					parser.Rule(`IDENT`))},
+			parser.Seq{parser.S(`{`),
+				parser.Eq(`count`,
+					parser.Rule(`BOUND`)),
+				parser.S(`}`)}},
+		"range": parser.Seq{parser.Eq(`lo`,
+			parser.Oneof{parser.Rule(`STR`),
+				parser.Rule(`CODEPOINT`)}),
+			parser.S(`..`),
+			parser.Eq(`hi`,
+				parser.Oneof{parser.Rule(`STR`),
+					parser.Rule(`CODEPOINT`)})},
+		"refmod": parser.Seq{parser.S(`.`),
+			parser.Eq(`name`,
+				parser.Rule(`IDENT`)),
+			parser.Opt(parser.Seq{parser.S(`(`),
+				parser.Eq(`arg`,
+					parser.Rule(`STR`)),
+				parser.S(`)`)})},
 		"stmt": parser.Oneof{parser.Rule(`COMMENT`),
 			parser.Rule(`prod`),
 			parser.Rule(`pragma`)},
@@ -96,11 +153,22 @@ func Grammar() parser.Parsers {
 				parser.S(`}`)})},
 			Sep: parser.Eq(`op`,
 				parser.S(`>`))},
+			parser.Delim{Term: parser.At,
+				Sep: parser.Eq(`op`,
+					parser.S(`||`))},
 			parser.Delim{Term: parser.At,
 				Sep: parser.Eq(`op`,
 					parser.S(`|`))},
+			parser.Delim{Term: parser.At,
+				Sep: parser.Eq(`op`,
+					parser.S(`&&`))},
 			parser.Some(parser.At),
-			parser.Seq{parser.Rule(`named`),
+			parser.Delim{Term: parser.At,
+				Sep: parser.Eq(`op`,
+					parser.S(`-`))},
+			parser.Seq{parser.Opt(parser.Eq(`lookahead`,
+				parser.RE(`[&!]`))),
+				parser.Rule(`named`),
 				parser.Any(parser.Rule(`quant`))}}}.Compile(nil)
 }
 
@@ -148,6 +216,20 @@ type AtomNode struct{ ast.Node }
 func (AtomNode) isWalkableType() {}
 func (c AtomNode) Choice() int   { return ast.Choice(c.Node) }
 
+func (c AtomNode) OneCall() *CallNode {
+	if child := ast.First(c.Node, "call"); child != nil {
+		return &CallNode{child}
+	}
+	return nil
+}
+
+func (c AtomNode) OneCut() string {
+	if child := ast.First(c.Node, "cut"); child != nil {
+		return ast.First(child, "").Scanner().String()
+	}
+	return ""
+}
+
 func (c AtomNode) OneExtRef() *AtomExtRefNode {
 	if child := ast.First(c.Node, "ExtRef"); child != nil {
 		return &AtomExtRefNode{child}
@@ -169,6 +251,13 @@ func (c AtomNode) OneMacrocall() *MacrocallNode {
 	return nil
 }
 
+func (c AtomNode) OneRange() *RangeNode {
+	if child := ast.First(c.Node, "range"); child != nil {
+		return &RangeNode{child}
+	}
+	return nil
+}
+
 func (c AtomNode) OneRe() *ReNode {
 	if child := ast.First(c.Node, "RE"); child != nil {
 		return &ReNode{child}
@@ -212,6 +301,62 @@ func (c AtomNode) AllToken() []string {
 	return out
 }
 
+type BoundNode struct{ ast.Node }
+
+func (BoundNode) isWalkableType() {}
+func (c *BoundNode) String() string {
+	if c == nil || c.Node == nil {
+		return ""
+	}
+	return c.Node.Scanner().String()
+}
+
+type CallNode struct{ ast.Node }
+
+func (CallNode) isWalkableType() {}
+
+func (c CallNode) OneName() *CalleeNode {
+	if child := ast.First(c.Node, "name"); child != nil {
+		return &CalleeNode{child}
+	}
+	return nil
+}
+
+func (c CallNode) AllTerm() []TermNode {
+	var out []TermNode
+	for _, child := range ast.All(c.Node, "term") {
+		out = append(out, TermNode{child})
+	}
+	return out
+}
+
+func (c CallNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
+type CalleeNode struct{ ast.Node }
+
+func (CalleeNode) isWalkableType() {}
+func (c *CalleeNode) String() string {
+	if c == nil || c.Node == nil {
+		return ""
+	}
+	return c.Node.Scanner().String()
+}
+
+type CodepointNode struct{ ast.Node }
+
+func (CodepointNode) isWalkableType() {}
+func (c *CodepointNode) String() string {
+	if c == nil || c.Node == nil {
+		return ""
+	}
+	return c.Node.Scanner().String()
+}
+
 type CommentNode struct{ ast.Node }
 
 func (CommentNode) isWalkableType() {}
@@ -243,16 +388,6 @@ func (c *IdentNode) String() string {
 	return c.Node.Scanner().String()
 }
 
-type IntNode struct{ ast.Node }
-
-func (IntNode) isWalkableType() {}
-func (c *IntNode) String() string {
-	if c == nil || c.Node == nil {
-		return ""
-	}
-	return c.Node.Scanner().String()
-}
-
 type MacrocallNode struct{ ast.Node }
 
 func (MacrocallNode) isWalkableType() {}
@@ -312,6 +447,17 @@ func (c NamedNode) OneOp() string {
 	return ""
 }
 
+type PragmaIgnorecaseNode struct{ ast.Node }
+
+func (PragmaIgnorecaseNode) isWalkableType() {}
+
+func (c PragmaIgnorecaseNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
 type PragmaImportNode struct{ ast.Node }
 
 func (PragmaImportNode) isWalkableType() {}
@@ -383,11 +529,36 @@ func (c PragmaMacrodefNode) AllToken() []string {
 	return out
 }
 
+type PragmaNocutsNode struct{ ast.Node }
+
+func (PragmaNocutsNode) isWalkableType() {}
+func (c PragmaNocutsNode) AllRule() []IdentNode {
+	var out []IdentNode
+	for _, child := range ast.All(c.Node, "rule") {
+		out = append(out, IdentNode{child})
+	}
+	return out
+}
+
+func (c PragmaNocutsNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
 type PragmaNode struct{ ast.Node }
 
 func (PragmaNode) isWalkableType() {}
 func (c PragmaNode) Choice() int   { return ast.Choice(c.Node) }
 
+func (c PragmaNode) OneIgnorecase() *PragmaIgnorecaseNode {
+	if child := ast.First(c.Node, "ignorecase"); child != nil {
+		return &PragmaIgnorecaseNode{child}
+	}
+	return nil
+}
+
 func (c PragmaNode) OneImport() *PragmaImportNode {
 	if child := ast.First(c.Node, "import"); child != nil {
 		return &PragmaImportNode{child}
@@ -402,6 +573,63 @@ func (c PragmaNode) OneMacrodef() *PragmaMacrodefNode {
 	return nil
 }
 
+func (c PragmaNode) OneNocuts() *PragmaNocutsNode {
+	if child := ast.First(c.Node, "nocuts"); child != nil {
+		return &PragmaNocutsNode{child}
+	}
+	return nil
+}
+
+func (c PragmaNode) OneOffside() *PragmaOffsideNode {
+	if child := ast.First(c.Node, "offside"); child != nil {
+		return &PragmaOffsideNode{child}
+	}
+	return nil
+}
+
+func (c PragmaNode) OneToken() *PragmaTokenNode {
+	if child := ast.First(c.Node, "token"); child != nil {
+		return &PragmaTokenNode{child}
+	}
+	return nil
+}
+
+type PragmaOffsideNode struct{ ast.Node }
+
+func (PragmaOffsideNode) isWalkableType() {}
+
+func (c PragmaOffsideNode) OneComment() *ReNode {
+	if child := ast.First(c.Node, "comment"); child != nil {
+		return &ReNode{child}
+	}
+	return nil
+}
+
+func (c PragmaOffsideNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
+type PragmaTokenNode struct{ ast.Node }
+
+func (PragmaTokenNode) isWalkableType() {}
+func (c PragmaTokenNode) AllRule() []IdentNode {
+	var out []IdentNode
+	for _, child := range ast.All(c.Node, "rule") {
+		out = append(out, IdentNode{child})
+	}
+	return out
+}
+
+func (c PragmaTokenNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
 type ProdNode struct{ ast.Node }
 
 func (ProdNode) isWalkableType() {}
@@ -413,6 +641,13 @@ func (c ProdNode) OneIdent() *IdentNode {
 	return nil
 }
 
+func (c ProdNode) OneParams() *ProdParamsNode {
+	if child := ast.First(c.Node, "params"); child != nil {
+		return &ProdParamsNode{child}
+	}
+	return nil
+}
+
 func (c ProdNode) AllTerm() []TermNode {
 	var out []TermNode
 	for _, child := range ast.All(c.Node, "term") {
@@ -436,21 +671,46 @@ func (c ProdNode) AllToken() []string {
 	return out
 }
 
+type ProdParamsNode struct{ ast.Node }
+
+func (ProdParamsNode) isWalkableType() {}
+func (c ProdParamsNode) AllIdent() []IdentNode {
+	var out []IdentNode
+	for _, child := range ast.All(c.Node, "IDENT") {
+		out = append(out, IdentNode{child})
+	}
+	return out
+}
+
+func (c ProdParamsNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
 type QuantNode struct{ ast.Node }
 
 func (QuantNode) isWalkableType() {}
 func (c QuantNode) Choice() int   { return ast.Choice(c.Node) }
 
-func (c QuantNode) OneMax() *IntNode {
+func (c QuantNode) OneCount() *BoundNode {
+	if child := ast.First(c.Node, "count"); child != nil {
+		return &BoundNode{child}
+	}
+	return nil
+}
+
+func (c QuantNode) OneMax() *BoundNode {
 	if child := ast.First(c.Node, "max"); child != nil {
-		return &IntNode{child}
+		return &BoundNode{child}
 	}
 	return nil
 }
 
-func (c QuantNode) OneMin() *IntNode {
+func (c QuantNode) OneMin() *BoundNode {
 	if child := ast.First(c.Node, "min"); child != nil {
-		return &IntNode{child}
+		return &BoundNode{child}
 	}
 	return nil
 }
@@ -483,6 +743,13 @@ func (c QuantNode) OneOptTrailing() string {
 	return ""
 }
 
+func (c QuantNode) OnePred() *IdentNode {
+	if child := ast.First(c.Node, "pred"); child != nil {
+		return &IdentNode{child}
+	}
+	return nil
+}
+
 func (c QuantNode) OneToken() string {
 	if child := ast.First(c.Node, ""); child != nil {
 		return child.Scanner().String()
@@ -498,6 +765,69 @@ func (c QuantNode) AllToken() []string {
 	return out
 }
 
+type RangeHiNode struct{ ast.Node }
+
+func (RangeHiNode) isWalkableType() {}
+func (c RangeHiNode) Choice() int   { return ast.Choice(c.Node) }
+
+func (c RangeHiNode) OneCodepoint() *CodepointNode {
+	if child := ast.First(c.Node, "CODEPOINT"); child != nil {
+		return &CodepointNode{child}
+	}
+	return nil
+}
+
+func (c RangeHiNode) OneStr() *StrNode {
+	if child := ast.First(c.Node, "STR"); child != nil {
+		return &StrNode{child}
+	}
+	return nil
+}
+
+type RangeLoNode struct{ ast.Node }
+
+func (RangeLoNode) isWalkableType() {}
+func (c RangeLoNode) Choice() int   { return ast.Choice(c.Node) }
+
+func (c RangeLoNode) OneCodepoint() *CodepointNode {
+	if child := ast.First(c.Node, "CODEPOINT"); child != nil {
+		return &CodepointNode{child}
+	}
+	return nil
+}
+
+func (c RangeLoNode) OneStr() *StrNode {
+	if child := ast.First(c.Node, "STR"); child != nil {
+		return &StrNode{child}
+	}
+	return nil
+}
+
+type RangeNode struct{ ast.Node }
+
+func (RangeNode) isWalkableType() {}
+
+func (c RangeNode) OneHi() *RangeHiNode {
+	if child := ast.First(c.Node, "hi"); child != nil {
+		return &RangeHiNode{child}
+	}
+	return nil
+}
+
+func (c RangeNode) OneLo() *RangeLoNode {
+	if child := ast.First(c.Node, "lo"); child != nil {
+		return &RangeLoNode{child}
+	}
+	return nil
+}
+
+func (c RangeNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
 type ReNode struct{ ast.Node }
 
 func (ReNode) isWalkableType() {}
@@ -512,9 +842,9 @@ type RefNode struct{ ast.Node }
 
 func (RefNode) isWalkableType() {}
 
-func (c RefNode) OneDefault() *StrNode {
-	if child := ast.First(c.Node, "default"); child != nil {
-		return &StrNode{child}
+func (c RefNode) OneAtom() *AtomNode {
+	if child := ast.First(c.Node, "atom"); child != nil {
+		return &AtomNode{child}
 	}
 	return nil
 }
@@ -526,6 +856,14 @@ func (c RefNode) OneIdent() *IdentNode {
 	return nil
 }
 
+func (c RefNode) AllRefmod() []RefmodNode {
+	var out []RefmodNode
+	for _, child := range ast.All(c.Node, "refmod") {
+		out = append(out, RefmodNode{child})
+	}
+	return out
+}
+
 func (c RefNode) OneToken() string {
 	if child := ast.First(c.Node, ""); child != nil {
 		return child.Scanner().String()
@@ -533,6 +871,39 @@ func (c RefNode) OneToken() string {
 	return ""
 }
 
+type RefmodNode struct{ ast.Node }
+
+func (RefmodNode) isWalkableType() {}
+
+func (c RefmodNode) OneArg() *StrNode {
+	if child := ast.First(c.Node, "arg"); child != nil {
+		return &StrNode{child}
+	}
+	return nil
+}
+
+func (c RefmodNode) OneName() *IdentNode {
+	if child := ast.First(c.Node, "name"); child != nil {
+		return &IdentNode{child}
+	}
+	return nil
+}
+
+func (c RefmodNode) OneToken() string {
+	if child := ast.First(c.Node, ""); child != nil {
+		return child.Scanner().String()
+	}
+	return ""
+}
+
+func (c RefmodNode) AllToken() []string {
+	var out []string
+	for _, child := range ast.All(c.Node, "") {
+		out = append(out, child.Scanner().String())
+	}
+	return out
+}
+
 type StmtNode struct{ ast.Node }
 
 func (StmtNode) isWalkableType() {}
@@ -580,6 +951,13 @@ func (c TermNode) AllGrammar() []GrammarNode {
 	return out
 }
 
+func (c TermNode) OneLookahead() string {
+	if child := ast.First(c.Node, "lookahead"); child != nil {
+		return ast.First(child, "").Scanner().String()
+	}
+	return ""
+}
+
 func (c TermNode) OneNamed() *NamedNode {
 	if child := ast.First(c.Node, "named"); child != nil {
 		return &NamedNode{child}
@@ -633,34 +1011,58 @@ type WalkerOps struct {
 	ExitAtomExtRefNode        func(AtomExtRefNode) Stopper
 	EnterAtomNode             func(AtomNode) Stopper
 	ExitAtomNode              func(AtomNode) Stopper
+	EnterBoundNode            func(BoundNode) Stopper
+	ExitBoundNode             func(BoundNode) Stopper
+	EnterCallNode             func(CallNode) Stopper
+	ExitCallNode              func(CallNode) Stopper
+	EnterCalleeNode           func(CalleeNode) Stopper
+	ExitCalleeNode            func(CalleeNode) Stopper
+	EnterCodepointNode        func(CodepointNode) Stopper
+	ExitCodepointNode         func(CodepointNode) Stopper
 	EnterCommentNode          func(CommentNode) Stopper
 	ExitCommentNode           func(CommentNode) Stopper
 	EnterGrammarNode          func(GrammarNode) Stopper
 	ExitGrammarNode           func(GrammarNode) Stopper
 	EnterIdentNode            func(IdentNode) Stopper
 	ExitIdentNode             func(IdentNode) Stopper
-	EnterIntNode              func(IntNode) Stopper
-	ExitIntNode               func(IntNode) Stopper
 	EnterMacrocallNode        func(MacrocallNode) Stopper
 	ExitMacrocallNode         func(MacrocallNode) Stopper
 	EnterNamedNode            func(NamedNode) Stopper
 	ExitNamedNode             func(NamedNode) Stopper
+	EnterPragmaIgnorecaseNode func(PragmaIgnorecaseNode) Stopper
+	ExitPragmaIgnorecaseNode  func(PragmaIgnorecaseNode) Stopper
 	EnterPragmaImportNode     func(PragmaImportNode) Stopper
 	ExitPragmaImportNode      func(PragmaImportNode) Stopper
 	EnterPragmaImportPathNode func(PragmaImportPathNode) Stopper
 	ExitPragmaImportPathNode  func(PragmaImportPathNode) Stopper
 	EnterPragmaMacrodefNode   func(PragmaMacrodefNode) Stopper
 	ExitPragmaMacrodefNode    func(PragmaMacrodefNode) Stopper
+	EnterPragmaNocutsNode     func(PragmaNocutsNode) Stopper
+	ExitPragmaNocutsNode      func(PragmaNocutsNode) Stopper
 	EnterPragmaNode           func(PragmaNode) Stopper
 	ExitPragmaNode            func(PragmaNode) Stopper
+	EnterPragmaOffsideNode    func(PragmaOffsideNode) Stopper
+	ExitPragmaOffsideNode     func(PragmaOffsideNode) Stopper
+	EnterPragmaTokenNode      func(PragmaTokenNode) Stopper
+	ExitPragmaTokenNode       func(PragmaTokenNode) Stopper
 	EnterProdNode             func(ProdNode) Stopper
 	ExitProdNode              func(ProdNode) Stopper
+	EnterProdParamsNode       func(ProdParamsNode) Stopper
+	ExitProdParamsNode        func(ProdParamsNode) Stopper
 	EnterQuantNode            func(QuantNode) Stopper
 	ExitQuantNode             func(QuantNode) Stopper
+	EnterRangeHiNode          func(RangeHiNode) Stopper
+	ExitRangeHiNode           func(RangeHiNode) Stopper
+	EnterRangeLoNode          func(RangeLoNode) Stopper
+	ExitRangeLoNode           func(RangeLoNode) Stopper
+	EnterRangeNode            func(RangeNode) Stopper
+	ExitRangeNode             func(RangeNode) Stopper
 	EnterReNode               func(ReNode) Stopper
 	ExitReNode                func(ReNode) Stopper
 	EnterRefNode              func(RefNode) Stopper
 	ExitRefNode               func(RefNode) Stopper
+	EnterRefmodNode           func(RefmodNode) Stopper
+	ExitRefmodNode            func(RefmodNode) Stopper
 	EnterStmtNode             func(StmtNode) Stopper
 	ExitStmtNode              func(StmtNode) Stopper
 	EnterStrNode              func(StrNode) Stopper
@@ -679,21 +1081,34 @@ func (w WalkerOps) Walk(tree IsWalkableType) Stopper {
 	case AtomNode:
 		return w.WalkAtomNode(node)
 
-	case CommentNode:
-		if fn := w.EnterCommentNode; fn != nil {
+	case BoundNode:
+		if fn := w.EnterBoundNode; fn != nil {
 			return fn(node)
 		}
 
-	case GrammarNode:
-		return w.WalkGrammarNode(node)
+	case CallNode:
+		return w.WalkCallNode(node)
 
-	case IdentNode:
-		if fn := w.EnterIdentNode; fn != nil {
+	case CalleeNode:
+		if fn := w.EnterCalleeNode; fn != nil {
+			return fn(node)
+		}
+
+	case CodepointNode:
+		if fn := w.EnterCodepointNode; fn != nil {
+			return fn(node)
+		}
+
+	case CommentNode:
+		if fn := w.EnterCommentNode; fn != nil {
 			return fn(node)
 		}
 
-	case IntNode:
-		if fn := w.EnterIntNode; fn != nil {
+	case GrammarNode:
+		return w.WalkGrammarNode(node)
+
+	case IdentNode:
+		if fn := w.EnterIdentNode; fn != nil {
 			return fn(node)
 		}
 
@@ -703,6 +1118,9 @@ func (w WalkerOps) Walk(tree IsWalkableType) Stopper {
 	case NamedNode:
 		return w.WalkNamedNode(node)
 
+	case PragmaIgnorecaseNode:
+		return w.WalkPragmaIgnorecaseNode(node)
+
 	case PragmaImportNode:
 		return w.WalkPragmaImportNode(node)
 
@@ -712,15 +1130,36 @@ func (w WalkerOps) Walk(tree IsWalkableType) Stopper {
 	case PragmaMacrodefNode:
 		return w.WalkPragmaMacrodefNode(node)
 
+	case PragmaNocutsNode:
+		return w.WalkPragmaNocutsNode(node)
+
 	case PragmaNode:
 		return w.WalkPragmaNode(node)
 
+	case PragmaOffsideNode:
+		return w.WalkPragmaOffsideNode(node)
+
+	case PragmaTokenNode:
+		return w.WalkPragmaTokenNode(node)
+
 	case ProdNode:
 		return w.WalkProdNode(node)
 
+	case ProdParamsNode:
+		return w.WalkProdParamsNode(node)
+
 	case QuantNode:
 		return w.WalkQuantNode(node)
 
+	case RangeHiNode:
+		return w.WalkRangeHiNode(node)
+
+	case RangeLoNode:
+		return w.WalkRangeLoNode(node)
+
+	case RangeNode:
+		return w.WalkRangeNode(node)
+
 	case ReNode:
 		if fn := w.EnterReNode; fn != nil {
 			return fn(node)
@@ -729,6 +1168,9 @@ func (w WalkerOps) Walk(tree IsWalkableType) Stopper {
 	case RefNode:
 		return w.WalkRefNode(node)
 
+	case RefmodNode:
+		return w.WalkRefmodNode(node)
+
 	case StmtNode:
 		return w.WalkStmtNode(node)
 
@@ -789,6 +1231,16 @@ func (w WalkerOps) WalkAtomNode(node AtomNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneCall(); child != nil {
+		child := *child
+		if s := w.WalkCallNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 	if child := node.OneExtRef(); child != nil {
 		child := *child
 		if s := w.WalkAtomExtRefNode(child); s != nil {
@@ -821,6 +1273,16 @@ func (w WalkerOps) WalkAtomNode(node AtomNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneRange(); child != nil {
+		child := *child
+		if s := w.WalkRangeNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 	if child := node.OneRe(); child != nil {
 		child := *child
 		if fn := w.EnterReNode; fn != nil {
@@ -874,6 +1336,46 @@ func (w WalkerOps) WalkAtomNode(node AtomNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkCallNode(node CallNode) Stopper {
+	if fn := w.EnterCallNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneName(); child != nil {
+		child := *child
+		if fn := w.EnterCalleeNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+	for _, child := range node.AllTerm() {
+		if s := w.WalkTermNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+
+	if fn := w.ExitCallNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkGrammarNode(node GrammarNode) Stopper {
 	if fn := w.EnterGrammarNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -983,6 +1485,25 @@ func (w WalkerOps) WalkNamedNode(node NamedNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkPragmaIgnorecaseNode(node PragmaIgnorecaseNode) Stopper {
+	if fn := w.EnterPragmaIgnorecaseNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+
+	if fn := w.ExitPragmaIgnorecaseNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkPragmaImportNode(node PragmaImportNode) Stopper {
 	if fn := w.EnterPragmaImportNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -1083,6 +1604,36 @@ func (w WalkerOps) WalkPragmaMacrodefNode(node PragmaMacrodefNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkPragmaNocutsNode(node PragmaNocutsNode) Stopper {
+	if fn := w.EnterPragmaNocutsNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	for _, child := range node.AllRule() {
+		if fn := w.EnterIdentNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitPragmaNocutsNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkPragmaNode(node PragmaNode) Stopper {
 	if fn := w.EnterPragmaNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -1093,6 +1644,16 @@ func (w WalkerOps) WalkPragmaNode(node PragmaNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneIgnorecase(); child != nil {
+		child := *child
+		if s := w.WalkPragmaIgnorecaseNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 	if child := node.OneImport(); child != nil {
 		child := *child
 		if s := w.WalkPragmaImportNode(child); s != nil {
@@ -1113,6 +1674,36 @@ func (w WalkerOps) WalkPragmaNode(node PragmaNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneNocuts(); child != nil {
+		child := *child
+		if s := w.WalkPragmaNocutsNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneOffside(); child != nil {
+		child := *child
+		if s := w.WalkPragmaOffsideNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneToken(); child != nil {
+		child := *child
+		if s := w.WalkPragmaTokenNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 
 	if fn := w.ExitPragmaNode; fn != nil {
 		if s := fn(node); s != nil && s.Abort() {
@@ -1122,6 +1713,67 @@ func (w WalkerOps) WalkPragmaNode(node PragmaNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkPragmaOffsideNode(node PragmaOffsideNode) Stopper {
+	if fn := w.EnterPragmaOffsideNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneComment(); child != nil {
+		child := *child
+		if fn := w.EnterReNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitPragmaOffsideNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
+func (w WalkerOps) WalkPragmaTokenNode(node PragmaTokenNode) Stopper {
+	if fn := w.EnterPragmaTokenNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	for _, child := range node.AllRule() {
+		if fn := w.EnterIdentNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitPragmaTokenNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkProdNode(node ProdNode) Stopper {
 	if fn := w.EnterProdNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -1144,6 +1796,16 @@ func (w WalkerOps) WalkProdNode(node ProdNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneParams(); child != nil {
+		child := *child
+		if s := w.WalkProdParamsNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 	for _, child := range node.AllTerm() {
 		if s := w.WalkTermNode(child); s != nil {
 			if s.ExitNode() {
@@ -1162,6 +1824,36 @@ func (w WalkerOps) WalkProdNode(node ProdNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkProdParamsNode(node ProdParamsNode) Stopper {
+	if fn := w.EnterProdParamsNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	for _, child := range node.AllIdent() {
+		if fn := w.EnterIdentNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitProdParamsNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkQuantNode(node QuantNode) Stopper {
 	if fn := w.EnterQuantNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -1172,9 +1864,21 @@ func (w WalkerOps) WalkQuantNode(node QuantNode) Stopper {
 			}
 		}
 	}
+	if child := node.OneCount(); child != nil {
+		child := *child
+		if fn := w.EnterBoundNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
 	if child := node.OneMax(); child != nil {
 		child := *child
-		if fn := w.EnterIntNode; fn != nil {
+		if fn := w.EnterBoundNode; fn != nil {
 			if s := fn(child); s != nil {
 				if s.ExitNode() {
 					return nil
@@ -1186,7 +1890,7 @@ func (w WalkerOps) WalkQuantNode(node QuantNode) Stopper {
 	}
 	if child := node.OneMin(); child != nil {
 		child := *child
-		if fn := w.EnterIntNode; fn != nil {
+		if fn := w.EnterBoundNode; fn != nil {
 			if s := fn(child); s != nil {
 				if s.ExitNode() {
 					return nil
@@ -1206,6 +1910,18 @@ func (w WalkerOps) WalkQuantNode(node QuantNode) Stopper {
 			}
 		}
 	}
+	if child := node.OnePred(); child != nil {
+		child := *child
+		if fn := w.EnterIdentNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
 
 	if fn := w.ExitQuantNode; fn != nil {
 		if s := fn(node); s != nil && s.Abort() {
@@ -1215,8 +1931,51 @@ func (w WalkerOps) WalkQuantNode(node QuantNode) Stopper {
 	return nil
 }
 
-func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
-	if fn := w.EnterRefNode; fn != nil {
+func (w WalkerOps) WalkRangeHiNode(node RangeHiNode) Stopper {
+	if fn := w.EnterRangeHiNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneCodepoint(); child != nil {
+		child := *child
+		if fn := w.EnterCodepointNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+	if child := node.OneStr(); child != nil {
+		child := *child
+		if fn := w.EnterStrNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitRangeHiNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
+func (w WalkerOps) WalkRangeLoNode(node RangeLoNode) Stopper {
+	if fn := w.EnterRangeLoNode; fn != nil {
 		if s := fn(node); s != nil {
 			if s.ExitNode() {
 				return nil
@@ -1225,7 +1984,19 @@ func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
 			}
 		}
 	}
-	if child := node.OneDefault(); child != nil {
+	if child := node.OneCodepoint(); child != nil {
+		child := *child
+		if fn := w.EnterCodepointNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+	if child := node.OneStr(); child != nil {
 		child := *child
 		if fn := w.EnterStrNode; fn != nil {
 			if s := fn(child); s != nil {
@@ -1237,6 +2008,74 @@ func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
 			}
 		}
 	}
+
+	if fn := w.ExitRangeLoNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
+func (w WalkerOps) WalkRangeNode(node RangeNode) Stopper {
+	if fn := w.EnterRangeNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneHi(); child != nil {
+		child := *child
+		if s := w.WalkRangeHiNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneLo(); child != nil {
+		child := *child
+		if s := w.WalkRangeLoNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+
+	if fn := w.ExitRangeNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
+func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
+	if fn := w.EnterRefNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneAtom(); child != nil {
+		child := *child
+		if s := w.WalkAtomNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 	if child := node.OneIdent(); child != nil {
 		child := *child
 		if fn := w.EnterIdentNode; fn != nil {
@@ -1249,6 +2088,15 @@ func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
 			}
 		}
 	}
+	for _, child := range node.AllRefmod() {
+		if s := w.WalkRefmodNode(child); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
 
 	if fn := w.ExitRefNode; fn != nil {
 		if s := fn(node); s != nil && s.Abort() {
@@ -1258,6 +2106,49 @@ func (w WalkerOps) WalkRefNode(node RefNode) Stopper {
 	return nil
 }
 
+func (w WalkerOps) WalkRefmodNode(node RefmodNode) Stopper {
+	if fn := w.EnterRefmodNode; fn != nil {
+		if s := fn(node); s != nil {
+			if s.ExitNode() {
+				return nil
+			} else if s.Abort() {
+				return s
+			}
+		}
+	}
+	if child := node.OneArg(); child != nil {
+		child := *child
+		if fn := w.EnterStrNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+	if child := node.OneName(); child != nil {
+		child := *child
+		if fn := w.EnterIdentNode; fn != nil {
+			if s := fn(child); s != nil {
+				if s.ExitNode() {
+					return nil
+				} else if s.Abort() {
+					return s
+				}
+			}
+		}
+	}
+
+	if fn := w.ExitRefmodNode; fn != nil {
+		if s := fn(node); s != nil && s.Abort() {
+			return s
+		}
+	}
+	return nil
+}
+
 func (w WalkerOps) WalkStmtNode(node StmtNode) Stopper {
 	if fn := w.EnterStmtNode; fn != nil {
 		if s := fn(node); s != nil {
@@ -1386,30 +2277,41 @@ var grammarGrammarSrc = unfakeBackquote(`
 // Non-terminals
 grammar -> stmt+;
 stmt    -> COMMENT | prod | pragma;
-prod    -> IDENT "->" term+ ";";
+prod    -> IDENT params=("(" IDENT:"," ")")? "->" term+ ";";
 term    -> (@ ("{" grammar "}")? ):op=">"
+         > @:op="||"
          > @:op="|"
+         > @:op="&&"
          > @+
-         > named quant*;
+         > @:op="-"
+         > lookahead=/{[&!]}? named quant*;
 named   -> (IDENT op="=")? atom;
 quant   -> op=[?*+]
-         | "{" min=INT? "," max=INT? "}"
-         | op=/{<:|:>?} opt_leading=","? named opt_trailing=","?;
-atom    -> IDENT | STR | RE | macrocall | ExtRef=("%%" IDENT) | REF | "(" term ")" | "(" ")";
-
+         | "{" min=BOUND? "," max=BOUND? "}"
+         | op=/{<:|:>?} opt_leading=","? named opt_trailing=","?
+         | "&%%" pred=IDENT
+         | "{" count=BOUND "}";
+atom    -> range | STR | call | IDENT | RE | macrocall | ExtRef=("%%" IDENT) | REF | "(" term ")" | "(" ")" | cut="~";
+
+range       -> lo=(STR | CODEPOINT) ".." hi=(STR | CODEPOINT);
+call        -> name=CALLEE term:","? ")";
 macrocall   -> "%!" name=IDENT "(" term:","? ")";
-REF         -> "%" IDENT ("=" default=STR)?;
+REF         -> "%" IDENT refmod* ("=" atom)?;
+refmod      -> "." name=IDENT ("(" arg=STR ")")?;
 
 // Terminals
 COMMENT -> /{ //.*$
             | (?s: /\* (?: [^*] | \*+[^*/] ) \*/ )
             };
-IDENT   -> /{@|[A-Za-z_\.]\w*};
-INT     -> \d+;
-STR     -> /{ " (?: \\. | [^\\"] )* "
-            | ' (?: \\. | [^\\'] )* '
-            | ‵ (?: ‵‵  | [^‵]   )* ‵
-            };
+IDENT   -> /{@|[A-Za-z_]\w*|\.\w+};
+CALLEE  -> /{([A-Za-z_]\w*)\(};
+BOUND   -> /{\d+|%[A-Za-z_]\w*};
+STR     -> /{ i?
+            (?: " (?: \\. | [^\\"] )* "
+              | ' (?: \\. | [^\\'] )* '
+              | ‵ (?: ‵‵  | [^‵]   )* ‵
+            )};
+CODEPOINT -> /{U\+[[:xdigit:]]+};
 RE      -> /{
              /{
                (?:
@@ -1430,9 +2332,13 @@ RE      -> /{
            };
 
 // Special
-pragma  -> import | macrodef {
-                import   -> ".import" path=((".."|"."|[a-zA-Z0-9.:]+):,"/") ";"?;
-                macrodef -> ".macro" name=IDENT "(" args=IDENT:","? ")" "{" term "}" ";"?;
+pragma  -> import | macrodef | ignorecase | nocuts | offside | token {
+                import     -> ".import" path=((".."|"."|[a-zA-Z0-9.:]+):,"/") ";"?;
+                macrodef   -> ".macro" name=IDENT "(" args=IDENT:","? ")" "{" term "}" ";"?;
+                ignorecase -> ".ignorecase" ";"?;
+                nocuts     -> ".nocuts" rule=IDENT:"," ";"?;
+                offside    -> ".offside" comment=RE? ";"?;
+                token      -> ".token" (rule=IDENT:",")? ";"?;
             };
 
 .wrapRE -> /{\s*()\s*};